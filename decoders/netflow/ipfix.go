@@ -446,6 +446,9 @@ const (
 	IPFIX_FIELD_natThresholdEvent                     = 467
 )
 
+// IPFIX_PEN_REVERSE is the enterprise number of RFC 5103 reverse information elements.
+const IPFIX_PEN_REVERSE = 29305
+
 // IPFIXPacket represents a decoded IPFIX packet.
 type IPFIXPacket struct {
 	Version             uint16        `json:"version"`
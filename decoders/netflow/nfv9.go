@@ -102,6 +102,32 @@ const (
 	NFV9_FIELD_layer2packetSectionData      = 104
 )
 
+// Cisco ASA NetFlow Security Event Logging (NSEL) fields.
+const (
+	NFV9_FIELD_NF_F_CONN_ID               = 148
+	NFV9_FIELD_NF_F_FLOW_CREATE_TIME_MSEC = 152
+	NFV9_FIELD_NF_F_FLOW_END_TIME_MSEC    = 153
+	NFV9_FIELD_NF_F_XLATE_SRC_ADDR_IPV4   = 225
+	NFV9_FIELD_NF_F_XLATE_DST_ADDR_IPV4   = 226
+	NFV9_FIELD_NF_F_XLATE_SRC_PORT        = 227
+	NFV9_FIELD_NF_F_XLATE_DST_PORT        = 228
+	NFV9_FIELD_NF_F_FWD_FLOW_DELTA_BYTES  = 231
+	NFV9_FIELD_NF_F_REV_FLOW_DELTA_BYTES  = 232
+	NFV9_FIELD_NF_F_FW_EVENT              = 233
+	NFV9_FIELD_NF_F_XLATE_SRC_ADDR_IPV6   = 281
+	NFV9_FIELD_NF_F_XLATE_DST_ADDR_IPV6   = 282
+	NFV9_FIELD_NF_F_EVENT_TIME_MSEC       = 323
+	NFV9_FIELD_NF_F_INGRESS_ACL_ID        = 33000
+	NFV9_FIELD_NF_F_EGRESS_ACL_ID         = 33001
+	NFV9_FIELD_NF_F_FW_EXT_EVENT          = 33002
+	NFV9_FIELD_NF_F_USERNAME              = 40000
+	NFV9_FIELD_NF_F_XLATE_SRC_ADDR_84     = 40001
+	NFV9_FIELD_NF_F_XLATE_DST_ADDR_84     = 40002
+	NFV9_FIELD_NF_F_XLATE_SRC_PORT_84     = 40003
+	NFV9_FIELD_NF_F_XLATE_DST_PORT_84     = 40004
+	NFV9_FIELD_NF_F_FW_EVENT_84           = 40005
+)
+
 // NFv9Packet represents a decoded NetFlow v9 packet.
 type NFv9Packet struct {
 	Version        uint16        `json:"version"`
@@ -238,6 +264,9 @@ func NFv9TypeToString(typeId uint16) string {
 		235: "egressVRFID",
 	}
 
+	if name, ok := nselNameList[typeId]; ok {
+		return name
+	}
 	if typeId > 104 || typeId == 0 {
 		return "Unassigned"
 	} else {
@@ -245,6 +274,31 @@ func NFv9TypeToString(typeId uint16) string {
 	}
 }
 
+var nselNameList = map[uint16]string{
+	148:   "NF_F_CONN_ID",
+	152:   "NF_F_FLOW_CREATE_TIME_MSEC",
+	153:   "NF_F_FLOW_END_TIME_MSEC",
+	225:   "NF_F_XLATE_SRC_ADDR_IPV4",
+	226:   "NF_F_XLATE_DST_ADDR_IPV4",
+	227:   "NF_F_XLATE_SRC_PORT",
+	228:   "NF_F_XLATE_DST_PORT",
+	231:   "NF_F_FWD_FLOW_DELTA_BYTES",
+	232:   "NF_F_REV_FLOW_DELTA_BYTES",
+	233:   "NF_F_FW_EVENT",
+	281:   "NF_F_XLATE_SRC_ADDR_IPV6",
+	282:   "NF_F_XLATE_DST_ADDR_IPV6",
+	323:   "NF_F_EVENT_TIME_MSEC",
+	33000: "NF_F_INGRESS_ACL_ID",
+	33001: "NF_F_EGRESS_ACL_ID",
+	33002: "NF_F_FW_EXT_EVENT",
+	40000: "NF_F_USERNAME",
+	40001: "NF_F_XLATE_SRC_ADDR_84",
+	40002: "NF_F_XLATE_DST_ADDR_84",
+	40003: "NF_F_XLATE_SRC_PORT_84",
+	40004: "NF_F_XLATE_DST_PORT_84",
+	40005: "NF_F_FW_EVENT_84",
+}
+
 func NFv9ScopeToString(scopeId uint16) string {
 	nameList := map[uint16]string{
 		1: "System",
@@ -0,0 +1,63 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+func TestCodecSchema(t *testing.T) {
+	t.Parallel()
+	codec, err := NewCodec([]protoproducer.ProtobufFormatterConfig{
+		{Name: "flow_direction", Index: 42, Type: "varint"},
+		{Name: "labels", Index: 43, Type: "string", Array: true},
+	})
+	if err != nil {
+		t.Fatalf("new codec: %v", err)
+	}
+	var schema struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(codec.Schema()), &schema); err != nil {
+		t.Fatalf("decode schema: %v", err)
+	}
+	if schema.Name != "FlowMessage" || schema.Fields[0].Name != "type" {
+		t.Fatalf("unexpected schema %s", codec.Schema())
+	}
+	last := schema.Fields[len(schema.Fields)-2:]
+	if last[0].Name != "flow_direction" || string(last[0].Type) != `"long"` ||
+		last[1].Name != "labels" || string(last[1].Type) != `{"type":"array","items":"string"}` {
+		t.Fatalf("unexpected custom fields %s %s", last[0].Type, last[1].Type)
+	}
+
+	if _, err := NewCodec([]protoproducer.ProtobufFormatterConfig{{Name: "bytes", Index: 9, Type: "varint"}}); err == nil {
+		t.Fatal("expected error on duplicate field")
+	}
+}
+
+func TestCodecAppend(t *testing.T) {
+	t.Parallel()
+	codec, err := NewCodec(nil)
+	if err != nil {
+		t.Fatalf("new codec: %v", err)
+	}
+	var m protoproducer.ProtoProducerMessage
+	m.Type = flowpb.FlowMessage_IPFIX
+	m.TimeReceivedNs = 1
+	m.SequenceNum = 2
+	m.SamplingRate = 64
+
+	out := codec.Append(nil, &m)
+	// type (enum index 4), time_received_ns, sequence_num, sampling_rate as zigzag longs
+	expected := []byte{0x08, 0x02, 0x04, 0x80, 0x01}
+	if !bytes.HasPrefix(out, expected) {
+		t.Fatalf("expected prefix %x, got %x", expected, out)
+	}
+}
@@ -0,0 +1,255 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type avroField struct {
+	Name    string      `json:"name"`
+	Type    interface{} `json:"type"`
+	Default interface{} `json:"default"`
+}
+
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroEnum struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+	Default string   `json:"default"`
+}
+
+type avroArray struct {
+	Type  string      `json:"type"`
+	Items interface{} `json:"items"`
+}
+
+// encodeFunc appends the Avro encoding of a value.
+type encodeFunc func(b []byte, value interface{}) []byte
+
+type fieldEncoder struct {
+	field  protoreflect.FieldDescriptor // nil for custom fields
+	custom string
+	encode encodeFunc
+}
+
+// Codec holds the Avro schema of flow messages for a mapping and encodes them.
+type Codec struct {
+	schema string
+	fields []fieldEncoder
+}
+
+func appendLong(b []byte, v int64) []byte {
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	b = appendLong(b, int64(len(v)))
+	return append(b, v...)
+}
+
+// encodeLong encodes integers, unsigned 64 bits values above the long range wrap.
+func encodeLong(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case uint32:
+		return appendLong(b, int64(v))
+	case uint64:
+		return appendLong(b, int64(v))
+	case int32:
+		return appendLong(b, int64(v))
+	case int64:
+		return appendLong(b, v)
+	}
+	return appendLong(b, 0)
+}
+
+func encodeBoolean(b []byte, value interface{}) []byte {
+	if v, ok := value.(bool); ok && v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+func encodeDouble(b []byte, value interface{}) []byte {
+	var v float64
+	switch vv := value.(type) {
+	case float32:
+		v = float64(vv)
+	case float64:
+		v = vv
+	}
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func encodeBytes(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return appendBytes(b, v)
+	case string:
+		return appendBytes(b, []byte(v))
+	}
+	return appendLong(b, 0)
+}
+
+// encodeArray encodes a list as a single block.
+func encodeArray(items encodeFunc) encodeFunc {
+	return func(b []byte, value interface{}) []byte {
+		switch v := value.(type) {
+		case protoreflect.List:
+			if v.Len() > 0 {
+				b = appendLong(b, int64(v.Len()))
+				for i := 0; i < v.Len(); i++ {
+					b = items(b, v.Get(i).Interface())
+				}
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				b = appendLong(b, int64(len(v)))
+				for _, item := range v {
+					b = items(b, item)
+				}
+			}
+		}
+		return appendLong(b, 0)
+	}
+}
+
+// protoType returns the Avro type, default value and encoder of a protobuf field.
+func protoType(fd protoreflect.FieldDescriptor) (interface{}, interface{}, encodeFunc, error) {
+	var avroType interface{}
+	var defaultValue interface{}
+	var encode encodeFunc
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		avroType, defaultValue, encode = "boolean", false, encodeBoolean
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		avroType, defaultValue, encode = "long", 0, encodeLong
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		avroType, defaultValue, encode = "double", 0, encodeDouble
+	case protoreflect.StringKind:
+		avroType, defaultValue, encode = "string", "", encodeBytes
+	case protoreflect.BytesKind:
+		avroType, defaultValue, encode = "bytes", "", encodeBytes
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		symbols := make([]string, values.Len())
+		index := make(map[protoreflect.EnumNumber]int64, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			symbols[i] = string(values.Get(i).Name())
+			index[values.Get(i).Number()] = int64(i)
+		}
+		avroType = avroEnum{
+			Type:    "enum",
+			Name:    string(fd.Enum().Name()),
+			Symbols: symbols,
+			Default: symbols[0],
+		}
+		defaultValue = symbols[0]
+		encode = func(b []byte, value interface{}) []byte {
+			v, _ := value.(protoreflect.EnumNumber)
+			return appendLong(b, index[v]) // unknown values are encoded as the first symbol
+		}
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported protobuf kind %s for field %s", fd.Kind(), fd.Name())
+	}
+	if fd.IsList() {
+		return avroArray{Type: "array", Items: avroType}, []interface{}{}, encodeArray(encode), nil
+	}
+	return avroType, defaultValue, encode, nil
+}
+
+// customType returns the Avro type, default value and encoder of a custom mapping field.
+func customType(pbField protoproducer.ProtobufFormatterConfig) (interface{}, interface{}, encodeFunc) {
+	var avroType interface{}
+	var defaultValue interface{}
+	var encode encodeFunc
+	switch pbField.Type {
+	case string(protoproducer.ProtoVarint):
+		avroType, defaultValue, encode = "long", 0, encodeLong
+	case string(protoproducer.ProtoString):
+		avroType, defaultValue, encode = "string", "", encodeBytes
+	default:
+		avroType, defaultValue, encode = "bytes", "", encodeBytes
+	}
+	if pbField.Array {
+		return avroArray{Type: "array", Items: avroType}, []interface{}{}, encodeArray(encode)
+	}
+	return avroType, defaultValue, encode
+}
+
+// NewCodec generates the Avro schema of FlowMessage, followed by the custom fields of the mapping.
+func NewCodec(custom []protoproducer.ProtobufFormatterConfig) (*Codec, error) {
+	record := avroRecord{
+		Type:      "record",
+		Name:      "FlowMessage",
+		Namespace: "flowpb",
+	}
+	codec := &Codec{}
+
+	names := make(map[string]bool)
+	fields := (&flowpb.FlowMessage{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		avroType, defaultValue, encode, err := protoType(fd)
+		if err != nil {
+			return nil, err
+		}
+		name := string(fd.Name())
+		names[name] = true
+		record.Fields = append(record.Fields, avroField{Name: name, Type: avroType, Default: defaultValue})
+		codec.fields = append(codec.fields, fieldEncoder{field: fd, encode: encode})
+	}
+	for _, pbField := range custom {
+		if names[pbField.Name] {
+			return nil, fmt.Errorf("custom field %s already exists", pbField.Name)
+		}
+		names[pbField.Name] = true
+		avroType, defaultValue, encode := customType(pbField)
+		record.Fields = append(record.Fields, avroField{Name: pbField.Name, Type: avroType, Default: defaultValue})
+		codec.fields = append(codec.fields, fieldEncoder{custom: pbField.Name, encode: encode})
+	}
+
+	schema, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("encode schema: %w", err)
+	}
+	codec.schema = string(schema)
+	return codec, nil
+}
+
+// Schema returns the Avro schema in JSON.
+func (c *Codec) Schema() string {
+	return c.schema
+}
+
+// Append appends the Avro binary encoding of a message.
+func (c *Codec) Append(b []byte, m *protoproducer.ProtoProducerMessage) []byte {
+	msg := m.ProtoReflect()
+	var customValues map[string]interface{}
+	for _, f := range c.fields {
+		if f.field != nil {
+			b = f.encode(b, msg.Get(f.field).Interface())
+			continue
+		}
+		if customValues == nil {
+			_, customValues = m.CustomFields()
+		}
+		b = f.encode(b, customValues[f.custom])
+	}
+	return b
+}
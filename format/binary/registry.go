@@ -0,0 +1,103 @@
+package binary
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tgragnato/goflow/format"
+	flowpb "github.com/tgragnato/goflow/pb"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/utils/schemaregistry"
+	"google.golang.org/protobuf/proto"
+)
+
+// RegistryDriver formats flow messages as protobuf framed with the Confluent schema registry
+// wire format (magic byte, schema ID and message indexes) instead of a varint length.
+type RegistryDriver struct {
+	registry schemaregistry.Client
+	subject  schemaregistry.Subject
+	schemaID int
+
+	once   sync.Once
+	schema string
+}
+
+// Prepare registers flags for the schema registry.
+func (d *RegistryDriver) Prepare() error {
+	flag.StringVar(&d.registry.URL, "format.protobuf.registry", "", "Schema registry URL used to register the schema")
+	flag.StringVar(&d.registry.Username, "format.protobuf.registry.username", "", "Schema registry username")
+	flag.StringVar(&d.registry.Password, "format.protobuf.registry.password", "", "Schema registry password")
+	flag.StringVar(&d.subject.Name, "format.protobuf.subject", "flows-value", "Schema registry subject")
+	flag.IntVar(&d.schemaID, "format.protobuf.schema-id", 0, "Static schema ID (skips registration)")
+	return nil
+}
+
+// Init checks that a schema ID can be obtained.
+func (d *RegistryDriver) Init() error {
+	if d.schemaID < 0 {
+		return fmt.Errorf("protobuf registry format: invalid schema ID %d", d.schemaID)
+	}
+	if d.schemaID == 0 && d.registry.URL == "" {
+		return fmt.Errorf("protobuf registry format: a registry URL or a schema ID is required")
+	}
+	d.subject.Client = &d.registry
+	d.subject.ID = int32(d.schemaID)
+	return nil
+}
+
+// Schema returns the protobuf definition of FlowMessage including the custom fields of the mapping.
+func Schema(custom []protoproducer.ProtobufFormatterConfig) string {
+	var fields strings.Builder
+	for _, pbField := range custom {
+		fields.WriteString("  ")
+		if pbField.Array {
+			fields.WriteString("repeated ")
+		}
+		switch pbField.Type {
+		case string(protoproducer.ProtoVarint):
+			fields.WriteString("uint64")
+		case string(protoproducer.ProtoString):
+			fields.WriteString("string")
+		default:
+			fields.WriteString("bytes")
+		}
+		fmt.Fprintf(&fields, " %s = %d;\n", pbField.Name, pbField.Index)
+	}
+	// FlowMessage is the only message, its closing brace ends the definition
+	end := strings.LastIndex(flowpb.Schema, "}")
+	return flowpb.Schema[:end] + fields.String() + flowpb.Schema[end:]
+}
+
+// Format marshals the message with the registry header, preserving a Key when available.
+func (d *RegistryDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	m := dataIf.GetFlowMessage()
+	d.once.Do(func() {
+		custom, _ := m.CustomFields()
+		d.schema = Schema(custom)
+	})
+	id, err := d.subject.SchemaID(schemaregistry.TypeProtobuf, d.schema)
+	if err != nil {
+		return key, nil, fmt.Errorf("protobuf registry format: %w", err)
+	}
+	output, err := proto.MarshalOptions{}.MarshalAppend(schemaregistry.AppendProtobufHeader(nil, id), m)
+	if err != nil {
+		return key, nil, fmt.Errorf("protobuf registry format: %w", err)
+	}
+	return key, output, nil
+}
+
+func init() {
+	format.RegisterFormatDriver("protobuf+registry", &RegistryDriver{})
+}
@@ -0,0 +1,141 @@
+// Package csv implements CSV and TSV output formatting.
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tgragnato/goflow/format"
+)
+
+// CsvDriver formats flow messages as delimited rows following the mapping fields order.
+type CsvDriver struct {
+	header    bool
+	delimiter string
+	comma     rune
+
+	lock            sync.Mutex
+	headerLine      []byte
+	headerSent      bool
+	headerDelegated bool
+}
+
+// Prepare registers flags for CSV formatting.
+func (d *CsvDriver) Prepare() error {
+	flag.BoolVar(&d.header, "format.csv.header", false, "Emit a header line before the first row (at the start of each file with the file transport)")
+	flag.StringVar(&d.delimiter, "format.csv.delimiter", ",", "Column delimiter (use \\t for TSV)")
+	return nil
+}
+
+// Init validates the delimiter.
+func (d *CsvDriver) Init() error {
+	delimiter := strings.ReplaceAll(d.delimiter, `\t`, "\t")
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size == 0 || size != len(delimiter) || comma == utf8.RuneError || comma == '"' || comma == '\r' || comma == '\n' {
+		return fmt.Errorf("csv format: invalid delimiter %q", d.delimiter)
+	}
+	d.comma = comma
+	return nil
+}
+
+func (d *CsvDriver) encode(record []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = d.comma
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	// the transport appends its own separator
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func renderValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = renderValue(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Header returns the header line once the columns are known, nil if disabled.
+func (d *CsvDriver) Header() []byte {
+	if !d.header {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.headerLine
+}
+
+// DelegateHeader lets the transport write the header, which is no longer prepended to the first row.
+func (d *CsvDriver) DelegateHeader() {
+	d.lock.Lock()
+	d.headerDelegated = true
+	d.lock.Unlock()
+}
+
+// Format renders the configured fields of the message as a single row.
+// When enabled and not delegated to the transport, the header line is prepended to the first row.
+func (d *CsvDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(format.FieldsFormatter)
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	names, values := dataIf.FormatFields()
+
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = renderValue(value)
+	}
+	row, err := d.encode(record)
+	if err != nil {
+		return key, nil, fmt.Errorf("csv format: %w", err)
+	}
+	if !d.header {
+		return key, row, nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.headerLine == nil {
+		if d.headerLine, err = d.encode(names); err != nil {
+			return key, nil, fmt.Errorf("csv format header: %w", err)
+		}
+	}
+	if d.headerSent || d.headerDelegated {
+		return key, row, nil
+	}
+	d.headerSent = true
+	output := make([]byte, 0, len(d.headerLine)+len(row)+1)
+	output = append(output, d.headerLine...)
+	output = append(output, '\n')
+	output = append(output, row...)
+	return key, output, nil
+}
+
+func init() {
+	d := &CsvDriver{}
+	format.RegisterFormatDriver("csv", d)
+}
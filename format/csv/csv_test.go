@@ -0,0 +1,234 @@
+package csv
+
+import (
+	"flag"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	"github.com/tgragnato/goflow/producer"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/transport"
+	_ "github.com/tgragnato/goflow/transport/file"
+)
+
+// produce returns the message of a flow formatted with the formatter configuration of a mapping.
+func produce(t *testing.T, formatter protoproducer.FormatterConfig, flow *flowpb.FlowMessage) producer.ProducerMessage {
+	t.Helper()
+	cfg, err := (&protoproducer.ProducerConfig{Formatter: formatter}).Compile()
+	if err != nil {
+		t.Fatalf("compile mapping: %v", err)
+	}
+	p, err := protoproducer.CreateProtoProducer(cfg, nil)
+	if err != nil {
+		t.Fatalf("create producer: %v", err)
+	}
+	msgs, err := p.Produce(flow, &producer.ProduceArgs{TimeReceived: time.Now()})
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("produce: %v", err)
+	}
+	return msgs[0]
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	d := &CsvDriver{delimiter: ","}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	row, err := d.encode([]string{"a,b", `say "hi"`, "line\nbreak", "a\tb", ""})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if expected := "\"a,b\",\"say \"\"hi\"\"\",\"line\nbreak\",a\tb,"; string(row) != expected {
+		t.Fatalf("expected %q, got %q", expected, row)
+	}
+
+	d = &CsvDriver{delimiter: `\t`}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if row, _ = d.encode([]string{"a,b", "a\tb"}); string(row) != "a,b\t\"a\tb\"" {
+		t.Fatalf("expected the tab quoted, got %q", row)
+	}
+
+	for _, delimiter := range []string{`"`, "\n", ",,", ""} {
+		if err := (&CsvDriver{delimiter: delimiter}).Init(); err == nil {
+			t.Fatalf("expected an error for the %q delimiter", delimiter)
+		}
+	}
+}
+
+func TestFormatFields(t *testing.T) {
+	t.Parallel()
+	msg := produce(t, protoproducer.FormatterConfig{
+		Fields: []string{"proto", "bytes", "src_addr", "as_path", "dst_port"},
+		Rename: map[string]string{"proto": "protocol", "src_addr": "src"},
+	}, &flowpb.FlowMessage{
+		Proto:   6,
+		Bytes:   1500,
+		SrcAddr: netip.MustParseAddr("192.0.2.1").AsSlice(),
+		AsPath:  []uint32{65000, 65001},
+		DstPort: 443,
+	})
+
+	d := &CsvDriver{header: true, delimiter: ","}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if header := d.Header(); header != nil {
+		t.Fatalf("expected no header before the first row, got %q", header)
+	}
+	// the header is prepended to the first row only
+	for _, expected := range []string{
+		"protocol,bytes,src,as_path,dst_port\nTCP,1500,192.0.2.1,\"[65000,65001]\",443",
+		"TCP,1500,192.0.2.1,\"[65000,65001]\",443",
+	} {
+		_, row, err := d.Format(msg)
+		if err != nil {
+			t.Fatalf("format: %v", err)
+		}
+		if string(row) != expected {
+			t.Fatalf("expected %q, got %q", expected, row)
+		}
+	}
+	if header := d.Header(); string(header) != "protocol,bytes,src,as_path,dst_port" {
+		t.Fatalf("unexpected header %q", header)
+	}
+
+	// the header delegated to the transport is not prepended
+	d = &CsvDriver{header: true, delimiter: ","}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	d.DelegateHeader()
+	if _, row, err := d.Format(msg); err != nil || string(row) != "TCP,1500,192.0.2.1,\"[65000,65001]\",443" {
+		t.Fatalf("expected the row without header, got %q (%v)", row, err)
+	}
+}
+
+// fileTransport returns the registered file transport configured with flags and writing the header of d.
+// The transport is closed and the flags are reset on cleanup.
+func fileTransport(t *testing.T, d *CsvDriver, flags map[string]string) *transport.Transport {
+	t.Helper()
+	for name, value := range flags {
+		f := flag.Lookup(name)
+		if err := flag.Set(name, value); err != nil {
+			t.Fatalf("set flag: %v", err)
+		}
+		defaultValue := f.DefValue
+		t.Cleanup(func() { flag.Set(name, defaultValue) })
+	}
+	tr, err := transport.FindTransport("file")
+	if err != nil {
+		t.Fatalf("find transport: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	tr.TransportDriver.(transport.HeaderWriter).SetHeader(d.Header)
+	d.DelegateHeader()
+	return tr
+}
+
+// send formats a flow with the proto and bytes columns and sends it to the transport.
+func send(t *testing.T, d *CsvDriver, tr *transport.Transport, bytes uint64) {
+	t.Helper()
+	msg := produce(t, protoproducer.FormatterConfig{Fields: []string{"proto", "bytes"}}, &flowpb.FlowMessage{Proto: 17, Bytes: bytes})
+	_, row, err := d.Format(msg)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if err := tr.Send(nil, row); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+// expectFiles checks the content of files.
+func expectFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, expected := range files {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if string(content) != expected {
+			t.Fatalf("expected %q in %s, got %q", expected, name, content)
+		}
+	}
+}
+
+func TestHeaderReopen(t *testing.T) {
+	// not parallel: uses the registered file transport and SIGHUP
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	d := &CsvDriver{header: true, delimiter: ","}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	tr := fileTransport(t, d, map[string]string{"transport.file": path})
+	send(t, d, tr, 100)
+
+	// the file is moved away then reopened on SIGHUP, the header preceding the next row
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the file reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	send(t, d, tr, 200)
+
+	// the file appended after a restart has no other header
+	if err := tr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	tr = fileTransport(t, d, nil)
+	send(t, d, tr, 300)
+	if err := tr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	expectFiles(t, map[string]string{
+		path + ".1": "proto,bytes\nUDP,100\n",
+		path:        "proto,bytes\nUDP,200\nUDP,300\n",
+	})
+}
+
+func TestHeaderRotate(t *testing.T) {
+	// not parallel: uses the registered file transport
+	dir := t.TempDir()
+	d := &CsvDriver{header: true, delimiter: ","}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	tr := fileTransport(t, d, map[string]string{
+		"transport.file":             filepath.Join(dir, "flows.csv"),
+		"transport.file.sep":         "\r\n",
+		"transport.file.rotate.size": "30",
+	})
+	for _, bytes := range []uint64{100, 200, 300} {
+		send(t, d, tr, bytes)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// each segment starts with a single header, followed by the transport separator
+	expectFiles(t, map[string]string{
+		filepath.Join(dir, "flows.csv"):   "proto,bytes\r\nUDP,100\r\nUDP,200\r\n",
+		filepath.Join(dir, "flows-1.csv"): "proto,bytes\r\nUDP,300\r\n",
+	})
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("expected 2 segments, got %d files", len(entries))
+	}
+}
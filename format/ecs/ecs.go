@@ -0,0 +1,300 @@
+// Package ecs implements Elastic Common Schema (ECS) JSON output formatting.
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+// EcsDriver formats flow messages as nested ECS documents.
+type EcsDriver struct{}
+
+// Document is the ECS representation of a flow.
+type Document struct {
+	Timestamp   string            `json:"@timestamp"`
+	Event       Event             `json:"event"`
+	Source      *Endpoint         `json:"source,omitempty"`
+	Destination *Endpoint         `json:"destination,omitempty"`
+	Network     Network           `json:"network"`
+	Observer    Observer          `json:"observer"`
+	User        *User             `json:"user,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// Event describes the flow as an ECS event.
+type Event struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action,omitempty"`
+	Created  string   `json:"created,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Duration *uint64  `json:"duration,omitempty"`
+}
+
+// Endpoint is the source or the destination of a flow.
+type Endpoint struct {
+	IP      string `json:"ip,omitempty"`
+	Port    uint32 `json:"port,omitempty"`
+	MAC     string `json:"mac,omitempty"`
+	Bytes   uint64 `json:"bytes,omitempty"`
+	Packets uint64 `json:"packets,omitempty"`
+	AS      *AS    `json:"as,omitempty"`
+	Geo     *Geo   `json:"geo,omitempty"`
+	NAT     *NAT   `json:"nat,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// AS is an autonomous system.
+type AS struct {
+	Number       uint32        `json:"number,omitempty"`
+	Organization *Organization `json:"organization,omitempty"`
+}
+
+// Organization names an AS owner.
+type Organization struct {
+	Name string `json:"name"`
+}
+
+// Geo holds the geolocation of an address.
+type Geo struct {
+	CountryISOCode string `json:"country_iso_code"`
+}
+
+// NAT holds the translated address and port.
+type NAT struct {
+	IP   string `json:"ip,omitempty"`
+	Port uint32 `json:"port,omitempty"`
+}
+
+// Network describes the protocols and volume of a flow.
+type Network struct {
+	Type        string `json:"type,omitempty"`
+	Transport   string `json:"transport,omitempty"`
+	IANANumber  string `json:"iana_number,omitempty"`
+	Application string `json:"application,omitempty"`
+	Bytes       uint64 `json:"bytes,omitempty"`
+	Packets     uint64 `json:"packets,omitempty"`
+	VLAN        *VLAN  `json:"vlan,omitempty"`
+}
+
+// VLAN is a VLAN identifier.
+type VLAN struct {
+	ID string `json:"id"`
+}
+
+// Observer is the exporter which reported the flow.
+type Observer struct {
+	IP       string     `json:"ip,omitempty"`
+	Hostname string     `json:"hostname,omitempty"`
+	Type     string     `json:"type"`
+	Ingress  *Interface `json:"ingress,omitempty"`
+	Egress   *Interface `json:"egress,omitempty"`
+}
+
+// Interface wraps an interface index of the observer.
+type Interface struct {
+	Interface InterfaceID `json:"interface"`
+}
+
+// InterfaceID is an interface index of the observer.
+type InterfaceID struct {
+	ID string `json:"id"`
+}
+
+// User is the user associated with a flow.
+type User struct {
+	Name string `json:"name"`
+}
+
+// Prepare performs any one-time setup for the driver.
+func (d *EcsDriver) Prepare() error {
+	return nil
+}
+
+// Init finalizes runtime configuration for the driver.
+func (d *EcsDriver) Init() error {
+	return nil
+}
+
+func renderTime(ns uint64) string {
+	if ns == 0 {
+		return ""
+	}
+	return time.Unix(0, int64(ns)).UTC().Format(time.RFC3339Nano)
+}
+
+// renderMAC formats a MAC address as recommended by ECS (uppercase, dash separated).
+func renderMAC(mac uint64) string {
+	if mac == 0 {
+		return ""
+	}
+	return strings.ToUpper(fmt.Sprintf("%02x-%02x-%02x-%02x-%02x-%02x",
+		byte(mac>>40), byte(mac>>32), byte(mac>>24), byte(mac>>16), byte(mac>>8), byte(mac)))
+}
+
+func newAS(number uint32, organization string) *AS {
+	if number == 0 && organization == "" {
+		return nil
+	}
+	as := &AS{Number: number}
+	if organization != "" {
+		as.Organization = &Organization{Name: organization}
+	}
+	return as
+}
+
+func newGeo(country string) *Geo {
+	// unknown countries are reported as "??" by the GeoIP enrichment
+	if country == "" || country == "??" {
+		return nil
+	}
+	return &Geo{CountryISOCode: country}
+}
+
+func newNAT(addr []byte, port uint32) *NAT {
+	ip := protoproducer.RenderIP(addr)
+	if ip == "" && port == 0 {
+		return nil
+	}
+	return &NAT{IP: ip, Port: port}
+}
+
+func newInterface(index uint32) *Interface {
+	if index == 0 {
+		return nil
+	}
+	return &Interface{Interface: InterfaceID{ID: strconv.FormatUint(uint64(index), 10)}}
+}
+
+// NewDocument maps a flow message to an ECS document.
+func NewDocument(m *protoproducer.ProtoProducerMessage) *Document {
+	doc := &Document{
+		Timestamp: renderTime(m.TimeReceivedNs),
+		Event: Event{
+			Kind:     "event",
+			Category: []string{"network"},
+			Type:     []string{"connection"},
+			Created:  renderTime(m.TimeReceivedNs),
+			Start:    renderTime(m.TimeFlowStartNs),
+			End:      renderTime(m.TimeFlowEndNs),
+		},
+		Network: Network{
+			Application: strings.ToLower(m.ApplicationName),
+			Bytes:       m.Bytes,
+			Packets:     m.Packets,
+		},
+		Observer: Observer{
+			IP:       protoproducer.RenderIP(m.SamplerAddress),
+			Hostname: m.SamplerHostname,
+			Type:     "router",
+			Ingress:  newInterface(m.InIf),
+			Egress:   newInterface(m.OutIf),
+		},
+	}
+	if m.TimeFlowStartNs != 0 && m.TimeFlowEndNs >= m.TimeFlowStartNs {
+		duration := m.TimeFlowEndNs - m.TimeFlowStartNs
+		doc.Event.Duration = &duration
+	}
+	if m.FwEvent != 0 || m.FwExtEvent != 0 {
+		event := m.FwEvent
+		if m.FwExtEvent != 0 {
+			event = m.FwExtEvent
+		}
+		doc.Event.Action = protoproducer.FirewallEventName(event)
+	}
+
+	switch m.Etype {
+	case 0x800:
+		doc.Network.Type = "ipv4"
+	case 0x86dd:
+		doc.Network.Type = "ipv6"
+	case 0x806:
+		doc.Network.Type = "arp"
+	}
+	if m.Etype == 0x800 || m.Etype == 0x86dd {
+		doc.Network.Transport = strings.ToLower(protoproducer.ProtoName(m.Proto))
+		doc.Network.IANANumber = strconv.FormatUint(uint64(m.Proto), 10)
+	}
+	if m.VlanId != 0 {
+		doc.Network.VLAN = &VLAN{ID: strconv.FormatUint(uint64(m.VlanId), 10)}
+	}
+
+	source := &Endpoint{
+		IP:   protoproducer.RenderIP(m.SrcAddr),
+		Port: m.SrcPort,
+		MAC:  renderMAC(m.SrcMac),
+		AS:   newAS(m.SrcAs, m.SrcAsn),
+		Geo:  newGeo(m.SrcCountry),
+		NAT:  newNAT(m.XlateSrcAddr, m.XlateSrcPort),
+	}
+	destination := &Endpoint{
+		IP:   protoproducer.RenderIP(m.DstAddr),
+		Port: m.DstPort,
+		MAC:  renderMAC(m.DstMac),
+		AS:   newAS(m.DstAs, m.DstAsn),
+		Geo:  newGeo(m.DstCountry),
+		NAT:  newNAT(m.XlateDstAddr, m.XlateDstPort),
+	}
+	source.Address = source.IP
+	destination.Address = destination.IP
+	if m.InitiatorOctets != 0 || m.ResponderOctets != 0 {
+		// bidirectional firewall flows
+		source.Bytes = m.InitiatorOctets
+		destination.Bytes = m.ResponderOctets
+	} else {
+		source.Bytes = m.Bytes
+		source.Packets = m.Packets
+	}
+	if *source != (Endpoint{}) {
+		doc.Source = source
+	}
+	if *destination != (Endpoint{}) {
+		doc.Destination = destination
+	}
+
+	if m.Username != "" {
+		doc.User = &User{Name: m.Username}
+	}
+	if m.SamplerSite != "" || m.SamplerTenant != "" {
+		doc.Labels = make(map[string]string)
+		if m.SamplerSite != "" {
+			doc.Labels["site"] = m.SamplerSite
+		}
+		if m.SamplerTenant != "" {
+			doc.Labels["tenant"] = m.SamplerTenant
+		}
+	}
+	return doc
+}
+
+// Format encodes the flow message as an ECS JSON document, preserving a Key when available.
+func (d *EcsDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	output, err := json.Marshal(NewDocument(dataIf.GetFlowMessage()))
+	if err != nil {
+		return key, nil, fmt.Errorf("ecs format: %w", err)
+	}
+	return key, output, nil
+}
+
+func init() {
+	d := &EcsDriver{}
+	format.RegisterFormatDriver("ecs", d)
+}
@@ -0,0 +1,104 @@
+package ecs
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+type testMessage struct {
+	m *protoproducer.ProtoProducerMessage
+}
+
+func (t testMessage) GetFlowMessage() *protoproducer.ProtoProducerMessage {
+	return t.m
+}
+
+func addr(s string) []byte {
+	return netip.MustParseAddr(s).AsSlice()
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	ipv4 := &protoproducer.ProtoProducerMessage{}
+	ipv4.TimeReceivedNs = 1714554002000000000
+	ipv4.TimeFlowStartNs = 1714554000000000000
+	ipv4.TimeFlowEndNs = 1714554001500000000
+	ipv4.SamplerAddress = addr("192.0.2.254")
+	ipv4.SamplerHostname = "router1"
+	ipv4.SamplerSite = "par1"
+	ipv4.InIf = 10
+	ipv4.Etype = 0x800
+	ipv4.Proto = 6
+	ipv4.SrcAddr = addr("192.0.2.1")
+	ipv4.DstAddr = addr("198.51.100.2")
+	ipv4.SrcPort = 443
+	ipv4.DstPort = 51000
+	ipv4.SrcMac = 0x0011223344ff
+	ipv4.Bytes = 1500
+	ipv4.Packets = 3
+	ipv4.VlanId = 100
+	ipv4.ApplicationName = "HTTPS"
+	ipv4.SrcAs = 64496
+	ipv4.SrcAsn = "Example"
+	ipv4.SrcCountry = "FR"
+	ipv4.DstCountry = "??"
+
+	// bidirectional firewall flow without flow times
+	ipv6 := &protoproducer.ProtoProducerMessage{}
+	ipv6.TimeReceivedNs = 1714554000000000000
+	ipv6.Etype = 0x86dd
+	ipv6.Proto = 17
+	ipv6.SrcAddr = addr("2001:db8::1")
+	ipv6.DstAddr = addr("2001:db8::2")
+	ipv6.SrcPort = 53
+	ipv6.DstPort = 5353
+	ipv6.Bytes = 300
+	ipv6.InitiatorOctets = 100
+	ipv6.ResponderOctets = 200
+	ipv6.FwEvent = 2
+	ipv6.XlateSrcAddr = addr("203.0.113.1")
+	ipv6.XlateSrcPort = 40000
+	ipv6.DstAs = 64497
+	ipv6.DstCountry = "DE"
+	ipv6.Username = "alice"
+	ipv6.SamplerTenant = "acme"
+
+	for _, test := range []struct {
+		name     string
+		msg      *protoproducer.ProtoProducerMessage
+		expected string
+	}{
+		{"ipv4", ipv4, `{"@timestamp":"2024-05-01T09:00:02Z",` +
+			`"event":{"kind":"event","category":["network"],"type":["connection"],` +
+			`"created":"2024-05-01T09:00:02Z","start":"2024-05-01T09:00:00Z","end":"2024-05-01T09:00:01.5Z","duration":1500000000},` +
+			`"source":{"ip":"192.0.2.1","port":443,"mac":"00-11-22-33-44-FF","bytes":1500,"packets":3,` +
+			`"as":{"number":64496,"organization":{"name":"Example"}},"geo":{"country_iso_code":"FR"},"address":"192.0.2.1"},` +
+			`"destination":{"ip":"198.51.100.2","port":51000,"address":"198.51.100.2"},` +
+			`"network":{"type":"ipv4","transport":"tcp","iana_number":"6","application":"https","bytes":1500,"packets":3,"vlan":{"id":"100"}},` +
+			`"observer":{"ip":"192.0.2.254","hostname":"router1","type":"router","ingress":{"interface":{"id":"10"}}},` +
+			`"labels":{"site":"par1"}}`},
+		{"ipv6", ipv6, `{"@timestamp":"2024-05-01T09:00:00Z",` +
+			`"event":{"kind":"event","category":["network"],"type":["connection"],"action":"FlowDeleted","created":"2024-05-01T09:00:00Z"},` +
+			`"source":{"ip":"2001:db8::1","port":53,"bytes":100,"nat":{"ip":"203.0.113.1","port":40000},"address":"2001:db8::1"},` +
+			`"destination":{"ip":"2001:db8::2","port":5353,"bytes":200,"as":{"number":64497},"geo":{"country_iso_code":"DE"},"address":"2001:db8::2"},` +
+			`"network":{"type":"ipv6","transport":"udp","iana_number":"17","bytes":300},` +
+			`"observer":{"type":"router"},"user":{"name":"alice"},"labels":{"tenant":"acme"}}`},
+	} {
+		d := &EcsDriver{}
+		_, output, err := d.Format(testMessage{test.msg})
+		if err != nil {
+			t.Fatalf("%s: format: %v", test.name, err)
+		}
+		if string(output) != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.expected, output)
+		}
+	}
+
+	if _, _, err := (&EcsDriver{}).Format([]byte("raw")); !errors.Is(err, format.ErrNoSerializer) {
+		t.Fatalf("expected ErrNoSerializer, got %v", err)
+	}
+}
@@ -37,6 +37,20 @@ type FormatDriver interface {
 	Format(data interface{}) ([]byte, []byte, error) // Send a message
 }
 
+// FieldsFormatter is implemented by messages exposing their configured output fields
+// in order, with rendered values (nil when absent).
+type FieldsFormatter interface {
+	FormatFields() ([]string, []interface{})
+}
+
+// HeaderFormatter is implemented by drivers which write a header line before the messages.
+// Header returns nil until the header is known or when disabled. The header is prepended
+// to the first message, unless DelegateHeader was called for the transport to write it.
+type HeaderFormatter interface {
+	Header() []byte
+	DelegateHeader()
+}
+
 // FormatInterface is the minimal interface needed to format payloads.
 type FormatInterface interface {
 	Format(data interface{}) ([]byte, []byte, error)
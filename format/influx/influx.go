@@ -0,0 +1,158 @@
+// Package influx implements InfluxDB line protocol output formatting.
+package influx
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+// InfluxDriver formats flow messages as InfluxDB line protocol.
+// The fields listed in formatter.tags of the mapping become tags, the others become fields.
+type InfluxDriver struct {
+	measurement string
+}
+
+// Prepare registers flags for line protocol formatting.
+func (d *InfluxDriver) Prepare() error {
+	flag.StringVar(&d.measurement, "format.influx.measurement", "flows", "Measurement name")
+	return nil
+}
+
+// Init validates the measurement name.
+func (d *InfluxDriver) Init() error {
+	if d.measurement == "" {
+		return fmt.Errorf("influx format: empty measurement")
+	}
+	return nil
+}
+
+// tagValue renders a value as a tag, returning false for empty values which are not allowed.
+func tagValue(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		s = "[" + strings.Join(items, ",") + "]"
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" {
+		return "", false
+	}
+	return keyEscaper.Replace(s), true
+}
+
+// fieldValue renders a typed field value. Unsigned integers are written as such,
+// so that a field keeps its type whatever its values.
+func fieldValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10) + "u", true
+	case uint64:
+		return strconv.FormatUint(v, 10) + "u", true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return `"` + stringEscaper.Replace("["+strings.Join(items, ",")+"]") + `"`, true
+	default:
+		return `"` + stringEscaper.Replace(fmt.Sprint(v)) + `"`, true
+	}
+}
+
+// Format renders the message as a single line, preserving a Key when available.
+// The timestamp is the end of the flow in nanoseconds, or the reception time if unknown.
+func (d *InfluxDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+		FormatTags() []bool
+		format.FieldsFormatter
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	m := dataIf.GetFlowMessage()
+	names, values := dataIf.FormatFields()
+	tags := dataIf.FormatTags()
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(d.measurement))
+	for i, name := range names {
+		if !tags[i] {
+			continue
+		}
+		if value, ok := tagValue(values[i]); ok {
+			b.WriteByte(',')
+			b.WriteString(keyEscaper.Replace(name))
+			b.WriteByte('=')
+			b.WriteString(value)
+		}
+	}
+
+	sep := byte(' ')
+	for i, name := range names {
+		if tags[i] {
+			continue
+		}
+		if value, ok := fieldValue(values[i]); ok {
+			b.WriteByte(sep)
+			b.WriteString(keyEscaper.Replace(name))
+			b.WriteByte('=')
+			b.WriteString(value)
+			sep = ','
+		}
+	}
+	if sep == ' ' {
+		return key, nil, fmt.Errorf("influx format: no field to write")
+	}
+
+	timestamp := m.TimeFlowEndNs
+	if timestamp == 0 {
+		timestamp = m.TimeReceivedNs
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatUint(timestamp, 10))
+	return key, []byte(b.String()), nil
+}
+
+func init() {
+	d := &InfluxDriver{}
+	format.RegisterFormatDriver("influx", d)
+}
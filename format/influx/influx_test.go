@@ -0,0 +1,117 @@
+package influx
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+type testMessage struct {
+	m      *protoproducer.ProtoProducerMessage
+	names  []string
+	values []interface{}
+	tags   []bool
+}
+
+func (t testMessage) GetFlowMessage() *protoproducer.ProtoProducerMessage {
+	return t.m
+}
+
+func (t testMessage) FormatFields() ([]string, []interface{}) {
+	return t.names, t.values
+}
+
+func (t testMessage) FormatTags() []bool {
+	return t.tags
+}
+
+func TestEscapers(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name     string
+		replacer interface{ Replace(string) string }
+		input    string
+		expected string
+	}{
+		{"measurement", measurementEscaper, "flows, v2=x\n", `flows\,\ v2=x\n`},
+		{"key", keyEscaper, "src addr,as=1\n", `src\ addr\,as\=1\n`},
+		{"string", stringEscaper, `say "hi" C:\` + "\n", `say \"hi\" C:\\\n`},
+	} {
+		if output := test.replacer.Replace(test.input); output != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.expected, output)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	d := &InfluxDriver{measurement: "net flows"}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	m := &protoproducer.ProtoProducerMessage{}
+	m.TimeReceivedNs = 1714554002000000000
+	msg := testMessage{
+		m: m,
+		names: []string{"sampler_address", "proto", "site", "bytes", "src_addr", "as_path",
+			"label", "ratio", "valid", "huge", "missing"},
+		values: []interface{}{"192.0.2.254", "TCP", "", uint64(1500), "192.0.2.1", []interface{}{uint32(65000), uint32(65001)},
+			`a "b"`, 0.5, true, uint64(1 << 63), nil},
+		tags: []bool{true, true, true, false, false, false, false, false, false, false, false},
+	}
+
+	// empty tags and nil values are omitted, the timestamp is the reception time without flow end
+	_, line, err := d.Format(msg)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	expected := `net\ flows,sampler_address=192.0.2.254,proto=TCP ` +
+		`bytes=1500u,src_addr="192.0.2.1",as_path="[65000,65001]",label="a \"b\"",ratio=0.5,valid=true,huge=9223372036854775808u ` +
+		`1714554002000000000`
+	if string(line) != expected {
+		t.Fatalf("expected %s, got %s", expected, line)
+	}
+
+	m.TimeFlowEndNs = 1714554001000000000
+	msg.tags = []bool{true, false, false, false, false, false, false, false, false, false, true}
+	msg.values[10] = "a,b=c d"
+	if _, line, err = d.Format(msg); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	expected = `net\ flows,sampler_address=192.0.2.254,missing=a\,b\=c\ d ` +
+		`proto="TCP",site="",bytes=1500u,src_addr="192.0.2.1",as_path="[65000,65001]",label="a \"b\"",ratio=0.5,valid=true,huge=9223372036854775808u ` +
+		`1714554001000000000`
+	if string(line) != expected {
+		t.Fatalf("expected %s, got %s", expected, line)
+	}
+
+	msg.tags = []bool{true, true, true, true, true, true, true, true, true, true, true}
+	if _, _, err := d.Format(msg); err == nil {
+		t.Fatal("expected an error without field")
+	}
+	if _, _, err := d.Format([]byte("raw")); !errors.Is(err, format.ErrNoSerializer) {
+		t.Fatalf("expected ErrNoSerializer, got %v", err)
+	}
+}
+
+func TestFieldValueUnsigned(t *testing.T) {
+	t.Parallel()
+	// the values around the largest signed integer have the same type
+	for _, test := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{uint32(math.MaxUint32), "4294967295u"},
+		{uint64(math.MaxInt64), "9223372036854775807u"},
+		{uint64(math.MaxInt64 + 1), "9223372036854775808u"},
+		{uint64(math.MaxUint64), "18446744073709551615u"},
+		{int64(math.MinInt64), "-9223372036854775808i"},
+	} {
+		if value, ok := fieldValue(test.value); !ok || value != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, value)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package ipfix implements IPFIX output formatting, to re-export flows to other collectors.
+package ipfix
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+// Template IDs are 256 plus a bit for IPv6 flows and a bit for IPv6 exporters.
+const (
+	TemplateID    = 256
+	templateFlow6 = 1
+	templateSamp6 = 2
+	templateCount = 4
+	templateSetID = 2 // IPFIX template set ID
+)
+
+// element is an information element of the templates and the encoding of its value.
+type element struct {
+	id     uint16
+	length uint16
+	value  func(b []byte, m *protoproducer.ProtoProducerMessage) []byte
+}
+
+func appendUint(b []byte, v uint64, length uint16) []byte {
+	switch length {
+	case 1:
+		return append(b, byte(v))
+	case 2:
+		return binary.BigEndian.AppendUint16(b, uint16(v))
+	case 4:
+		return binary.BigEndian.AppendUint32(b, uint32(v))
+	case 6:
+		return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// appendAddr appends an address as 4 or 16 bytes, zeroes when it does not fit.
+func appendAddr(b []byte, addr []byte, length uint16) []byte {
+	ip, ok := netip.AddrFromSlice(addr)
+	switch {
+	case ok && length == 4 && ip.Unmap().Is4():
+		v := ip.Unmap().As4()
+		return append(b, v[:]...)
+	case ok && length == 16:
+		v := ip.As16()
+		return append(b, v[:]...)
+	}
+	return append(b, make([]byte, length)...)
+}
+
+func uintElement(id, length uint16, get func(m *protoproducer.ProtoProducerMessage) uint64) element {
+	return element{id, length, func(b []byte, m *protoproducer.ProtoProducerMessage) []byte {
+		v := get(m)
+		if length < 8 && v >= 1<<(8*length) { // saturate instead of wrapping
+			v = 1<<(8*length) - 1
+		}
+		return appendUint(b, v, length)
+	}}
+}
+
+func addrElement(id, length uint16, get func(m *protoproducer.ProtoProducerMessage) []byte) element {
+	return element{id, length, func(b []byte, m *protoproducer.ProtoProducerMessage) []byte {
+		return appendAddr(b, get(m), length)
+	}}
+}
+
+// elements returns the information elements of a template.
+func elements(flow6, sampler6 bool) []element {
+	addrLength := uint16(4)
+	srcAddr, dstAddr, nextHop := uint16(netflow.IPFIX_FIELD_sourceIPv4Address), uint16(netflow.IPFIX_FIELD_destinationIPv4Address), uint16(netflow.IPFIX_FIELD_ipNextHopIPv4Address)
+	srcMask, dstMask := uint16(netflow.IPFIX_FIELD_sourceIPv4PrefixLength), uint16(netflow.IPFIX_FIELD_destinationIPv4PrefixLength)
+	icmp := uint16(netflow.IPFIX_FIELD_icmpTypeCodeIPv4)
+	if flow6 {
+		addrLength = 16
+		srcAddr, dstAddr, nextHop = netflow.IPFIX_FIELD_sourceIPv6Address, netflow.IPFIX_FIELD_destinationIPv6Address, netflow.IPFIX_FIELD_ipNextHopIPv6Address
+		srcMask, dstMask = netflow.IPFIX_FIELD_sourceIPv6PrefixLength, netflow.IPFIX_FIELD_destinationIPv6PrefixLength
+		icmp = netflow.IPFIX_FIELD_icmpTypeCodeIPv6
+	}
+	samplerAddr, samplerLength := uint16(netflow.IPFIX_FIELD_exporterIPv4Address), uint16(4)
+	if sampler6 {
+		samplerAddr, samplerLength = netflow.IPFIX_FIELD_exporterIPv6Address, 16
+	}
+
+	return []element{
+		uintElement(netflow.IPFIX_FIELD_octetDeltaCount, 8, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.Bytes }),
+		uintElement(netflow.IPFIX_FIELD_packetDeltaCount, 8, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.Packets }),
+		uintElement(netflow.IPFIX_FIELD_flowStartMilliseconds, 8, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.TimeFlowStartNs / 1e6 }),
+		uintElement(netflow.IPFIX_FIELD_flowEndMilliseconds, 8, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.TimeFlowEndNs / 1e6 }),
+		addrElement(srcAddr, addrLength, func(m *protoproducer.ProtoProducerMessage) []byte { return m.SrcAddr }),
+		addrElement(dstAddr, addrLength, func(m *protoproducer.ProtoProducerMessage) []byte { return m.DstAddr }),
+		addrElement(nextHop, addrLength, func(m *protoproducer.ProtoProducerMessage) []byte { return m.NextHop }),
+		uintElement(srcMask, 1, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.SrcNet) }),
+		uintElement(dstMask, 1, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.DstNet) }),
+		uintElement(netflow.IPFIX_FIELD_sourceTransportPort, 2, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.SrcPort) }),
+		uintElement(netflow.IPFIX_FIELD_destinationTransportPort, 2, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.DstPort) }),
+		uintElement(netflow.IPFIX_FIELD_protocolIdentifier, 1, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.Proto) }),
+		uintElement(netflow.IPFIX_FIELD_ipClassOfService, 1, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.IpTos) }),
+		uintElement(netflow.IPFIX_FIELD_tcpControlBits, 2, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.TcpFlags) }),
+		uintElement(icmp, 2, func(m *protoproducer.ProtoProducerMessage) uint64 {
+			return uint64(m.IcmpType&0xff)<<8 | uint64(m.IcmpCode&0xff)
+		}),
+		uintElement(netflow.IPFIX_FIELD_ingressInterface, 4, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.InIf) }),
+		uintElement(netflow.IPFIX_FIELD_egressInterface, 4, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.OutIf) }),
+		uintElement(netflow.IPFIX_FIELD_bgpSourceAsNumber, 4, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.SrcAs) }),
+		uintElement(netflow.IPFIX_FIELD_bgpDestinationAsNumber, 4, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.DstAs) }),
+		uintElement(netflow.IPFIX_FIELD_sourceMacAddress, 6, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.SrcMac }),
+		uintElement(netflow.IPFIX_FIELD_destinationMacAddress, 6, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.DstMac }),
+		uintElement(netflow.IPFIX_FIELD_vlanId, 2, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.VlanId) }),
+		uintElement(netflow.IPFIX_FIELD_ethernetType, 2, func(m *protoproducer.ProtoProducerMessage) uint64 { return uint64(m.Etype) }),
+		uintElement(netflow.IPFIX_FIELD_samplingInterval, 4, func(m *protoproducer.ProtoProducerMessage) uint64 { return m.SamplingRate }),
+		addrElement(samplerAddr, samplerLength, func(m *protoproducer.ProtoProducerMessage) []byte { return m.SamplerAddress }),
+	}
+}
+
+// templates holds the elements of each template, indexed by ID minus TemplateID.
+var templates [templateCount][]element
+
+func init() {
+	for i := range templates {
+		templates[i] = elements(i&templateFlow6 != 0, i&templateSamp6 != 0)
+	}
+}
+
+// Template returns the template record of a template ID.
+func Template(id uint16) (netflow.TemplateRecord, error) {
+	if id < TemplateID || id >= TemplateID+templateCount {
+		return netflow.TemplateRecord{}, fmt.Errorf("unknown template %d", id)
+	}
+	elems := templates[id-TemplateID]
+	record := netflow.TemplateRecord{
+		TemplateId: id,
+		FieldCount: uint16(len(elems)),
+		Fields:     make([]netflow.Field, len(elems)),
+	}
+	for i, e := range elems {
+		record.Fields[i] = netflow.Field{Type: e.id, Length: e.length}
+	}
+	return record, nil
+}
+
+// isIPv6 reports whether an address is IPv6, IPv4-mapped addresses are IPv4.
+func isIPv6(addr []byte) bool {
+	ip, ok := netip.AddrFromSlice(addr)
+	return ok && ip.Is6() && !ip.Is4In6()
+}
+
+// TemplateFor returns the template ID used to encode a message.
+func TemplateFor(m *protoproducer.ProtoProducerMessage) uint16 {
+	id := uint16(TemplateID)
+	if isIPv6(m.SrcAddr) || isIPv6(m.DstAddr) {
+		id |= templateFlow6
+	}
+	if isIPv6(m.SamplerAddress) {
+		id |= templateSamp6
+	}
+	return id
+}
+
+// Record returns the data record of a message using its template.
+func Record(m *protoproducer.ProtoProducerMessage) netflow.DataRecord {
+	elems := templates[TemplateFor(m)-TemplateID]
+	values := make([]netflow.DataField, len(elems))
+	b := make([]byte, 0, 128)
+	for i, e := range elems {
+		start := len(b)
+		b = e.value(b, m)
+		values[i] = netflow.DataField{Type: e.id, Value: b[start:len(b):len(b)]}
+	}
+	return netflow.DataRecord{Values: values}
+}
+
+// IpfixDriver formats each flow message as an IPFIX message holding one data record.
+// Templates are included in the first message and then periodically.
+type IpfixDriver struct {
+	domain           uint
+	templateInterval time.Duration
+
+	lock     sync.Mutex
+	sent     [templateCount]time.Time
+	sequence uint32
+}
+
+// Prepare registers flags for IPFIX formatting.
+func (d *IpfixDriver) Prepare() error {
+	flag.UintVar(&d.domain, "format.ipfix.domain", 0, "Observation domain ID of the IPFIX messages")
+	flag.DurationVar(&d.templateInterval, "format.ipfix.template-interval", time.Minute, "Interval between template retransmissions")
+	return nil
+}
+
+// Init validates the observation domain.
+func (d *IpfixDriver) Init() error {
+	if d.domain > 1<<32-1 {
+		return fmt.Errorf("ipfix format: invalid observation domain %d", d.domain)
+	}
+	return nil
+}
+
+// withTemplate reports whether the template must be sent along with the next record,
+// and increments the sequence number, which is the number of data records sent before.
+func (d *IpfixDriver) withTemplate(id uint16, now time.Time) (bool, uint32) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	sequence := d.sequence
+	d.sequence++
+	last := d.sent[id-TemplateID]
+	if !last.IsZero() && now.Sub(last) < d.templateInterval {
+		return false, sequence
+	}
+	d.sent[id-TemplateID] = now
+	return true, sequence
+}
+
+// Format encodes the message as an IPFIX message, preserving a Key when available.
+func (d *IpfixDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	m := dataIf.GetFlowMessage()
+
+	now := time.Now()
+	id := TemplateFor(m)
+	withTemplate, sequence := d.withTemplate(id, now)
+	packet := netflow.IPFIXPacket{
+		Version:             10,
+		ExportTime:          uint32(now.Unix()),
+		SequenceNumber:      sequence,
+		ObservationDomainId: uint32(d.domain),
+	}
+	if withTemplate {
+		template, err := Template(id)
+		if err != nil {
+			return key, nil, fmt.Errorf("ipfix format: %w", err)
+		}
+		packet.FlowSets = append(packet.FlowSets, netflow.TemplateFlowSet{
+			FlowSetHeader: netflow.FlowSetHeader{Id: templateSetID},
+			Records:       []netflow.TemplateRecord{template},
+		})
+	}
+	packet.FlowSets = append(packet.FlowSets, netflow.DataFlowSet{
+		FlowSetHeader: netflow.FlowSetHeader{Id: id},
+		Records:       []netflow.DataRecord{Record(m)},
+	})
+
+	b, err := packet.MarshalBinary()
+	if err != nil {
+		return key, nil, fmt.Errorf("ipfix format: %w", err)
+	}
+	return key, b, nil
+}
+
+func init() {
+	d := &IpfixDriver{}
+	format.RegisterFormatDriver("ipfix", d)
+}
@@ -0,0 +1,109 @@
+package ipfix
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+type testStore map[uint16]interface{}
+
+func (s testStore) AddTemplate(ctx netflow.FlowContext, version uint16, obsDomainId uint32, templateId uint16, template interface{}) (netflow.TemplateStatus, error) {
+	s[templateId] = template
+	return netflow.TemplateAdded, nil
+}
+
+func (s testStore) GetTemplate(ctx netflow.FlowContext, version uint16, obsDomainId uint32, templateId uint16) (interface{}, error) {
+	if template, ok := s[templateId]; ok {
+		return template, nil
+	}
+	return nil, netflow.ErrorTemplateNotFound
+}
+
+type testMessage struct {
+	m *protoproducer.ProtoProducerMessage
+}
+
+func (t testMessage) GetFlowMessage() *protoproducer.ProtoProducerMessage {
+	return t.m
+}
+
+func decode(t *testing.T, store testStore, b []byte) netflow.IPFIXPacket {
+	t.Helper()
+	var packet netflow.IPFIXPacket
+	if err := netflow.DecodeMessageVersion(bytes.NewBuffer(b), store, netflow.FlowContext{}, nil, &packet); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return packet
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	d := &IpfixDriver{domain: 42, templateInterval: time.Hour}
+	m := &protoproducer.ProtoProducerMessage{}
+	m.Bytes = 1500
+	m.Packets = 3
+	m.TimeFlowEndNs = 1700000000123456789
+	m.SrcAddr = []byte{192, 0, 2, 1}
+	m.DstAddr = []byte{198, 51, 100, 2}
+	m.SrcPort = 443
+	m.Proto = 6
+	m.SrcMac = 0x0a0b0c0d0e0f
+	m.SamplingRate = 1 << 40
+	m.SamplerAddress = []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	store := testStore{}
+	_, b, err := d.Format(testMessage{m})
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	packet := decode(t, store, b)
+	if packet.ObservationDomainId != 42 || packet.SequenceNumber != 0 || len(packet.FlowSets) != 2 {
+		t.Fatalf("unexpected packet %v", packet)
+	}
+	data, ok := packet.FlowSets[1].(netflow.DataFlowSet)
+	if !ok || data.Id != TemplateID+templateSamp6 || len(data.Records) != 1 {
+		t.Fatalf("unexpected data set %v", packet.FlowSets[1])
+	}
+	values := make(map[uint16]string)
+	for _, value := range data.Records[0].Values {
+		values[value.Type] = fmt.Sprintf("%x", value.Value)
+	}
+	for id, expected := range map[uint16]string{
+		netflow.IPFIX_FIELD_octetDeltaCount:        "00000000000005dc",
+		netflow.IPFIX_FIELD_flowEndMilliseconds:    "0000018bcfe5687b",
+		netflow.IPFIX_FIELD_sourceIPv4Address:      "c0000201",
+		netflow.IPFIX_FIELD_sourceTransportPort:    "01bb",
+		netflow.IPFIX_FIELD_protocolIdentifier:     "06",
+		netflow.IPFIX_FIELD_sourceMacAddress:       "0a0b0c0d0e0f",
+		netflow.IPFIX_FIELD_samplingInterval:       "ffffffff",
+		netflow.IPFIX_FIELD_exporterIPv6Address:    "20010db8000000000000000000000001",
+		netflow.IPFIX_FIELD_destinationIPv4Address: "c6336402",
+	} {
+		if values[id] != expected {
+			t.Fatalf("expected %s for field %d, got %s", expected, id, values[id])
+		}
+	}
+
+	// the template is not repeated, the IPv6 flow uses another template
+	m.SrcAddr = []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}
+	if _, b, err = d.Format(testMessage{m}); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if packet = decode(t, store, b); len(packet.FlowSets) != 2 || packet.SequenceNumber != 1 {
+		t.Fatalf("expected IPFIX message with a new template, got %v", packet)
+	}
+	if _, b, err = d.Format(testMessage{m}); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if packet = decode(t, store, b); len(packet.FlowSets) != 1 || packet.SequenceNumber != 2 {
+		t.Fatalf("expected IPFIX message without template, got %v", packet)
+	}
+	if data, ok = packet.FlowSets[0].(netflow.DataFlowSet); !ok || data.Id != TemplateID+templateFlow6+templateSamp6 {
+		t.Fatalf("unexpected data set %v", packet.FlowSets[0])
+	}
+}
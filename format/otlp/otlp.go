@@ -0,0 +1,92 @@
+// Package otlp implements OpenTelemetry (OTLP) logs output formatting.
+package otlp
+
+import (
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	otlpproto "github.com/tgragnato/goflow/utils/otlp"
+)
+
+// Scope is the instrumentation scope of the flow log records.
+var Scope = otlpproto.Scope{Name: "github.com/tgragnato/goflow"}
+
+// OtlpDriver formats flow messages as OTLP ResourceLogs holding a single log record.
+// The configured output fields are record attributes, the exporter is the resource.
+type OtlpDriver struct{}
+
+// Prepare performs any one-time setup for the driver.
+func (d *OtlpDriver) Prepare() error {
+	return nil
+}
+
+// Init finalizes runtime configuration for the driver.
+func (d *OtlpDriver) Init() error {
+	return nil
+}
+
+// ResourceAttributes returns the attributes describing the exporter of a flow.
+func ResourceAttributes(m *protoproducer.ProtoProducerMessage) []otlpproto.KeyValue {
+	attributes := []otlpproto.KeyValue{
+		{Key: "service.name", Value: "goflow"},
+		{Key: "flow.exporter.address", Value: protoproducer.RenderIP(m.SamplerAddress)},
+		{Key: "flow.exporter.type", Value: m.Type.String()},
+	}
+	if m.ObservationDomainId != 0 {
+		attributes = append(attributes, otlpproto.KeyValue{Key: "flow.exporter.observation_domain_id", Value: m.ObservationDomainId})
+	}
+	if m.SamplerHostname != "" {
+		attributes = append(attributes, otlpproto.KeyValue{Key: "flow.exporter.hostname", Value: m.SamplerHostname})
+	}
+	if m.SamplerSite != "" {
+		attributes = append(attributes, otlpproto.KeyValue{Key: "flow.exporter.site", Value: m.SamplerSite})
+	}
+	if m.SamplerTenant != "" {
+		attributes = append(attributes, otlpproto.KeyValue{Key: "flow.exporter.tenant", Value: m.SamplerTenant})
+	}
+	return attributes
+}
+
+// Format encodes the message as an OTLP ResourceLogs, preserving a Key when available.
+func (d *OtlpDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+		format.FieldsFormatter
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	m := dataIf.GetFlowMessage()
+
+	names, values := dataIf.FormatFields()
+	attributes := make([]otlpproto.KeyValue, 0, len(names))
+	for i, name := range names {
+		if values[i] == nil {
+			continue
+		}
+		attributes = append(attributes, otlpproto.KeyValue{Key: name, Value: values[i]})
+	}
+
+	timestamp := m.TimeFlowEndNs
+	if timestamp == 0 {
+		timestamp = m.TimeReceivedNs
+	}
+	record := otlpproto.MarshalLogRecord(&otlpproto.LogRecord{
+		TimeUnixNano:         timestamp,
+		ObservedTimeUnixNano: m.TimeReceivedNs,
+		SeverityNumber:       otlpproto.SeverityInfo,
+		SeverityText:         "INFO",
+		EventName:            "network.flow",
+		Attributes:           attributes,
+	})
+	resource := otlpproto.MarshalResource(ResourceAttributes(m))
+	return key, otlpproto.MarshalResourceLogs(resource, Scope, record), nil
+}
+
+func init() {
+	d := &OtlpDriver{}
+	format.RegisterFormatDriver("otlp", d)
+}
@@ -0,0 +1,191 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+	"testing"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testMessage struct {
+	m      *protoproducer.ProtoProducerMessage
+	names  []string
+	values []interface{}
+}
+
+func (t testMessage) GetFlowMessage() *protoproducer.ProtoProducerMessage {
+	return t.m
+}
+
+func (t testMessage) FormatFields() ([]string, []interface{}) {
+	return t.names, t.values
+}
+
+// field is a decoded protobuf field, fixed64 values being returned as varints.
+type field struct {
+	num    protowire.Number
+	varint uint64
+	bytes  []byte
+}
+
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("decode tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.varint, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatalf("decode field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// anyValue renders an AnyValue message as type:value.
+func anyValue(t *testing.T, b []byte) string {
+	t.Helper()
+	fields := decode(t, b)
+	if len(fields) != 1 {
+		t.Fatalf("expected a single value, got %d fields", len(fields))
+	}
+	f := fields[0]
+	switch f.num {
+	case 1:
+		return "string:" + string(f.bytes)
+	case 2:
+		return fmt.Sprintf("bool:%v", f.varint != 0)
+	case 3:
+		return fmt.Sprintf("int:%d", int64(f.varint))
+	case 4:
+		return fmt.Sprintf("double:%v", math.Float64frombits(f.varint))
+	case 5:
+		var items []string
+		for _, item := range decode(t, f.bytes) {
+			items = append(items, anyValue(t, item.bytes))
+		}
+		return "array:[" + strings.Join(items, " ") + "]"
+	case 7:
+		return fmt.Sprintf("bytes:%x", f.bytes)
+	}
+	t.Fatalf("unexpected value field %d", f.num)
+	return ""
+}
+
+// attributes renders the KeyValue messages of the field num as key=type:value.
+func attributes(t *testing.T, fields []field, num protowire.Number) []string {
+	t.Helper()
+	var kvs []string
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		var key, value string
+		for _, kv := range decode(t, f.bytes) {
+			if kv.num == 1 {
+				key = string(kv.bytes)
+			} else {
+				value = anyValue(t, kv.bytes)
+			}
+		}
+		kvs = append(kvs, key+"="+value)
+	}
+	return kvs
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	m := &protoproducer.ProtoProducerMessage{}
+	m.Type = flowpb.FlowMessage_IPFIX
+	m.TimeReceivedNs = 1714554002000000000
+	m.TimeFlowEndNs = 1714554001000000000
+	m.SamplerAddress = netip.MustParseAddr("192.0.2.254").AsSlice()
+	m.ObservationDomainId = 7
+	m.SamplerHostname = "router1"
+	m.SamplerTenant = "acme"
+	msg := testMessage{
+		m:      m,
+		names:  []string{"src_addr", "bytes", "as_path", "ratio", "valid", "missing", "payload"},
+		values: []interface{}{"192.0.2.1", uint64(1500), []interface{}{uint32(65000), uint32(65001)}, 0.5, true, nil, []byte{0xca, 0xfe}},
+	}
+
+	key, b, err := (&OtlpDriver{}).Format(msg)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if key != nil {
+		t.Fatalf("expected no key, got %x", key)
+	}
+	resourceLogs := decode(t, b)
+	if len(resourceLogs) != 2 || resourceLogs[0].num != 1 || resourceLogs[1].num != 2 {
+		t.Fatalf("expected a resource and scope logs, got %v", resourceLogs)
+	}
+
+	resource := strings.Join(attributes(t, decode(t, resourceLogs[0].bytes), 1), ",")
+	if expected := "service.name=string:goflow,flow.exporter.address=string:192.0.2.254,flow.exporter.type=string:IPFIX," +
+		"flow.exporter.observation_domain_id=int:7,flow.exporter.hostname=string:router1,flow.exporter.tenant=string:acme"; resource != expected {
+		t.Fatalf("expected resource %s, got %s", expected, resource)
+	}
+
+	scopeLogs := decode(t, resourceLogs[1].bytes)
+	if len(scopeLogs) != 2 || scopeLogs[0].num != 1 || scopeLogs[1].num != 2 {
+		t.Fatalf("expected a scope and a record, got %v", scopeLogs)
+	}
+	if scope := decode(t, scopeLogs[0].bytes); len(scope) != 1 || string(scope[0].bytes) != Scope.Name {
+		t.Fatalf("unexpected scope %v", scope)
+	}
+
+	record := decode(t, scopeLogs[1].bytes)
+	values := make(map[protowire.Number]string)
+	for _, f := range record {
+		if f.num != 6 {
+			values[f.num] = fmt.Sprintf("%d%s", f.varint, f.bytes)
+		}
+	}
+	for num, expected := range map[protowire.Number]string{
+		1:  "1714554001000000000", // time: end of the flow
+		2:  "9",                   // severity number
+		3:  "0INFO",               // severity text
+		11: "1714554002000000000", // observed time: reception
+		12: "0network.flow",       // event name
+	} {
+		if values[num] != expected {
+			t.Fatalf("expected %s in field %d, got %s", expected, num, values[num])
+		}
+	}
+	// nil values are omitted
+	recordAttributes := strings.Join(attributes(t, record, 6), ",")
+	if expected := "src_addr=string:192.0.2.1,bytes=int:1500,as_path=array:[int:65000 int:65001],ratio=double:0.5,valid=bool:true,payload=bytes:cafe"; recordAttributes != expected {
+		t.Fatalf("expected attributes %s, got %s", expected, recordAttributes)
+	}
+
+	// without the end of the flow, the time is the reception
+	m.TimeFlowEndNs = 0
+	if _, b, err = (&OtlpDriver{}).Format(msg); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	record = decode(t, decode(t, decode(t, b)[1].bytes)[1].bytes)
+	if record[0].num != 1 || record[0].varint != m.TimeReceivedNs {
+		t.Fatalf("expected the reception time, got %v", record[0])
+	}
+}
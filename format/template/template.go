@@ -0,0 +1,305 @@
+// Package template implements output formatting with a Go text/template.
+package template
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/tgragnato/goflow/format"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+// TemplateDriver formats flow messages with a user provided template.
+type TemplateDriver struct {
+	file     string
+	template *template.Template
+	fields   []string // fields referenced by the template
+}
+
+// Data is passed to the template.
+type Data struct {
+	// Fields holds the configured output fields (formatter.fields) by name,
+	// rendered with the configured renderers. Absent fields, and the fields of
+	// .Fields.name references which are not configured, are empty strings.
+	Fields map[string]interface{}
+	// Raw is the flow message, eg: {{ .Raw.Bytes }}.
+	Raw *protoproducer.ProtoProducerMessage
+}
+
+// Prepare registers flags for template formatting.
+func (d *TemplateDriver) Prepare() error {
+	flag.StringVar(&d.file, "format.template.file", "", "Go text/template file used to format messages")
+	return nil
+}
+
+// Init parses the template file.
+func (d *TemplateDriver) Init() error {
+	if d.file == "" {
+		return fmt.Errorf("template format: no template file")
+	}
+	content, err := os.ReadFile(d.file)
+	if err != nil {
+		return fmt.Errorf("template format: %w", err)
+	}
+	// the transport appends its own separator
+	tmpl, err := Parse(strings.TrimSuffix(string(content), "\n"))
+	if err != nil {
+		return fmt.Errorf("template format: %w", err)
+	}
+	d.template = tmpl
+	d.fields = referencedFields(tmpl)
+	return nil
+}
+
+// Parse parses a template with the helper functions.
+func Parse(text string) (*template.Template, error) {
+	tmpl, err := template.New("flow").Option("missingkey=zero").Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// referencedFields returns the names of the .Fields.name references of a template and its
+// associated templates, which would otherwise be rendered as "<no value>" when not configured.
+func referencedFields(tmpl *template.Template) []string {
+	var fields []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "Fields" {
+				fields = append(fields, n.Ident[1])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	return fields
+}
+
+// Funcs are the helper functions available in templates.
+var Funcs = template.FuncMap{
+	"humanBytes": HumanBytes,
+	"humanCount": HumanCount,
+	"ip":         IP,
+	"mask":       Mask,
+	"time":       Time,
+	"duration":   Duration,
+}
+
+func toUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case uint32:
+		return uint64(v), nil
+	case int:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case int32:
+		return uint64(v), nil
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse number: %w", err)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("unsupported number %T", value)
+}
+
+func human(value interface{}, base float64, units []string) (string, error) {
+	n, err := toUint64(value)
+	if err != nil {
+		return "", err
+	}
+	v := float64(n)
+	unit := 0
+	for v >= base && unit < len(units)-1 {
+		v /= base
+		unit++
+	}
+	if unit == 0 {
+		return strconv.FormatUint(n, 10) + units[0], nil
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + units[unit], nil
+}
+
+// HumanBytes formats a number of bytes with binary units, eg: 1.5 KiB.
+func HumanBytes(value interface{}) (string, error) {
+	return human(value, 1024, []string{" B", " KiB", " MiB", " GiB", " TiB", " PiB", " EiB"})
+}
+
+// HumanCount formats a count with decimal units, eg: 1.5k.
+func HumanCount(value interface{}) (string, error) {
+	return human(value, 1000, []string{"", "k", "M", "G", "T", "P", "E"})
+}
+
+func toAddr(value interface{}) (netip.Addr, error) {
+	switch v := value.(type) {
+	case []byte:
+		addr, ok := netip.AddrFromSlice(v)
+		if !ok {
+			return addr, fmt.Errorf("invalid address length %d", len(v))
+		}
+		return addr.Unmap(), nil
+	case string:
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return addr, fmt.Errorf("parse address: %w", err)
+		}
+		return addr, nil
+	}
+	return netip.Addr{}, fmt.Errorf("unsupported address %T", value)
+}
+
+// IP formats a raw or rendered address.
+func IP(value interface{}) (string, error) {
+	addr, err := toAddr(value)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// Mask returns the prefix of the given length containing an address, eg: mask 24 .Raw.SrcAddr.
+// IPv6 addresses use the same length.
+func Mask(bits int, value interface{}) (string, error) {
+	addr, err := toAddr(value)
+	if err != nil {
+		return "", err
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", fmt.Errorf("mask: %w", err)
+	}
+	return prefix.String(), nil
+}
+
+// Time formats a timestamp in nanoseconds with a Go layout, eg: time "15:04:05" .Raw.TimeFlowEndNs.
+// Layouts may also be the name of a time package constant (RFC3339, Kitchen...).
+func Time(layout string, value interface{}) (string, error) {
+	ns, err := toUint64(value)
+	if err != nil {
+		return "", err
+	}
+	if named, ok := layouts[layout]; ok {
+		layout = named
+	}
+	return time.Unix(0, int64(ns)).UTC().Format(layout), nil
+}
+
+var layouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"RFC822":      time.RFC822,
+	"RFC1123":     time.RFC1123,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// Duration formats the difference between two timestamps in nanoseconds,
+// eg: duration .Raw.TimeFlowStartNs .Raw.TimeFlowEndNs.
+func Duration(start, end interface{}) (string, error) {
+	s, err := toUint64(start)
+	if err != nil {
+		return "", err
+	}
+	e, err := toUint64(end)
+	if err != nil {
+		return "", err
+	}
+	return (time.Duration(int64(e) - int64(s))).String(), nil
+}
+
+// Format executes the template, preserving a Key when available.
+func (d *TemplateDriver) Format(data interface{}) ([]byte, []byte, error) {
+	var key []byte
+	if dataIf, ok := data.(interface{ Key() []byte }); ok {
+		key = dataIf.Key()
+	}
+	dataIf, ok := data.(interface {
+		GetFlowMessage() *protoproducer.ProtoProducerMessage
+		format.FieldsFormatter
+	})
+	if !ok {
+		return key, nil, format.ErrNoSerializer
+	}
+	names, values := dataIf.FormatFields()
+	fields := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if values[i] == nil { // absent fields are empty rather than "<no value>"
+			fields[name] = ""
+			continue
+		}
+		fields[name] = values[i]
+	}
+	for _, name := range d.fields {
+		if _, ok := fields[name]; !ok {
+			fields[name] = ""
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := d.template.Execute(&buf, &Data{Fields: fields, Raw: dataIf.GetFlowMessage()}); err != nil {
+		return key, nil, fmt.Errorf("template format: %w", err)
+	}
+	return key, buf.Bytes(), nil
+}
+
+func init() {
+	d := &TemplateDriver{}
+	format.RegisterFormatDriver("template", d)
+}
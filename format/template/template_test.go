@@ -0,0 +1,69 @@
+package template
+
+import (
+	"testing"
+
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+)
+
+type testMessage struct {
+	m      *protoproducer.ProtoProducerMessage
+	names  []string
+	values []interface{}
+}
+
+func (t testMessage) GetFlowMessage() *protoproducer.ProtoProducerMessage {
+	return t.m
+}
+
+func (t testMessage) FormatFields() ([]string, []interface{}) {
+	return t.names, t.values
+}
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+	tmpl, err := Parse(`{{ .Fields.src_addr }} -> {{ mask 24 .Raw.DstAddr }} {{ .Fields.proto }} ` +
+		`{{ humanBytes .Raw.Bytes }} {{ humanCount .Raw.Packets }} ` +
+		`{{ time "TimeOnly" .Raw.TimeFlowEndNs }} {{ duration .Raw.TimeFlowStartNs .Raw.TimeFlowEndNs }}{{ .Fields.missing }}` +
+		`{{ if .Fields.absent }}absent{{ end }}{{ .Fields.dst_port }}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var m protoproducer.ProtoProducerMessage
+	m.DstAddr = []byte{192, 0, 2, 10}
+	m.Bytes = 1536
+	m.Packets = 2500
+	m.TimeFlowStartNs = 1_700_000_000_000_000_000
+	m.TimeFlowEndNs = 1_700_000_001_500_000_000
+
+	d := &TemplateDriver{template: tmpl, fields: referencedFields(tmpl)}
+	// fields which are not configured or absent are empty strings
+	_, b, err := d.Format(testMessage{
+		m:      &m,
+		names:  []string{"src_addr", "proto", "dst_port"},
+		values: []interface{}{"198.51.100.1", "TCP", nil},
+	})
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	expected := "198.51.100.1 -> 192.0.2.0/24 TCP 1.5 KiB 2.5k 22:13:21 1.5s"
+	if string(b) != expected {
+		t.Fatalf("expected %q, got %q", expected, b)
+	}
+}
+
+func TestHelpersErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := HumanBytes("abc"); err == nil {
+		t.Fatal("expected error for invalid number")
+	}
+	if _, err := Mask(33, []byte{192, 0, 2, 1}); err == nil {
+		t.Fatal("expected error for invalid prefix length")
+	}
+	if _, err := IP([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+	if s, _ := HumanBytes(uint32(512)); s != "512 B" {
+		t.Fatalf("expected 512 B, got %s", s)
+	}
+}
@@ -12,16 +12,42 @@ import (
 	"github.com/tgragnato/goflow/geoip"
 	"github.com/tgragnato/goflow/pkg/goflow2/app"
 	"github.com/tgragnato/goflow/pkg/goflow2/config"
+	"github.com/tgragnato/goflow/pkg/goflow2/convert"
 	"github.com/tgragnato/goflow/sampler"
 
+	_ "github.com/tgragnato/goflow/format/avro"
 	_ "github.com/tgragnato/goflow/format/binary"
+	_ "github.com/tgragnato/goflow/format/csv"
+	_ "github.com/tgragnato/goflow/format/ecs"
+	_ "github.com/tgragnato/goflow/format/influx"
+	_ "github.com/tgragnato/goflow/format/ipfix"
 	_ "github.com/tgragnato/goflow/format/json"
+	_ "github.com/tgragnato/goflow/format/otlp"
+	_ "github.com/tgragnato/goflow/format/template"
 	_ "github.com/tgragnato/goflow/format/text"
+	_ "github.com/tgragnato/goflow/transport/clickhouse"
+	_ "github.com/tgragnato/goflow/transport/elasticsearch"
 	_ "github.com/tgragnato/goflow/transport/file"
+	_ "github.com/tgragnato/goflow/transport/grpc"
+	_ "github.com/tgragnato/goflow/transport/http"
+	_ "github.com/tgragnato/goflow/transport/influx"
+	_ "github.com/tgragnato/goflow/transport/ipfix"
+	_ "github.com/tgragnato/goflow/transport/mqtt"
+	_ "github.com/tgragnato/goflow/transport/nats"
+	_ "github.com/tgragnato/goflow/transport/otlp"
+	_ "github.com/tgragnato/goflow/transport/redis"
+	_ "github.com/tgragnato/goflow/transport/s3"
 	_ "github.com/tgragnato/goflow/transport/syslog"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		if err := convert.Run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	cfg := config.BindFlags(flag.CommandLine)
 	flag.Parse()
 
@@ -174,6 +174,38 @@ var (
 			Namespace: NAMESPACE},
 		[]string{"router", "version", "obs_domain_id"},
 	)
+	// ApplicationEntries records currently live application name entries.
+	ApplicationEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "flow_application_entries",
+			Help:      "Current application name entries.",
+			Namespace: NAMESPACE},
+		[]string{"router", "version", "obs_domain_id"},
+	)
+	// ApplicationUpdatedTimestamp records when an application name was last set or updated.
+	ApplicationUpdatedTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "flow_application_updated_timestamp_seconds",
+			Help:      "Unix timestamp when an application name was last set or updated.",
+			Namespace: NAMESPACE},
+		[]string{"router", "version", "obs_domain_id"},
+	)
+	// NetFlowClockSkew records the difference between the exporter's export time and the reception time.
+	NetFlowClockSkew = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "flow_process_nf_clock_skew_seconds",
+			Help:      "Exporter clock minus collector reception time.",
+			Namespace: NAMESPACE},
+		[]string{"router", "version"},
+	)
+	// NetFlowUptimeWraps counts detected NetFlow v9 system uptime wraparounds.
+	NetFlowUptimeWraps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "flow_process_nf_uptime_wraps_total",
+			Help:      "NetFlow v9 system uptime wraparounds detected.",
+			Namespace: NAMESPACE},
+		[]string{"router", "source_id"},
+	)
 	// SFlowStats counts processed sFlow packets.
 	SFlowStats = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -198,6 +230,22 @@ var (
 			Namespace: NAMESPACE},
 		[]string{"router", "agent", "version", "type"}, // data-template, data, opts...
 	)
+	// TransportRequests counts the requests of batching transports by result.
+	TransportRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "transport_requests_total",
+			Help:      "Transport requests by result.",
+			Namespace: NAMESPACE},
+		[]string{"transport", "result"}, // success, retry, failure
+	)
+	// TransportMessages counts the messages of batching transports by result.
+	TransportMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "transport_messages_total",
+			Help:      "Transport messages by result.",
+			Namespace: NAMESPACE},
+		[]string{"transport", "result"}, // success, failure
+	)
 )
 
 func init() {
@@ -216,6 +264,8 @@ func init() {
 	prometheus.MustRegister(NetFlowSetRecordsStatsSum)
 	prometheus.MustRegister(NetFlowSetStatsSum)
 	prometheus.MustRegister(NetFlowTimeStatsSum)
+	prometheus.MustRegister(NetFlowClockSkew)
+	prometheus.MustRegister(NetFlowUptimeWraps)
 	prometheus.MustRegister(NetFlowTemplatesStats)
 	prometheus.MustRegister(NetFlowTemplateAddedTimestamp)
 	prometheus.MustRegister(NetFlowTemplateUpdatedTimestamp)
@@ -224,8 +274,13 @@ func init() {
 	prometheus.MustRegister(SamplingRateEntries)
 	prometheus.MustRegister(SamplingRateUpdatedTimestamp)
 	prometheus.MustRegister(SamplingRateAccessedTimestamp)
+	prometheus.MustRegister(ApplicationEntries)
+	prometheus.MustRegister(ApplicationUpdatedTimestamp)
 
 	prometheus.MustRegister(SFlowStats)
 	prometheus.MustRegister(SFlowSampleStatsSum)
 	prometheus.MustRegister(SFlowSampleRecordsStatsSum)
+
+	prometheus.MustRegister(TransportRequests)
+	prometheus.MustRegister(TransportMessages)
 }
@@ -3,11 +3,15 @@ package metrics
 import (
 	"fmt"
 	"net/netip"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tgragnato/goflow/decoders/netflow"
 	"github.com/tgragnato/goflow/decoders/netflowlegacy"
 	"github.com/tgragnato/goflow/decoders/sflow"
+	"github.com/tgragnato/goflow/pkg/flowstore"
 	"github.com/tgragnato/goflow/producer"
 	protoproducer "github.com/tgragnato/goflow/producer/proto"
 )
@@ -15,6 +19,35 @@ import (
 // PromProducerWrapper wraps a producer to emit Prometheus metrics.
 type PromProducerWrapper struct {
 	wrapped producer.ProducerInterface
+
+	uptimesLock sync.Mutex // compare and set of the uptimes
+	uptimes     *flowstore.Store[uptimeKey, uint32]
+}
+
+type uptimeKey struct {
+	router   string
+	sourceId uint32
+}
+
+// uptimeWrapWindow bounds how close to the 32-bit limit (and to zero after)
+// the uptime must be for a decrease to count as a wrap rather than a reboot.
+const uptimeWrapWindow = 24 * 3600 * 1000
+
+// The uptimes of the exporters which stopped sending expire, and their number is bounded.
+const (
+	uptimeTTL          = time.Hour
+	uptimeMaxExporters = 65536
+)
+
+// observeUptime detects NetFlow v9 uptime wraparounds per exporter.
+func (p *PromProducerWrapper) observeUptime(router string, sourceId uint32, uptime uint32) bool {
+	key := uptimeKey{router: router, sourceId: sourceId}
+	p.uptimesLock.Lock()
+	defer p.uptimesLock.Unlock()
+	var previous uint32
+	ok := p.uptimes.Get(key, &previous)
+	_, _ = p.uptimes.Set(key, uptime)
+	return ok && uptime < previous && previous > ^uint32(0)-uptimeWrapWindow && uptime < uptimeWrapWindow
 }
 
 // Produce forwards to the wrapped producer and updates metrics.
@@ -104,6 +137,21 @@ func (p *PromProducerWrapper) Produce(msg interface{}, args *producer.ProduceArg
 		nfvariant = true
 		versionStr = "9"
 
+		NetFlowClockSkew.With(
+			prometheus.Labels{
+				"router":  key,
+				"version": "9",
+			}).
+			Set(float64(int64(packet.UnixSeconds)*1e9-args.TimeReceived.UnixNano()) / 1e9)
+		if p.observeUptime(key, packet.SourceId, packet.SystemUptime) {
+			NetFlowUptimeWraps.With(
+				prometheus.Labels{
+					"router":    key,
+					"source_id": strconv.Itoa(int(packet.SourceId)),
+				}).
+				Inc()
+		}
+
 	case *netflow.IPFIXPacket:
 		NetFlowStats.With(
 			prometheus.Labels{
@@ -114,6 +162,13 @@ func (p *PromProducerWrapper) Produce(msg interface{}, args *producer.ProduceArg
 		recordCommonNetFlowMetrics(10, key, packet.FlowSets)
 		nfvariant = true
 		versionStr = "10"
+
+		NetFlowClockSkew.With(
+			prometheus.Labels{
+				"router":  key,
+				"version": "10",
+			}).
+			Set(float64(int64(packet.ExportTime)*1e9-args.TimeReceived.UnixNano()) / 1e9)
 	}
 
 	if nfvariant {
@@ -136,8 +191,9 @@ func (p *PromProducerWrapper) Produce(msg interface{}, args *producer.ProduceArg
 	return flowMessageSet, nil
 }
 
-// Close forwards Close to the wrapped producer.
+// Close forwards Close to the wrapped producer and stops the expiry of the uptimes.
 func (p *PromProducerWrapper) Close() {
+	p.uptimes.Stop()
 	p.wrapped.Close()
 }
 
@@ -148,8 +204,15 @@ func (p *PromProducerWrapper) Commit(flowMessageSet []producer.ProducerMessage)
 
 // WrapPromProducer wraps a producer with metrics reporting.
 func WrapPromProducer(wrapped producer.ProducerInterface) producer.ProducerInterface {
+	uptimes := flowstore.NewStore(
+		flowstore.WithDefaultTTL[uptimeKey, uint32](uptimeTTL),
+		flowstore.WithRefreshTTLOnWrite[uptimeKey, uint32](),
+		flowstore.WithMaxSize[uptimeKey, uint32](uptimeMaxExporters),
+	)
+	uptimes.Start(time.Minute)
 	return &PromProducerWrapper{
 		wrapped: wrapped,
+		uptimes: uptimes,
 	}
 }
 
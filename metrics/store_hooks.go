@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 	"github.com/tgragnato/goflow/utils/store/templates"
 )
@@ -61,6 +62,23 @@ func SamplingRateStoreHooks() samplingrate.Hooks {
 	}
 }
 
+// ApplicationStoreHooks returns Prometheus hooks for application store lifecycle events.
+// Entries are aggregated per observation domain to keep label cardinality bounded.
+func ApplicationStoreHooks() applications.Hooks {
+	return applications.Hooks{
+		OnSet: func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string, existed bool) {
+			labels := samplingRateLabels(router, version, obsDomainId)
+			if !existed {
+				ApplicationEntries.With(labels).Inc()
+			}
+			ApplicationUpdatedTimestamp.With(labels).Set(float64(time.Now().Unix()))
+		},
+		OnRemove: func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string) {
+			ApplicationEntries.With(samplingRateLabels(router, version, obsDomainId)).Dec()
+		},
+	}
+}
+
 func samplingRateLabels(router string, version uint16, obsDomainId uint32) map[string]string {
 	return map[string]string{
 		"router":        router,
@@ -240,9 +240,29 @@ type FlowMessage struct {
 	DstAsn          string `protobuf:"bytes,1004,opt,name=dst_asn,json=dstAsn,proto3" json:"dst_asn,omitempty"`
 	SamplerHostname string `protobuf:"bytes,1005,opt,name=sampler_hostname,json=samplerHostname,proto3" json:"sampler_hostname,omitempty"`
 	// AS path (exploded)
-	AsPathString  string `protobuf:"bytes,1006,opt,name=as_path_string,json=asPathString,proto3" json:"as_path_string,omitempty"`
-	AsPathBeg     uint32 `protobuf:"varint,1007,opt,name=as_path_beg,json=asPathBeg,proto3" json:"as_path_beg,omitempty"`
-	AsPathEnd     uint32 `protobuf:"varint,1008,opt,name=as_path_end,json=asPathEnd,proto3" json:"as_path_end,omitempty"`
+	AsPathString string `protobuf:"bytes,1006,opt,name=as_path_string,json=asPathString,proto3" json:"as_path_string,omitempty"`
+	AsPathBeg    uint32 `protobuf:"varint,1007,opt,name=as_path_beg,json=asPathBeg,proto3" json:"as_path_beg,omitempty"`
+	AsPathEnd    uint32 `protobuf:"varint,1008,opt,name=as_path_end,json=asPathEnd,proto3" json:"as_path_end,omitempty"`
+	// Application (NBAR/RFC 6759), name resolved from options data
+	ApplicationId   uint64 `protobuf:"varint,1009,opt,name=application_id,json=applicationId,proto3" json:"application_id,omitempty"`
+	ApplicationName string `protobuf:"bytes,1010,opt,name=application_name,json=applicationName,proto3" json:"application_name,omitempty"`
+	// Firewall events (Cisco ASA NSEL)
+	FwEvent         uint32   `protobuf:"varint,1011,opt,name=fw_event,json=fwEvent,proto3" json:"fw_event,omitempty"`
+	FwExtEvent      uint32   `protobuf:"varint,1012,opt,name=fw_ext_event,json=fwExtEvent,proto3" json:"fw_ext_event,omitempty"`
+	XlateSrcAddr    []byte   `protobuf:"bytes,1013,opt,name=xlate_src_addr,json=xlateSrcAddr,proto3" json:"xlate_src_addr,omitempty"`
+	XlateDstAddr    []byte   `protobuf:"bytes,1014,opt,name=xlate_dst_addr,json=xlateDstAddr,proto3" json:"xlate_dst_addr,omitempty"`
+	XlateSrcPort    uint32   `protobuf:"varint,1015,opt,name=xlate_src_port,json=xlateSrcPort,proto3" json:"xlate_src_port,omitempty"`
+	XlateDstPort    uint32   `protobuf:"varint,1016,opt,name=xlate_dst_port,json=xlateDstPort,proto3" json:"xlate_dst_port,omitempty"`
+	IngressAclId    []uint32 `protobuf:"varint,1017,rep,packed,name=ingress_acl_id,json=ingressAclId,proto3" json:"ingress_acl_id,omitempty"`
+	EgressAclId     []uint32 `protobuf:"varint,1018,rep,packed,name=egress_acl_id,json=egressAclId,proto3" json:"egress_acl_id,omitempty"`
+	InitiatorOctets uint64   `protobuf:"varint,1019,opt,name=initiator_octets,json=initiatorOctets,proto3" json:"initiator_octets,omitempty"`
+	ResponderOctets uint64   `protobuf:"varint,1020,opt,name=responder_octets,json=responderOctets,proto3" json:"responder_octets,omitempty"`
+	Username        string   `protobuf:"bytes,1021,opt,name=username,proto3" json:"username,omitempty"`
+	// Set when the message was derived from RFC 5103 reverse information elements
+	BiflowReverse bool `protobuf:"varint,1022,opt,name=biflow_reverse,json=biflowReverse,proto3" json:"biflow_reverse,omitempty"`
+	// Exporter labels (from the exporters overrides file)
+	SamplerSite   string `protobuf:"bytes,1023,opt,name=sampler_site,json=samplerSite,proto3" json:"sampler_site,omitempty"`
+	SamplerTenant string `protobuf:"bytes,1024,opt,name=sampler_tenant,json=samplerTenant,proto3" json:"sampler_tenant,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -690,11 +710,123 @@ func (x *FlowMessage) GetAsPathEnd() uint32 {
 	return 0
 }
 
+func (x *FlowMessage) GetApplicationId() uint64 {
+	if x != nil {
+		return x.ApplicationId
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetApplicationName() string {
+	if x != nil {
+		return x.ApplicationName
+	}
+	return ""
+}
+
+func (x *FlowMessage) GetFwEvent() uint32 {
+	if x != nil {
+		return x.FwEvent
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetFwExtEvent() uint32 {
+	if x != nil {
+		return x.FwExtEvent
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetXlateSrcAddr() []byte {
+	if x != nil {
+		return x.XlateSrcAddr
+	}
+	return nil
+}
+
+func (x *FlowMessage) GetXlateDstAddr() []byte {
+	if x != nil {
+		return x.XlateDstAddr
+	}
+	return nil
+}
+
+func (x *FlowMessage) GetXlateSrcPort() uint32 {
+	if x != nil {
+		return x.XlateSrcPort
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetXlateDstPort() uint32 {
+	if x != nil {
+		return x.XlateDstPort
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetIngressAclId() []uint32 {
+	if x != nil {
+		return x.IngressAclId
+	}
+	return nil
+}
+
+func (x *FlowMessage) GetEgressAclId() []uint32 {
+	if x != nil {
+		return x.EgressAclId
+	}
+	return nil
+}
+
+func (x *FlowMessage) GetInitiatorOctets() uint64 {
+	if x != nil {
+		return x.InitiatorOctets
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetResponderOctets() uint64 {
+	if x != nil {
+		return x.ResponderOctets
+	}
+	return 0
+}
+
+func (x *FlowMessage) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *FlowMessage) GetBiflowReverse() bool {
+	if x != nil {
+		return x.BiflowReverse
+	}
+	return false
+}
+
+func (x *FlowMessage) GetSamplerSite() string {
+	if x != nil {
+		return x.SamplerSite
+	}
+	return ""
+}
+
+func (x *FlowMessage) GetSamplerTenant() string {
+	if x != nil {
+		return x.SamplerTenant
+	}
+	return ""
+}
+
 var File_pb_flow_proto protoreflect.FileDescriptor
 
 const file_pb_flow_proto_rawDesc = "" +
 	"\n" +
-	"\rpb/flow.proto\x12\x06flowpb\"\xd6\x11\n" +
+	"\rpb/flow.proto\x12\x06flowpb\"\xba\x16\n" +
 	"\vFlowMessage\x120\n" +
 	"\x04type\x18\x01 \x01(\x0e2\x1c.flowpb.FlowMessage.FlowTypeR\x04type\x12(\n" +
 	"\x10time_received_ns\x18n \x01(\x04R\x0etimeReceivedNs\x12!\n" +
@@ -762,7 +894,24 @@ const file_pb_flow_proto_rawDesc = "" +
 	"\x10sampler_hostname\x18\xed\a \x01(\tR\x0fsamplerHostname\x12%\n" +
 	"\x0eas_path_string\x18\xee\a \x01(\tR\fasPathString\x12\x1f\n" +
 	"\vas_path_beg\x18\xef\a \x01(\rR\tasPathBeg\x12\x1f\n" +
-	"\vas_path_end\x18\xf0\a \x01(\rR\tasPathEnd\"S\n" +
+	"\vas_path_end\x18\xf0\a \x01(\rR\tasPathEnd\x12&\n" +
+	"\x0eapplication_id\x18\xf1\a \x01(\x04R\rapplicationId\x12*\n" +
+	"\x10application_name\x18\xf2\a \x01(\tR\x0fapplicationName\x12\x1a\n" +
+	"\bfw_event\x18\xf3\a \x01(\rR\afwEvent\x12!\n" +
+	"\ffw_ext_event\x18\xf4\a \x01(\rR\n" +
+	"fwExtEvent\x12%\n" +
+	"\x0exlate_src_addr\x18\xf5\a \x01(\fR\fxlateSrcAddr\x12%\n" +
+	"\x0exlate_dst_addr\x18\xf6\a \x01(\fR\fxlateDstAddr\x12%\n" +
+	"\x0exlate_src_port\x18\xf7\a \x01(\rR\fxlateSrcPort\x12%\n" +
+	"\x0exlate_dst_port\x18\xf8\a \x01(\rR\fxlateDstPort\x12%\n" +
+	"\x0eingress_acl_id\x18\xf9\a \x03(\rR\fingressAclId\x12#\n" +
+	"\regress_acl_id\x18\xfa\a \x03(\rR\vegressAclId\x12*\n" +
+	"\x10initiator_octets\x18\xfb\a \x01(\x04R\x0finitiatorOctets\x12*\n" +
+	"\x10responder_octets\x18\xfc\a \x01(\x04R\x0fresponderOctets\x12\x1b\n" +
+	"\busername\x18\xfd\a \x01(\tR\busername\x12&\n" +
+	"\x0ebiflow_reverse\x18\xfe\a \x01(\bR\rbiflowReverse\x12\"\n" +
+	"\fsampler_site\x18\xff\a \x01(\tR\vsamplerSite\x12&\n" +
+	"\x0esampler_tenant\x18\x80\b \x01(\tR\rsamplerTenant\"S\n" +
 	"\bFlowType\x12\x0f\n" +
 	"\vFLOWUNKNOWN\x10\x00\x12\v\n" +
 	"\aSFLOW_5\x10\x01\x12\x0e\n" +
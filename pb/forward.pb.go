@@ -0,0 +1,187 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: pb/forward.proto
+
+package flowpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FlowBatch struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Sequence of the batch in the stream
+	Sequence      uint64         `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Flows         []*FlowMessage `protobuf:"bytes,2,rep,name=flows,proto3" json:"flows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlowBatch) Reset() {
+	*x = FlowBatch{}
+	mi := &file_pb_forward_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowBatch) ProtoMessage() {}
+
+func (x *FlowBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_forward_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowBatch.ProtoReflect.Descriptor instead.
+func (*FlowBatch) Descriptor() ([]byte, []int) {
+	return file_pb_forward_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FlowBatch) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *FlowBatch) GetFlows() []*FlowMessage {
+	if x != nil {
+		return x.Flows
+	}
+	return nil
+}
+
+type FlowAck struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Sequence of the processed batch
+	Sequence      uint64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlowAck) Reset() {
+	*x = FlowAck{}
+	mi := &file_pb_forward_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowAck) ProtoMessage() {}
+
+func (x *FlowAck) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_forward_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowAck.ProtoReflect.Descriptor instead.
+func (*FlowAck) Descriptor() ([]byte, []int) {
+	return file_pb_forward_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FlowAck) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+var File_pb_forward_proto protoreflect.FileDescriptor
+
+const file_pb_forward_proto_rawDesc = "" +
+	"\n" +
+	"\x10pb/forward.proto\x12\x06flowpb\x1a\rpb/flow.proto\"R\n" +
+	"\tFlowBatch\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12)\n" +
+	"\x05flows\x18\x02 \x03(\v2\x13.flowpb.FlowMessageR\x05flows\"%\n" +
+	"\aFlowAck\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence2>\n" +
+	"\tForwarder\x121\n" +
+	"\aForward\x12\x11.flowpb.FlowBatch\x1a\x0f.flowpb.FlowAck(\x010\x01B'Z%github.com/tgragnato/goflow/pb;flowpbb\x06proto3"
+
+var (
+	file_pb_forward_proto_rawDescOnce sync.Once
+	file_pb_forward_proto_rawDescData []byte
+)
+
+func file_pb_forward_proto_rawDescGZIP() []byte {
+	file_pb_forward_proto_rawDescOnce.Do(func() {
+		file_pb_forward_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pb_forward_proto_rawDesc), len(file_pb_forward_proto_rawDesc)))
+	})
+	return file_pb_forward_proto_rawDescData
+}
+
+var file_pb_forward_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pb_forward_proto_goTypes = []any{
+	(*FlowBatch)(nil),   // 0: flowpb.FlowBatch
+	(*FlowAck)(nil),     // 1: flowpb.FlowAck
+	(*FlowMessage)(nil), // 2: flowpb.FlowMessage
+}
+var file_pb_forward_proto_depIdxs = []int32{
+	2, // 0: flowpb.FlowBatch.flows:type_name -> flowpb.FlowMessage
+	0, // 1: flowpb.Forwarder.Forward:input_type -> flowpb.FlowBatch
+	1, // 2: flowpb.Forwarder.Forward:output_type -> flowpb.FlowAck
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_pb_forward_proto_init() }
+func file_pb_forward_proto_init() {
+	if File_pb_forward_proto != nil {
+		return
+	}
+	file_pb_flow_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pb_forward_proto_rawDesc), len(file_pb_forward_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pb_forward_proto_goTypes,
+		DependencyIndexes: file_pb_forward_proto_depIdxs,
+		MessageInfos:      file_pb_forward_proto_msgTypes,
+	}.Build()
+	File_pb_forward_proto = out.File
+	file_pb_forward_proto_goTypes = nil
+	file_pb_forward_proto_depIdxs = nil
+}
@@ -0,0 +1,10 @@
+package flowpb
+
+import (
+	_ "embed"
+)
+
+// Schema is the protobuf definition of FlowMessage, used to register it with a schema registry.
+//
+//go:embed flow.proto
+var Schema string
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/tgragnato/goflow/format"
 	"github.com/tgragnato/goflow/metrics"
 	"github.com/tgragnato/goflow/pkg/goflow2/builder"
 	"github.com/tgragnato/goflow/pkg/goflow2/collector"
@@ -16,7 +20,10 @@ import (
 	"github.com/tgragnato/goflow/pkg/goflow2/httpserver"
 	"github.com/tgragnato/goflow/pkg/goflow2/listen"
 	"github.com/tgragnato/goflow/pkg/goflow2/logging"
+	"github.com/tgragnato/goflow/transport"
 	"github.com/tgragnato/goflow/utils/debug"
+	"github.com/tgragnato/goflow/utils/exporters"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/persistence"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 	"github.com/tgragnato/goflow/utils/store/templates"
@@ -33,6 +40,8 @@ type App struct {
 	server      *http.Server
 	serverErr   chan error
 	collecting  atomic.Bool
+	exporters   *exporters.Overrides
+	reloadCh    chan os.Signal
 }
 
 // New constructs a new App from config.
@@ -51,6 +60,22 @@ func New(cfg *config.Config) (*App, error) {
 	if err != nil {
 		return nil, fmt.Errorf("app: build transport: %w", err)
 	}
+	// positional formats let the transport write their header at the start of each output
+	if f, ok := formatter.(*format.Format); ok {
+		if headerFormatter, ok := f.FormatDriver.(format.HeaderFormatter); ok {
+			if headerWriter, ok := transporter.TransportDriver.(transport.HeaderWriter); ok {
+				headerWriter.SetHeader(headerFormatter.Header)
+				headerFormatter.DelegateHeader()
+			}
+		}
+	}
+	if fieldsWriter, ok := transporter.TransportDriver.(transport.FieldsWriter); ok {
+		fields, err := builder.BuildFields(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("app: build fields: %w", err)
+		}
+		fieldsWriter.SetFields(fields)
+	}
 
 	persist := persistence.New(persistence.Config{
 		Path:     cfg.StoreJSONPath,
@@ -76,7 +101,25 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("app: init template persistence: %w", err)
 	}
 
-	flowProducer, err := builder.BuildProducer(cfg, samplingStore)
+	applicationStore, err := persist.NewApplicationStore(
+		applications.WithTTL(cfg.ApplicationsTTL),
+		applications.WithExtendOnAccess(cfg.ApplicationsExtendOnAccess),
+		applications.WithSweepInterval(cfg.ApplicationsSweepInterval),
+		applications.WithHooks(metrics.ApplicationStoreHooks()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app: init application persistence: %w", err)
+	}
+
+	var exporterOverrides *exporters.Overrides
+	if cfg.ExportersFile != "" {
+		exporterOverrides, err = exporters.LoadFile(cfg.ExportersFile)
+		if err != nil {
+			return nil, fmt.Errorf("app: load exporters: %w", err)
+		}
+	}
+
+	flowProducer, err := builder.BuildProducer(cfg, samplingStore, applicationStore, exporterOverrides)
 	if err != nil {
 		return nil, fmt.Errorf("app: build producer: %w", err)
 	}
@@ -111,6 +154,7 @@ func New(cfg *config.Config) (*App, error) {
 		transport:   transporter,
 		producer:    flowProducer,
 		serverErr:   make(chan error, 1),
+		exporters:   exporterOverrides,
 	}
 
 	if cfg.Addr != "" {
@@ -145,6 +189,20 @@ func (a *App) Start() error {
 	}
 	a.collecting.Store(true)
 
+	if a.exporters != nil {
+		a.reloadCh = make(chan os.Signal, 1)
+		signal.Notify(a.reloadCh, syscall.SIGHUP)
+		go func(reloadCh chan os.Signal) {
+			for range reloadCh {
+				if err := a.exporters.Reload(); err != nil {
+					a.logger.Error("error reloading exporters", slog.String("error", err.Error()))
+					continue
+				}
+				a.logger.Info("exporters reloaded", slog.String("file", a.cfg.ExportersFile))
+			}
+		}(a.reloadCh)
+	}
+
 	if a.server == nil {
 		return nil
 	}
@@ -198,6 +256,11 @@ func (a *App) Wait() <-chan error {
 func (a *App) Shutdown(ctx context.Context) {
 	a.collecting.Store(false)
 
+	if a.reloadCh != nil {
+		signal.Stop(a.reloadCh)
+		close(a.reloadCh)
+		a.reloadCh = nil
+	}
 	a.collector.Stop()
 	a.producer.Close()
 	a.persistence.Close()
@@ -10,6 +10,8 @@ import (
 	protoproducer "github.com/tgragnato/goflow/producer/proto"
 	rawproducer "github.com/tgragnato/goflow/producer/raw"
 	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/utils/exporters"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 )
 
@@ -31,29 +33,63 @@ func BuildTransport(name string) (*transport.Transport, error) {
 	return t, nil
 }
 
+// buildMapping loads and compiles the mapping file, or the default mapping if none is set.
+func buildMapping(cfg *config.Config) (protoproducer.ProtoProducerConfig, error) {
+	var cfgProducer *protoproducer.ProducerConfig
+	if cfg.MappingFile != "" {
+		f, err := os.Open(cfg.MappingFile)
+		if err != nil {
+			return nil, fmt.Errorf("load mapping %s: open: %w", cfg.MappingFile, err)
+		}
+		cfgProducer, err = config.LoadMapping(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("load mapping %s: decode: %w", cfg.MappingFile, err)
+		}
+	}
+
+	cfgm, err := cfgProducer.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("compile mapping: %w", err)
+	}
+	return cfgm, nil
+}
+
+// BuildFields returns the output fields of the mapping, renamed, or nil if the producer does not use it.
+func BuildFields(cfg *config.Config) ([]transport.Field, error) {
+	if cfg.Produce != "sample" {
+		return nil, nil
+	}
+	cfgm, err := buildMapping(cfg)
+	if err != nil {
+		return nil, err
+	}
+	formatter := cfgm.GetFormatter()
+	fields := make([]transport.Field, 0, len(formatter.Fields()))
+	for _, field := range formatter.Fields() {
+		name := field
+		if rename, ok := formatter.Rename(field); ok && rename != "" {
+			name = rename
+		}
+		fields = append(fields, transport.Field{Name: name, Type: protoproducer.RenderedType(formatter, field)})
+	}
+	return fields, nil
+}
+
 // BuildProducer resolves a producer based on configuration.
-func BuildProducer(cfg *config.Config, samplingStore samplingrate.Store) (producer.ProducerInterface, error) {
+func BuildProducer(cfg *config.Config, samplingStore samplingrate.Store, applicationStore applications.Store, exporterOverrides *exporters.Overrides) (producer.ProducerInterface, error) {
 	switch cfg.Produce {
 	case "sample":
-		var cfgProducer *protoproducer.ProducerConfig
-		if cfg.MappingFile != "" {
-			f, err := os.Open(cfg.MappingFile)
-			if err != nil {
-				return nil, fmt.Errorf("load mapping %s: open: %w", cfg.MappingFile, err)
-			}
-			cfgProducer, err = config.LoadMapping(f)
-			_ = f.Close()
-			if err != nil {
-				return nil, fmt.Errorf("load mapping %s: decode: %w", cfg.MappingFile, err)
-			}
-		}
-
-		cfgm, err := cfgProducer.Compile()
+		cfgm, err := buildMapping(cfg)
 		if err != nil {
-			return nil, fmt.Errorf("compile mapping: %w", err)
+			return nil, err
 		}
 
-		return protoproducer.CreateProtoProducer(cfgm, samplingStore)
+		return protoproducer.CreateProtoProducer(cfgm, samplingStore,
+			protoproducer.WithApplicationStore(applicationStore),
+			protoproducer.WithTimeCorrection(cfg.TimeClamp, cfg.TimeMaxClockSkew),
+			protoproducer.WithExporterOverrides(exporterOverrides),
+		)
 	case "raw":
 		return &rawproducer.RawProducer{}, nil
 	default:
@@ -16,6 +16,7 @@ import (
 	"github.com/tgragnato/goflow/transport"
 	"github.com/tgragnato/goflow/utils"
 	"github.com/tgragnato/goflow/utils/debug"
+	"github.com/tgragnato/goflow/utils/pcap"
 	"github.com/tgragnato/goflow/utils/store/templates"
 )
 
@@ -31,6 +32,12 @@ type Config struct {
 	Logger        *slog.Logger
 }
 
+// receiver is a UDP or gRPC receiver, or a capture replayer.
+type receiver interface {
+	Errors() <-chan error
+	Stop() error
+}
+
 // Collector manages receivers and flow pipes.
 type Collector struct {
 	listeners []listen.ListenerConfig
@@ -41,7 +48,8 @@ type Collector struct {
 	errInt    time.Duration
 	logger    *slog.Logger
 
-	receivers       []*utils.UDPReceiver
+	receivers       []receiver
+	replicators     []*utils.Replicator
 	pipes           []utils.FlowPipe
 	netflowTemplate *utils.NetFlowPipe
 	templateStore   netflow.ManagedTemplateStore
@@ -97,26 +105,50 @@ func (c *Collector) Start() error {
 	for _, listenCfg := range c.listeners {
 		logAttr := []any{
 			slog.String("scheme", listenCfg.Scheme),
-			slog.String("hostname", listenCfg.Hostname),
-			slog.Int("port", listenCfg.Port),
-			slog.Int("count", listenCfg.NumSockets),
-			slog.Int("workers", listenCfg.NumWorkers),
-			slog.Bool("blocking", listenCfg.Blocking),
-			slog.Int("queue_size", listenCfg.QueueSize),
+		}
+		if listenCfg.Scheme == "pcap" {
+			logAttr = append(logAttr,
+				slog.String("path", listenCfg.Path),
+				slog.Float64("speed", listenCfg.Speed),
+			)
+		} else if listenCfg.Scheme == "grpc" {
+			logAttr = append(logAttr,
+				slog.String("hostname", listenCfg.Hostname),
+				slog.Int("port", listenCfg.Port),
+				slog.Bool("tls", listenCfg.TLSCert != ""),
+				slog.Bool("mtls", listenCfg.TLSClientCA != ""),
+			)
+		} else {
+			logAttr = append(logAttr,
+				slog.String("hostname", listenCfg.Hostname),
+				slog.Int("port", listenCfg.Port),
+				slog.Int("count", listenCfg.NumSockets),
+				slog.Int("workers", listenCfg.NumWorkers),
+				slog.Bool("blocking", listenCfg.Blocking),
+				slog.Int("queue_size", listenCfg.QueueSize),
+			)
+		}
+		if len(listenCfg.Replicate) > 0 {
+			logAttr = append(logAttr, slog.Int("replicate", len(listenCfg.Replicate)))
 		}
 		logger := c.logger.With(logAttr...)
 		logger.Info("starting collection")
 
-		recvCfg := &utils.UDPReceiverConfig{
-			Sockets:          listenCfg.NumSockets,
-			Workers:          listenCfg.NumWorkers,
-			QueueSize:        listenCfg.QueueSize,
-			Blocking:         listenCfg.Blocking,
-			ReceiverCallback: metrics.NewReceiverMetric(),
-		}
-		recv, err := utils.NewUDPReceiver(recvCfg)
-		if err != nil {
-			return fmt.Errorf("collector: init receiver: %w", err)
+		var replicator *utils.Replicator
+		if len(listenCfg.Replicate) > 0 && listenCfg.Scheme == "grpc" {
+			return fmt.Errorf("collector: cannot replicate forwarded flows of %s:%d", listenCfg.Hostname, listenCfg.Port)
+		} else if len(listenCfg.Replicate) > 0 {
+			var err error
+			replicator, err = utils.NewReplicator(listenCfg.Replicate, listenCfg.Spoof)
+			if err != nil {
+				return fmt.Errorf("collector: init replicator: %w", err)
+			}
+			c.replicators = append(c.replicators, replicator)
+			if listenCfg.Spoof && !replicator.Spoofing() {
+				logger.Warn("cannot spoof replicated packets, forwarding from the collector address")
+			}
+		} else if listenCfg.Scheme == "replicate" {
+			return fmt.Errorf("collector: no replication destination for %s:%d", listenCfg.Hostname, listenCfg.Port)
 		}
 
 		pipeCfg := &utils.PipeConfig{
@@ -132,8 +164,12 @@ func (c *Collector) Start() error {
 			p = utils.NewSFlowPipe(pipeCfg)
 		case "netflow":
 			p = utils.NewNetFlowPipe(pipeCfg)
-		case "flow":
+		case "flow", "pcap":
 			p = utils.NewFlowPipe(pipeCfg)
+		case "grpc":
+			p = utils.NewForwardPipe(pipeCfg)
+		case "replicate":
+			// packets are only replicated
 		default:
 			return fmt.Errorf("scheme does not exist: %s", listenCfg.Scheme)
 		}
@@ -142,15 +178,74 @@ func (c *Collector) Start() error {
 			c.netflowTemplate = nfP
 		}
 
-		decodeFunc := p.DecodeFlow
-		decodeFunc = debug.PanicDecoderWrapper(decodeFunc)
-		decodeFunc = metrics.PromDecoderWrapper(decodeFunc, listenCfg.Scheme)
-		c.pipes = append(c.pipes, p)
+		var decodeFunc utils.DecoderFunc
+		if p != nil {
+			decodeFunc = p.DecodeFlow
+			decodeFunc = debug.PanicDecoderWrapper(decodeFunc)
+			if listenCfg.Scheme != "grpc" {
+				// forwarded batches are not datagrams
+				decodeFunc = metrics.PromDecoderWrapper(decodeFunc, listenCfg.Scheme)
+			}
+			c.pipes = append(c.pipes, p)
+		}
 
 		bm := utils.NewBatchMute(c.errInt, c.errCnt)
 
-		if err := recv.Start(listenCfg.Hostname, listenCfg.Port, decodeFunc); err != nil {
-			return fmt.Errorf("collector: start receiver %s:%d: %w", listenCfg.Hostname, listenCfg.Port, err)
+		var recv receiver
+		if listenCfg.Scheme == "pcap" {
+			replayer, err := pcap.NewReplayer(&pcap.ReplayerConfig{
+				Path:       listenCfg.Path,
+				Speed:      listenCfg.Speed,
+				Ports:      listenCfg.Ports,
+				Replicator: replicator,
+			})
+			if err != nil {
+				return fmt.Errorf("collector: init replayer: %w", err)
+			}
+			if err := replayer.Start(decodeFunc); err != nil {
+				return fmt.Errorf("collector: start replayer: %w", err)
+			}
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				select {
+				case <-c.stopCh:
+				case <-replayer.Done():
+					logger.Info("replay finished", slog.Uint64("datagrams", replayer.Replayed()))
+				}
+			}()
+			recv = replayer
+		} else if listenCfg.Scheme == "grpc" {
+			grpcRecv, err := utils.NewGRPCReceiver(&utils.GRPCReceiverConfig{
+				TLSCert:     listenCfg.TLSCert,
+				TLSKey:      listenCfg.TLSKey,
+				TLSClientCA: listenCfg.TLSClientCA,
+				MaxStreams:  listenCfg.MaxStreams,
+			})
+			if err != nil {
+				return fmt.Errorf("collector: init receiver: %w", err)
+			}
+			if err := grpcRecv.Start(listenCfg.Hostname, listenCfg.Port, decodeFunc); err != nil {
+				return fmt.Errorf("collector: start receiver %s:%d: %w", listenCfg.Hostname, listenCfg.Port, err)
+			}
+			recv = grpcRecv
+		} else {
+			recvCfg := &utils.UDPReceiverConfig{
+				Sockets:          listenCfg.NumSockets,
+				Workers:          listenCfg.NumWorkers,
+				QueueSize:        listenCfg.QueueSize,
+				Blocking:         listenCfg.Blocking,
+				ReceiverCallback: metrics.NewReceiverMetric(),
+				Replicator:       replicator,
+			}
+			udpRecv, err := utils.NewUDPReceiver(recvCfg)
+			if err != nil {
+				return fmt.Errorf("collector: init receiver: %w", err)
+			}
+			if err := udpRecv.Start(listenCfg.Hostname, listenCfg.Port, decodeFunc); err != nil {
+				return fmt.Errorf("collector: start receiver %s:%d: %w", listenCfg.Hostname, listenCfg.Port, err)
+			}
+			recv = udpRecv
 		}
 		source := recvErrSource{
 			ch:     recv.Errors(),
@@ -198,7 +293,7 @@ func (c *Collector) Start() error {
 						recvErr.logger.Info("closed receiver")
 						continue
 					}
-					if !errors.Is(recvErr.err, netflow.ErrorTemplateNotFound) && !errors.Is(recvErr.err, debug.ErrPanic) {
+					if !errors.Is(recvErr.err, netflow.ErrorTemplateNotFound) && !errors.Is(recvErr.err, debug.ErrPanic) && !errors.Is(recvErr.err, utils.ErrReplicate) {
 						recvErr.logger.Error("error", slog.String("error", recvErr.err.Error()))
 						continue
 					}
@@ -215,6 +310,8 @@ func (c *Collector) Start() error {
 
 						if errors.Is(recvErr.err, netflow.ErrorTemplateNotFound) {
 							recvErr.logger.Warn("template error")
+						} else if errors.Is(recvErr.err, utils.ErrReplicate) {
+							recvErr.logger.Warn("replication error", attrs...)
 						} else if errors.Is(recvErr.err, debug.ErrPanic) {
 							var pErrMsg *debug.PanicErrorMessage
 							if errors.As(recvErr.err, &pErrMsg) {
@@ -278,6 +375,11 @@ func (c *Collector) Stop() {
 			c.logger.Error("error stopping receiver", slog.String("error", err.Error()))
 		}
 	}
+	for _, replicator := range c.replicators {
+		if err := replicator.Close(); err != nil {
+			c.logger.Error("error closing replicator", slog.String("error", err.Error()))
+		}
+	}
 	for _, pipe := range c.pipes {
 		pipe.Close()
 	}
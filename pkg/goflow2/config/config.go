@@ -37,10 +37,18 @@ type Config struct {
 	SamplingRatesSweepInterval  time.Duration
 	SamplingRatesExtendOnAccess bool
 
+	ApplicationsTTL            time.Duration
+	ApplicationsSweepInterval  time.Duration
+	ApplicationsExtendOnAccess bool
+
+	TimeClamp        bool
+	TimeMaxClockSkew time.Duration
+
 	StoreJSONPath     string
 	StoreJSONInterval time.Duration
 
-	MappingFile string
+	MappingFile   string
+	ExportersFile string
 
 	GeoipASN string
 	GeoipCC  string
@@ -66,7 +74,13 @@ func BindFlags(fs *flag.FlagSet) *Config {
 	fs.DurationVar(&cfg.SamplingRatesTTL, "sampling.ttl", 0, "Sampling rates TTL (0 disables expiry)")
 	fs.DurationVar(&cfg.SamplingRatesSweepInterval, "sampling.sweep-interval", time.Minute, "Sampling rates expiry sweep interval")
 	fs.BoolVar(&cfg.SamplingRatesExtendOnAccess, "sampling.ttl.extend-on-access", false, "Extend sampling rate TTL on access")
+	fs.DurationVar(&cfg.ApplicationsTTL, "applications.ttl", 0, "NBAR application names TTL (0 disables expiry)")
+	fs.DurationVar(&cfg.ApplicationsSweepInterval, "applications.sweep-interval", time.Minute, "NBAR application names expiry sweep interval")
+	fs.BoolVar(&cfg.ApplicationsExtendOnAccess, "applications.ttl.extend-on-access", false, "Extend application name TTL on access")
+	fs.BoolVar(&cfg.TimeClamp, "time.clamp", false, "Clamp NetFlow/IPFIX flow timestamps in the future to the reception time")
+	fs.DurationVar(&cfg.TimeMaxClockSkew, "time.max-skew", 0, "Shift NetFlow/IPFIX flow timestamps when the exporter clock is skewed by more than this duration (0 disables)")
 	fs.StringVar(&cfg.MappingFile, "mapping", "", "Configuration file for custom mappings")
+	fs.StringVar(&cfg.ExportersFile, "exporters", "", "Per-exporter defaults and overrides file (reloaded on SIGHUP)")
 	fs.StringVar(&cfg.GeoipASN, "geoip.asn", "GeoLite2-ASN.mmdb", "Path to GeoIP ASN database")
 	fs.StringVar(&cfg.GeoipCC, "geoip.cc", "GeoLite2-Country.mmdb", "Path to GeoIP Country database")
 
@@ -0,0 +1,219 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tgragnato/goflow/utils"
+	"github.com/tgragnato/goflow/utils/pcap"
+)
+
+// Input and output stream formats. Raw streams are datagrams prefixed by their length
+// as a 4 bytes big-endian integer.
+const (
+	streamPcap = "pcap"
+	streamRaw  = "raw"
+)
+
+// messageReader returns the datagrams of an input stream.
+type messageReader func() (*utils.Message, error)
+
+// messageWriter writes a converted datagram of a message.
+type messageWriter func(msg *utils.Message, payload []byte) error
+
+func rawReader(r io.Reader, exporter netip.AddrPort) messageReader {
+	br := bufio.NewReader(r)
+	var length [4]byte
+	return func() (*utils.Message, error) {
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("truncated raw stream: %w", err)
+			}
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(length[:])
+		if size > 0xffff {
+			return nil, fmt.Errorf("raw datagram too large: %d", size)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil, fmt.Errorf("truncated raw stream: %w", err)
+		}
+		return &utils.Message{Src: exporter, Payload: payload, Received: time.Now().UTC()}, nil
+	}
+}
+
+func rawWriter(w io.Writer) messageWriter {
+	return func(_ *utils.Message, payload []byte) error {
+		if _, err := w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(payload)))); err != nil {
+			return err
+		}
+		_, err := w.Write(payload)
+		return err
+	}
+}
+
+// pcapWriter writes the datagrams from the exporters to the destination of the
+// original datagrams, on the port of the output protocol.
+func pcapWriter(w io.Writer, port uint16) (messageWriter, error) {
+	writer, err := pcap.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return func(msg *utils.Message, payload []byte) error {
+		src := netip.AddrPortFrom(msg.Src.Addr().Unmap(), msg.Src.Port())
+		dst := msg.Dst.Addr().Unmap()
+		if !dst.IsValid() || dst.Is4() != src.Addr().Is4() {
+			dst = netip.IPv6Loopback()
+			if src.Addr().Is4() {
+				dst = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+			}
+		}
+		return writer.WriteMessage(&utils.Message{
+			Src:      src,
+			Dst:      netip.AddrPortFrom(dst, port),
+			Payload:  payload,
+			Received: msg.Received,
+		})
+	}, nil
+}
+
+func udpWriter(conn net.Conn) messageWriter {
+	return func(_ *utils.Message, payload []byte) error {
+		_, err := conn.Write(payload)
+		return err
+	}
+}
+
+// Run executes the convert subcommand: it reads the datagrams of a capture or a raw stream,
+// converts their flows to another protocol and writes the resulting datagrams.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	input := fs.String("input", "-", "Input file, - for the standard input")
+	inputFormat := fs.String("input.format", streamPcap, "Input format (pcap, raw)")
+	exporterAddr := fs.String("exporter", "127.0.0.1:0", "Exporter address of the datagrams of raw inputs")
+	to := fs.String("to", "", fmt.Sprintf("Output protocol (%s)", strings.Join(Protocols, ", ")))
+	output := fs.String("output", "-", "Output file, - for the standard output")
+	outputFormat := fs.String("output.format", streamPcap, "Output format (pcap, raw)")
+	outputUDP := fs.String("output.udp", "", "Send the datagrams to this address instead of writing them")
+	outputPort := fs.Uint("output.port", 0, "Destination port of the datagrams in pcap outputs, defaults to the port of the protocol")
+	mtu := fs.Int("mtu", 1400, "Maximum size of the datagrams")
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	converter, err := New(*to, *mtu)
+	if err != nil {
+		return fmt.Errorf("convert: %w", err)
+	}
+	defer converter.Close()
+
+	in := stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("convert: open input: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	var read messageReader
+	switch *inputFormat {
+	case streamPcap:
+		reader, err := pcap.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("convert: %w", err)
+		}
+		read = reader.Next
+	case streamRaw:
+		exporter, err := netip.ParseAddrPort(*exporterAddr)
+		if err != nil {
+			return fmt.Errorf("convert: parse exporter: %w", err)
+		}
+		read = rawReader(in, exporter)
+	default:
+		return fmt.Errorf("convert: unknown input format %s", *inputFormat)
+	}
+
+	var write messageWriter
+	flush := func() error { return nil }
+	if *outputUDP != "" {
+		conn, err := net.Dial("udp", *outputUDP)
+		if err != nil {
+			return fmt.Errorf("convert: dial output: %w", err)
+		}
+		defer conn.Close()
+		write = udpWriter(conn)
+	} else {
+		out := bufio.NewWriter(stdout)
+		if *output != "-" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return fmt.Errorf("convert: create output: %w", err)
+			}
+			defer f.Close()
+			out = bufio.NewWriter(f)
+		}
+		flush = out.Flush
+
+		switch *outputFormat {
+		case streamPcap:
+			port := uint16(*outputPort)
+			if port == 0 {
+				port = DefaultPorts[*to]
+			}
+			if write, err = pcapWriter(out, port); err != nil {
+				return fmt.Errorf("convert: %w", err)
+			}
+		case streamRaw:
+			write = rawWriter(out)
+		default:
+			return fmt.Errorf("convert: unknown output format %s", *outputFormat)
+		}
+	}
+
+	var received, written, undecodable, failed int
+	for {
+		msg, err := read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("convert: read: %w", err)
+		}
+		received++
+		datagrams, err := converter.Convert(msg)
+		if err != nil {
+			if errors.Is(err, ErrDecode) {
+				undecodable++
+			} else {
+				failed++
+			}
+			fmt.Fprintf(stderr, "datagram %d from %s: %v\n", received, msg.Src, err)
+			continue
+		}
+		for _, payload := range datagrams {
+			if err := write(msg, payload); err != nil {
+				return fmt.Errorf("convert: write: %w", err)
+			}
+			written++
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("convert: write: %w", err)
+	}
+	fmt.Fprintf(stderr, "read %d datagrams, wrote %d datagrams, skipped %d undecodable datagrams, failed to convert %d datagrams\n",
+		received, written, undecodable, failed)
+	return nil
+}
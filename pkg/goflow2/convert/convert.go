@@ -0,0 +1,193 @@
+// Package convert converts flow datagrams between sFlow, NetFlow v5, NetFlow v9 and IPFIX.
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/decoders/netflowlegacy"
+	"github.com/tgragnato/goflow/decoders/sflow"
+	"github.com/tgragnato/goflow/producer"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/utils"
+	"github.com/tgragnato/goflow/utils/store/samplingrate"
+	"github.com/tgragnato/goflow/utils/store/templates"
+)
+
+// Output protocols.
+const (
+	SFlow     = "sflow"
+	NetFlowV5 = "nfv5"
+	NetFlowV9 = "netflow"
+	IPFIX     = "ipfix"
+)
+
+// Protocols lists the output protocols.
+var Protocols = []string{SFlow, NetFlowV5, NetFlowV9, IPFIX}
+
+// DefaultPorts are the usual destination ports of the protocols.
+var DefaultPorts = map[string]uint16{
+	SFlow:     6343,
+	NetFlowV5: 2055,
+	NetFlowV9: 2055,
+	IPFIX:     4739,
+}
+
+// ErrDecode marks a datagram which could not be decoded, as opposed to a failure to encode its flows.
+var ErrDecode = fmt.Errorf("undecodable datagram")
+
+// bootOffset is how long before the first datagram the exporters are considered started,
+// the NetFlow uptimes of older flows are clamped.
+const bootOffset = 24 * time.Hour
+
+// Converter decodes datagrams of any protocol and encodes their flows in the output protocol.
+// Sequence numbers are tracked per exporter.
+type Converter struct {
+	output string
+	mtu    int
+
+	templates     netflow.ManagedTemplateStore
+	samplingRates samplingrate.Store
+
+	boot      time.Time
+	sequences map[netip.Addr]uint32
+	samples   map[netip.Addr]uint32 // sFlow sample sequence numbers
+}
+
+// New creates a converter to an output protocol, datagrams are split to fit the MTU.
+func New(output string, mtu int) (*Converter, error) {
+	if _, ok := DefaultPorts[output]; !ok {
+		return nil, fmt.Errorf("unknown output protocol %s", output)
+	}
+	if mtu < 512 {
+		return nil, fmt.Errorf("mtu %d is too small", mtu)
+	}
+	samplingRates := samplingrate.NewSamplingRateFlowStore()
+	samplingRates.Start()
+	return &Converter{
+		output:        output,
+		mtu:           mtu,
+		templates:     templates.NewTemplateFlowStore(),
+		samplingRates: samplingRates,
+		sequences:     make(map[netip.Addr]uint32),
+		samples:       make(map[netip.Addr]uint32),
+	}, nil
+}
+
+// Close releases the stores.
+func (c *Converter) Close() {
+	c.samplingRates.Close()
+}
+
+// decode returns the flows of a datagram.
+func (c *Converter) decode(msg *utils.Message) ([]*protoproducer.ProtoProducerMessage, error) {
+	if len(msg.Payload) < 4 {
+		return nil, fmt.Errorf("datagram too short")
+	}
+	buf := bytes.NewBuffer(msg.Payload)
+	ctx := netflow.FlowContext{RouterKey: msg.Src.String()}
+	sampler := msg.Src.Addr().Unmap().AsSlice()
+	received := uint64(msg.Received.UnixNano())
+
+	var flows []producer.ProducerMessage
+	var err error
+	isSFlow := binary.BigEndian.Uint32(msg.Payload) == 5
+	switch {
+	case isSFlow:
+		var packet sflow.Packet
+		if err := sflow.DecodeMessageVersion(buf, &packet); err != nil {
+			return nil, fmt.Errorf("decode sflow: %w", err)
+		}
+		flows, err = protoproducer.ProcessMessageSFlowConfig(&packet, nil)
+	case binary.BigEndian.Uint16(msg.Payload) == 5:
+		var packet netflowlegacy.PacketNetFlowV5
+		if err := netflowlegacy.DecodeMessageVersion(buf, &packet); err != nil {
+			return nil, fmt.Errorf("decode netflow v5: %w", err)
+		}
+		flows, err = protoproducer.ProcessMessageNetFlowLegacy(&packet)
+	case binary.BigEndian.Uint16(msg.Payload) == 9:
+		var packet netflow.NFv9Packet
+		if err := netflow.DecodeMessageVersion(buf, c.templates, ctx, &packet, nil); err != nil {
+			return nil, fmt.Errorf("decode netflow v9: %w", err)
+		}
+		flows, err = protoproducer.ProcessMessageNetFlowV9Config(&packet, ctx, c.samplingRates, nil)
+	case binary.BigEndian.Uint16(msg.Payload) == 10:
+		var packet netflow.IPFIXPacket
+		if err := netflow.DecodeMessageVersion(buf, c.templates, ctx, nil, &packet); err != nil {
+			return nil, fmt.Errorf("decode ipfix: %w", err)
+		}
+		flows, err = protoproducer.ProcessMessageIPFIXConfig(&packet, ctx, c.samplingRates, nil)
+	default:
+		return nil, fmt.Errorf("unknown protocol")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("process flows: %w", err)
+	}
+
+	messages := make([]*protoproducer.ProtoProducerMessage, 0, len(flows))
+	for _, flow := range flows {
+		m, ok := flow.(*protoproducer.ProtoProducerMessage)
+		if !ok {
+			continue
+		}
+		m.TimeReceivedNs = received
+		if isSFlow { // samples are packets seen at the time of the export
+			m.TimeFlowStartNs, m.TimeFlowEndNs = received, received
+		} else {
+			m.SamplerAddress = sampler
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// uptime returns the uptime of the exporters at a time in milliseconds.
+func (c *Converter) uptime(t time.Time) uint32 {
+	if t.Before(c.boot) {
+		return 0
+	}
+	return uint32(t.Sub(c.boot).Milliseconds())
+}
+
+// nextSequence returns the sequence number of an exporter and adds n to it.
+func (c *Converter) nextSequence(exporter netip.Addr, n int) uint32 {
+	sequence := c.sequences[exporter]
+	c.sequences[exporter] = sequence + uint32(n)
+	return sequence
+}
+
+// nextSampleSequence returns the next sFlow sample sequence number of an agent.
+func (c *Converter) nextSampleSequence(agent netip.Addr) uint32 {
+	sequence := c.samples[agent]
+	c.samples[agent] = sequence + 1
+	return sequence
+}
+
+// Convert returns the datagrams of the output protocol equivalent to a datagram.
+// Datagrams without flows (eg: templates only) produce no output.
+func (c *Converter) Convert(msg *utils.Message) ([][]byte, error) {
+	if c.boot.IsZero() {
+		c.boot = msg.Received.Add(-bootOffset)
+	}
+	flows, err := c.decode(msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	if len(flows) == 0 {
+		return nil, nil
+	}
+	switch c.output {
+	case SFlow:
+		return c.encodeSFlow(msg, flows)
+	case NetFlowV5:
+		return c.encodeNetFlowV5(msg, flows)
+	case NetFlowV9:
+		return c.encodeNetFlowV9(msg, flows)
+	default:
+		return c.encodeIPFIX(msg, flows)
+	}
+}
@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflowlegacy"
+	"github.com/tgragnato/goflow/decoders/sflow"
+	flowmessage "github.com/tgragnato/goflow/pb"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/utils"
+)
+
+var (
+	exporterAddr = netip.MustParseAddrPort("192.0.2.10:50000")
+	received     = time.Date(2024, 5, 1, 12, 0, 0, 250000000, time.UTC)
+)
+
+// decodeAll decodes converted datagrams back to flows.
+func decodeAll(t *testing.T, datagrams [][]byte) []*protoproducer.ProtoProducerMessage {
+	t.Helper()
+	c, err := New(IPFIX, 1400)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+	var flows []*protoproducer.ProtoProducerMessage
+	for _, b := range datagrams {
+		decoded, err := c.decode(&utils.Message{Src: exporterAddr, Payload: b, Received: received})
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		flows = append(flows, decoded...)
+	}
+	return flows
+}
+
+func TestConvertSFlow(t *testing.T) {
+	t.Parallel()
+	m := &protoproducer.ProtoProducerMessage{}
+	m.FlowMessage = flowmessage.FlowMessage{
+		SrcAddr:  []byte{10, 0, 0, 1},
+		DstAddr:  []byte{10, 0, 0, 2},
+		NextHop:  []byte{10, 0, 0, 254},
+		Etype:    0x800,
+		Proto:    6,
+		SrcPort:  443,
+		DstPort:  51000,
+		TcpFlags: 0x18,
+		Packets:  10,
+		Bytes:    15000,
+		SrcNet:   24,
+		DstNet:   16,
+		SrcAs:    65001,
+		DstAs:    65002,
+		InIf:     3,
+		OutIf:    4,
+		SrcMac:   0x020000000001,
+		DstMac:   0x020000000002,
+
+		SamplingRate: 100,
+	}
+	payload, err := sflow.EncodeMessage(&sflow.Packet{
+		Version: 5,
+		AgentIP: []byte{192, 0, 2, 20},
+		Samples: []interface{}{flowSample(m, 0)},
+	})
+	if err != nil {
+		t.Fatalf("encode sflow: %v", err)
+	}
+	msg := &utils.Message{Src: exporterAddr, Payload: payload, Received: received}
+
+	for _, output := range []string{IPFIX, NetFlowV9, NetFlowV5, SFlow} {
+		c, err := New(output, 1400)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		datagrams, err := c.Convert(msg)
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: convert: %v", output, err)
+		}
+		flows := decodeAll(t, datagrams)
+		if len(flows) != 1 {
+			t.Fatalf("%s: expected 1 flow, got %d", output, len(flows))
+		}
+		f := flows[0]
+		// the sample of one packet represents the packets of the flow through its sampling rate
+		if !bytes.Equal(f.SrcAddr, m.SrcAddr) || !bytes.Equal(f.DstAddr, m.DstAddr) || !bytes.Equal(f.NextHop, m.NextHop) ||
+			f.SrcPort != 443 || f.DstPort != 51000 || f.Proto != 6 || f.TcpFlags != 0x18 ||
+			f.Packets != 1 || f.Bytes != 1500 || f.SrcAs != 65001 || f.DstAs != 65002 ||
+			f.SrcNet != 24 || f.DstNet != 16 || f.InIf != 3 || f.OutIf != 4 {
+			t.Fatalf("%s: unexpected flow %+v", output, f)
+		}
+		if output == SFlow && (f.SamplingRate != 1000 || f.SrcMac != m.SrcMac) {
+			t.Fatalf("sflow: unexpected flow %+v", f)
+		}
+		if output != SFlow && f.TimeFlowStartNs/1e6 != uint64(received.UnixMilli()) {
+			t.Fatalf("%s: expected flow start %d, got %d", output, received.UnixMilli(), f.TimeFlowStartNs/1e6)
+		}
+	}
+}
+
+func TestConvertNetFlowV5(t *testing.T) {
+	t.Parallel()
+	packet := netflowlegacy.PacketNetFlowV5{
+		SysUptime:        60000,
+		UnixSecs:         uint32(received.Unix()),
+		SamplingInterval: 10,
+	}
+	for i := 0; i < 100; i++ {
+		packet.Records = append(packet.Records, netflowlegacy.RecordsNetFlowV5{
+			SrcAddr: 0x0a000001,
+			DstAddr: 0x0a000002 + netflowlegacy.IPAddress(i),
+			DPkts:   4,
+			DOctets: 400,
+			First:   50000,
+			Last:    59000,
+			SrcPort: 53,
+			DstPort: 40000,
+			Proto:   17,
+			SrcAS:   65001,
+			DstAS:   65002,
+		})
+	}
+	for _, r := range packet.Records[:30] {
+		packet.Records = append(packet.Records, r)
+	}
+	payload, err := packet.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode netflow v5: %v", err)
+	}
+	msg := &utils.Message{Src: exporterAddr, Payload: payload, Received: received}
+
+	for _, output := range []string{SFlow, IPFIX, NetFlowV5} {
+		c, err := New(output, 1400)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		datagrams, err := c.Convert(msg)
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: convert: %v", output, err)
+		}
+		for _, b := range datagrams {
+			if len(b) > 1400 {
+				t.Fatalf("%s: datagram of %d bytes exceeds the mtu", output, len(b))
+			}
+		}
+		flows := decodeAll(t, datagrams)
+		if len(flows) != len(packet.Records) {
+			t.Fatalf("%s: expected %d flows, got %d", output, len(packet.Records), len(flows))
+		}
+		f := flows[99]
+		if !bytes.Equal(f.DstAddr, []byte{10, 0, 0, 101}) || f.SrcPort != 53 || f.SrcAs != 65001 || f.DstAs != 65002 {
+			t.Fatalf("%s: unexpected flow %+v", output, f)
+		}
+		switch output {
+		case SFlow:
+			if f.Packets != 1 || f.Bytes != 100 || f.SamplingRate != 40 {
+				t.Fatalf("sflow: unexpected counters %+v", f)
+			}
+		default:
+			if f.Packets != 4 || f.Bytes != 400 {
+				t.Fatalf("%s: unexpected counters %+v", output, f)
+			}
+			start := received.Truncate(time.Second).Add(-10 * time.Second)
+			if f.TimeFlowStartNs != uint64(start.UnixNano()) {
+				t.Fatalf("%s: expected flow start %v, got %v", output, start, time.Unix(0, int64(f.TimeFlowStartNs)).UTC())
+			}
+		}
+	}
+}
+
+func TestRawReader(t *testing.T) {
+	t.Parallel()
+	read := rawReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), exporterAddr)
+	if _, err := read(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("expected a too large datagram error, got %v", err)
+	}
+
+	read = rawReader(bytes.NewReader([]byte{0, 0, 0, 4, 1, 2}), exporterAddr)
+	if _, err := read(); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected a truncated stream error, got %v", err)
+	}
+}
+
+func TestRunUndecodable(t *testing.T) {
+	t.Parallel()
+	var stdin, stdout, stderr bytes.Buffer
+	stdin.Write([]byte{0, 0, 0, 4, 0, 42, 0, 0})
+	if err := Run([]string{"-input.format", "raw", "-output.format", "raw", "-to", IPFIX}, &stdin, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "datagram 1 from 127.0.0.1:0: undecodable datagram: unknown protocol") ||
+		!strings.Contains(stderr.String(), "skipped 1 undecodable datagrams, failed to convert 0 datagrams") {
+		t.Fatalf("expected the undecodable datagram reported, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,324 @@
+package convert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/decoders/netflowlegacy"
+	ipfixformat "github.com/tgragnato/goflow/format/ipfix"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/utils"
+)
+
+const (
+	netflowV5HeaderLen = 24
+	netflowV5RecordLen = 48
+	netflowV5Max       = 30 // records per datagram
+	netflowV9Header    = 20
+	ipfixHeader        = 16
+	setHeader          = 4
+	nfv9TemplateSet    = 0
+	ipfixTemplateSet   = 2
+)
+
+// exporter returns the address of the exporter of a flow.
+func exporter(m *protoproducer.ProtoProducerMessage) netip.Addr {
+	addr, _ := netip.AddrFromSlice(m.SamplerAddress)
+	return addr.Unmap()
+}
+
+// groupByExporter splits flows per exporter, keeping their order.
+func groupByExporter(flows []*protoproducer.ProtoProducerMessage) [][]*protoproducer.ProtoProducerMessage {
+	var groups [][]*protoproducer.ProtoProducerMessage
+	index := make(map[netip.Addr]int)
+	for _, m := range flows {
+		addr := exporter(m)
+		i, ok := index[addr]
+		if !ok {
+			i = len(groups)
+			index[addr] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+	return groups
+}
+
+// dataSet is a set of records sharing a template.
+type dataSet struct {
+	id      uint16
+	records []netflow.DataRecord
+}
+
+// templateLength returns the encoded length of a template record.
+func templateLength(template netflow.TemplateRecord) int {
+	return 4 + 4*len(template.Fields)
+}
+
+// recordLength returns the encoded length of a data record.
+func recordLength(record netflow.DataRecord) int {
+	var length int
+	for _, v := range record.Values {
+		length += len(v.Value.([]byte))
+	}
+	return length
+}
+
+// packSets splits records into datagrams of at most mtu bytes. Each datagram holds the
+// templates of its records followed by the data sets. It returns the flow sets and
+// the number of records of each datagram.
+func packSets(mtu, header int, templateSetID uint16, templates map[uint16]netflow.TemplateRecord, ids []uint16, records []netflow.DataRecord) ([][]interface{}, [][]int) {
+	var datagrams [][]interface{}
+	var counts [][]int
+
+	var sets []*dataSet
+	length := header
+	flush := func() {
+		if len(sets) == 0 {
+			return
+		}
+		var flowSets []interface{}
+		var count []int
+		for _, s := range sets {
+			flowSets = append(flowSets, netflow.TemplateFlowSet{
+				FlowSetHeader: netflow.FlowSetHeader{Id: templateSetID},
+				Records:       []netflow.TemplateRecord{templates[s.id]},
+			})
+		}
+		for _, s := range sets {
+			flowSets = append(flowSets, netflow.DataFlowSet{
+				FlowSetHeader: netflow.FlowSetHeader{Id: s.id},
+				Records:       s.records,
+			})
+			count = append(count, len(s.records))
+		}
+		datagrams = append(datagrams, flowSets)
+		counts = append(counts, count)
+		sets, length = nil, header
+	}
+
+	for i, record := range records {
+		size := recordLength(record)
+		var current *dataSet
+		for _, s := range sets {
+			if s.id == ids[i] {
+				current = s
+			}
+		}
+		added := size
+		if current == nil {
+			added += 2*setHeader + templateLength(templates[ids[i]]) + 3 // worst case padding
+		}
+		if length+added > mtu && len(sets) > 0 {
+			flush()
+			current = nil
+			added = size + 2*setHeader + templateLength(templates[ids[i]]) + 3
+		}
+		if current == nil {
+			current = &dataSet{id: ids[i]}
+			sets = append(sets, current)
+		}
+		current.records = append(current.records, record)
+		length += added
+	}
+	flush()
+	return datagrams, counts
+}
+
+// encodeIPFIX encodes flows with the templates of the IPFIX format.
+func (c *Converter) encodeIPFIX(msg *utils.Message, flows []*protoproducer.ProtoProducerMessage) ([][]byte, error) {
+	var datagrams [][]byte
+	for _, group := range groupByExporter(flows) {
+		templates := make(map[uint16]netflow.TemplateRecord)
+		ids := make([]uint16, len(group))
+		records := make([]netflow.DataRecord, len(group))
+		for i, m := range group {
+			ids[i] = ipfixformat.TemplateFor(m)
+			if _, ok := templates[ids[i]]; !ok {
+				template, err := ipfixformat.Template(ids[i])
+				if err != nil {
+					return nil, fmt.Errorf("ipfix template: %w", err)
+				}
+				templates[ids[i]] = template
+			}
+			records[i] = ipfixformat.Record(m)
+		}
+
+		sets, counts := packSets(c.mtu, ipfixHeader, ipfixTemplateSet, templates, ids, records)
+		for i, flowSets := range sets {
+			packet := netflow.IPFIXPacket{
+				Version:        10,
+				ExportTime:     uint32(msg.Received.Unix()),
+				SequenceNumber: c.nextSequence(exporter(group[0]), sum(counts[i])),
+				FlowSets:       flowSets,
+			}
+			b, err := packet.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("encode ipfix: %w", err)
+			}
+			datagrams = append(datagrams, b)
+		}
+	}
+	return datagrams, nil
+}
+
+// nfv9Template converts an IPFIX template to NetFlow v9, with uptime-relative times.
+func nfv9Template(template netflow.TemplateRecord) netflow.TemplateRecord {
+	fields := make([]netflow.Field, len(template.Fields))
+	copy(fields, template.Fields)
+	for i, f := range fields {
+		switch f.Type {
+		case netflow.IPFIX_FIELD_flowStartMilliseconds:
+			fields[i] = netflow.Field{Type: netflow.NFV9_FIELD_FIRST_SWITCHED, Length: 4}
+		case netflow.IPFIX_FIELD_flowEndMilliseconds:
+			fields[i] = netflow.Field{Type: netflow.NFV9_FIELD_LAST_SWITCHED, Length: 4}
+		}
+	}
+	template.Fields = fields
+	return template
+}
+
+// encodeNetFlowV9 encodes flows with the IPFIX format templates, converted to NetFlow v9.
+func (c *Converter) encodeNetFlowV9(msg *utils.Message, flows []*protoproducer.ProtoProducerMessage) ([][]byte, error) {
+	// NetFlow v9 headers have a precision of a second, the uptime must match it
+	exportTime := msg.Received.Truncate(time.Second)
+	var datagrams [][]byte
+	for _, group := range groupByExporter(flows) {
+		templates := make(map[uint16]netflow.TemplateRecord)
+		ids := make([]uint16, len(group))
+		records := make([]netflow.DataRecord, len(group))
+		for i, m := range group {
+			ids[i] = ipfixformat.TemplateFor(m)
+			if _, ok := templates[ids[i]]; !ok {
+				template, err := ipfixformat.Template(ids[i])
+				if err != nil {
+					return nil, fmt.Errorf("netflow v9 template: %w", err)
+				}
+				templates[ids[i]] = nfv9Template(template)
+			}
+			record := ipfixformat.Record(m)
+			for j, v := range record.Values {
+				switch v.Type {
+				case netflow.IPFIX_FIELD_flowStartMilliseconds:
+					record.Values[j] = netflow.DataField{Type: netflow.NFV9_FIELD_FIRST_SWITCHED, Value: binary.BigEndian.AppendUint32(nil, c.uptime(time.Unix(0, int64(m.TimeFlowStartNs))))}
+				case netflow.IPFIX_FIELD_flowEndMilliseconds:
+					record.Values[j] = netflow.DataField{Type: netflow.NFV9_FIELD_LAST_SWITCHED, Value: binary.BigEndian.AppendUint32(nil, c.uptime(time.Unix(0, int64(m.TimeFlowEndNs))))}
+				}
+			}
+			records[i] = record
+		}
+
+		sets, counts := packSets(c.mtu, netflowV9Header, nfv9TemplateSet, templates, ids, records)
+		for i, flowSets := range sets {
+			packet := netflow.NFv9Packet{
+				Version:        9,
+				Count:          uint16(len(flowSets)/2 + sum(counts[i])), // templates and data records
+				SystemUptime:   c.uptime(exportTime),
+				UnixSeconds:    uint32(exportTime.Unix()),
+				SequenceNumber: c.nextSequence(exporter(group[0]), 1),
+				FlowSets:       flowSets,
+			}
+			b, err := packet.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("encode netflow v9: %w", err)
+			}
+			datagrams = append(datagrams, b)
+		}
+	}
+	return datagrams, nil
+}
+
+// encodeNetFlowV5 encodes the IPv4 flows, the others are skipped.
+func (c *Converter) encodeNetFlowV5(msg *utils.Message, flows []*protoproducer.ProtoProducerMessage) ([][]byte, error) {
+	var datagrams [][]byte
+	for _, group := range groupByExporter(flows) {
+		var records []netflowlegacy.RecordsNetFlowV5
+		var samplingRate uint64
+		for _, m := range group {
+			record, ok := netflowV5Record(m, c.uptime)
+			if !ok {
+				continue
+			}
+			records = append(records, record)
+			samplingRate = max(samplingRate, m.SamplingRate)
+		}
+		perDatagram := min(netflowV5Max, (c.mtu-netflowV5HeaderLen)/netflowV5RecordLen)
+		for start := 0; start < len(records); start += perDatagram {
+			end := min(start+perDatagram, len(records))
+			packet := netflowlegacy.PacketNetFlowV5{
+				Version:          5,
+				SysUptime:        c.uptime(msg.Received),
+				UnixSecs:         uint32(msg.Received.Unix()),
+				UnixNSecs:        uint32(msg.Received.Nanosecond()),
+				FlowSequence:     c.nextSequence(exporter(group[0]), end-start),
+				SamplingInterval: uint16(min(samplingRate, 0x3fff)),
+				Records:          records[start:end],
+			}
+			b, err := packet.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("encode netflow v5: %w", err)
+			}
+			datagrams = append(datagrams, b)
+		}
+	}
+	return datagrams, nil
+}
+
+// netflowV5Record converts an IPv4 flow to a NetFlow v5 record, counters saturate.
+func netflowV5Record(m *protoproducer.ProtoProducerMessage, uptime func(time.Time) uint32) (netflowlegacy.RecordsNetFlowV5, bool) {
+	src, srcOk := ipv4(m.SrcAddr)
+	dst, dstOk := ipv4(m.DstAddr)
+	if !srcOk || !dstOk {
+		return netflowlegacy.RecordsNetFlowV5{}, false
+	}
+	nextHop, _ := ipv4(m.NextHop)
+	return netflowlegacy.RecordsNetFlowV5{
+		SrcAddr:  netflowlegacy.IPAddress(src),
+		DstAddr:  netflowlegacy.IPAddress(dst),
+		NextHop:  netflowlegacy.IPAddress(nextHop),
+		Input:    uint16(min(m.InIf, 0xffff)),
+		Output:   uint16(min(m.OutIf, 0xffff)),
+		DPkts:    uint32(min(m.Packets, 0xffffffff)),
+		DOctets:  uint32(min(m.Bytes, 0xffffffff)),
+		First:    uptime(time.Unix(0, int64(m.TimeFlowStartNs))),
+		Last:     uptime(time.Unix(0, int64(m.TimeFlowEndNs))),
+		SrcPort:  uint16(m.SrcPort),
+		DstPort:  uint16(m.DstPort),
+		TCPFlags: uint8(m.TcpFlags),
+		Proto:    uint8(m.Proto),
+		Tos:      uint8(m.IpTos),
+		SrcAS:    as2(m.SrcAs),
+		DstAS:    as2(m.DstAs),
+		SrcMask:  uint8(m.SrcNet),
+		DstMask:  uint8(m.DstNet),
+	}, true
+}
+
+// ipv4 returns an IPv4 address as an integer.
+func ipv4(addr []byte) (uint32, bool) {
+	ip, ok := netip.AddrFromSlice(addr)
+	if !ok || !ip.Unmap().Is4() {
+		return 0, false
+	}
+	v := ip.Unmap().As4()
+	return binary.BigEndian.Uint32(v[:]), true
+}
+
+// as2 returns a 2-byte AS number, AS_TRANS for the 4-byte ones.
+func as2(as uint32) uint16 {
+	if as > 0xffff {
+		return 23456
+	}
+	return uint16(as)
+}
+
+func sum(values []int) int {
+	var total int
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
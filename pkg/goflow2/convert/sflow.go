@@ -0,0 +1,247 @@
+package convert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/tgragnato/goflow/decoders/sflow"
+	decoderutils "github.com/tgragnato/goflow/decoders/utils"
+	protoproducer "github.com/tgragnato/goflow/producer/proto"
+	"github.com/tgragnato/goflow/utils"
+)
+
+const (
+	sflowHeaderProtocolEthernet = 1
+	asPathSequence              = 2
+)
+
+// sampledHeader synthesizes the headers of a packet of a flow: Ethernet, 802.1Q, IP and transport.
+func sampledHeader(m *protoproducer.ProtoProducerMessage, frameLength uint32) []byte {
+	b := make([]byte, 0, 128)
+	b = append(b, macBytes(m.DstMac)...)
+	b = append(b, macBytes(m.SrcMac)...)
+	vlan := m.VlanId
+	if vlan == 0 {
+		vlan = m.SrcVlan
+	}
+	if vlan != 0 {
+		b = binary.BigEndian.AppendUint16(b, 0x8100)
+		b = binary.BigEndian.AppendUint16(b, uint16(vlan&0xfff))
+	}
+
+	src, _ := netip.AddrFromSlice(m.SrcAddr)
+	dst, _ := netip.AddrFromSlice(m.DstAddr)
+	src, dst = src.Unmap(), dst.Unmap()
+	ipv6 := src.Is6() || dst.Is6()
+	if !src.IsValid() && !dst.IsValid() {
+		return binary.BigEndian.AppendUint16(b, uint16(m.Etype))
+	}
+	if !src.IsValid() {
+		src = netip.IPv6Unspecified()
+		if !ipv6 {
+			src = netip.IPv4Unspecified()
+		}
+	}
+	if !dst.IsValid() {
+		dst = netip.IPv6Unspecified()
+		if !ipv6 {
+			dst = netip.IPv4Unspecified()
+		}
+	}
+
+	proto := byte(m.Proto)
+	var transport []byte
+	switch proto {
+	case 6:
+		transport = binary.BigEndian.AppendUint16(transport, uint16(m.SrcPort))
+		transport = binary.BigEndian.AppendUint16(transport, uint16(m.DstPort))
+		transport = append(transport, 0, 0, 0, 0, 0, 0, 0, 0)                          // sequence and acknowledgment numbers
+		transport = append(transport, 5<<4|byte(m.TcpFlags>>8&0x01), byte(m.TcpFlags)) // data offset and flags
+		transport = append(transport, 0xff, 0xff, 0, 0, 0, 0)                          // window, checksum, urgent pointer
+	case 17:
+		transport = binary.BigEndian.AppendUint16(transport, uint16(m.SrcPort))
+		transport = binary.BigEndian.AppendUint16(transport, uint16(m.DstPort))
+		transport = append(transport, 0, 0, 0, 0)
+	case 1, 58:
+		transport = append(transport, byte(m.IcmpType), byte(m.IcmpCode), 0, 0, 0, 0, 0, 0)
+	}
+	ttl := byte(m.IpTtl)
+	if ttl == 0 {
+		ttl = 64
+	}
+
+	if !ipv6 || src.Is4() && dst.Is4() {
+		b = binary.BigEndian.AppendUint16(b, 0x0800)
+		length := uint16(min(max(frameLength, uint32(len(b)+20+len(transport))), 0xffff)) - uint16(len(b))
+		b = append(b, 0x45, byte(m.IpTos))
+		b = binary.BigEndian.AppendUint16(b, length)
+		b = binary.BigEndian.AppendUint16(b, uint16(m.FragmentId))
+		b = binary.BigEndian.AppendUint16(b, uint16(m.FragmentOffset))
+		b = append(b, ttl, proto, 0, 0)
+		s, d := src.As4(), dst.As4()
+		b = append(b, s[:]...)
+		b = append(b, d[:]...)
+	} else {
+		b = binary.BigEndian.AppendUint16(b, 0x86dd)
+		length := uint16(min(max(frameLength, uint32(len(b)+40+len(transport))), 0xffff)) - uint16(len(b)) - 40
+		b = binary.BigEndian.AppendUint32(b, 6<<28|(m.IpTos&0xff)<<20|m.Ipv6FlowLabel&0xfffff)
+		b = binary.BigEndian.AppendUint16(b, length)
+		b = append(b, proto, ttl)
+		s, d := src.As16(), dst.As16()
+		b = append(b, s[:]...)
+		b = append(b, d[:]...)
+	}
+	return append(b, transport...)
+}
+
+func macBytes(mac uint64) []byte {
+	return []byte{byte(mac >> 40), byte(mac >> 32), byte(mac >> 24), byte(mac >> 16), byte(mac >> 8), byte(mac)}
+}
+
+// addrBytes returns an address in its shortest form, nil when invalid.
+func addrBytes(addr []byte) decoderutils.IPAddress {
+	ip, ok := netip.AddrFromSlice(addr)
+	if !ok {
+		return nil
+	}
+	return ip.Unmap().AsSlice()
+}
+
+// flowSample converts a flow to a sample of a single packet, whose sampling rate
+// accounts for the packets and the sampling rate of the flow.
+func flowSample(m *protoproducer.ProtoProducerMessage, sequence uint32) sflow.FlowSample {
+	packets := max(m.Packets, 1)
+	samplingRate := uint32(min(max(m.SamplingRate, 1)*packets, 0xffffffff))
+	frameLength := uint32(min(m.Bytes/packets, 0xffffffff))
+
+	header := sampledHeader(m, frameLength)
+	frameLength = max(frameLength, uint32(len(header)))
+	records := []sflow.FlowRecord{{
+		Header: sflow.RecordHeader{DataFormat: sflow.FLOW_TYPE_RAW},
+		Data: sflow.SampledHeader{
+			Protocol:       sflowHeaderProtocolEthernet,
+			FrameLength:    frameLength,
+			OriginalLength: uint32(len(header)),
+			HeaderData:     header,
+		},
+	}}
+
+	if m.SrcVlan != 0 || m.DstVlan != 0 {
+		records = append(records, sflow.FlowRecord{
+			Header: sflow.RecordHeader{DataFormat: sflow.FLOW_TYPE_EXT_SWITCH},
+			Data:   sflow.ExtendedSwitch{SrcVlan: m.SrcVlan, DstVlan: m.DstVlan},
+		})
+	}
+	if nextHop := addrBytes(m.NextHop); nextHop != nil || m.SrcNet != 0 || m.DstNet != 0 {
+		if nextHop == nil {
+			nextHop = make(decoderutils.IPAddress, 4)
+		}
+		records = append(records, sflow.FlowRecord{
+			Header: sflow.RecordHeader{DataFormat: sflow.FLOW_TYPE_EXT_ROUTER},
+			Data:   sflow.ExtendedRouter{NextHop: nextHop, SrcMaskLen: m.SrcNet, DstMaskLen: m.DstNet},
+		})
+	}
+	if m.SrcAs != 0 || m.DstAs != 0 || len(m.AsPath) > 0 || len(m.BgpCommunities) > 0 {
+		nextHop := addrBytes(m.BgpNextHop)
+		if nextHop == nil {
+			nextHop = make(decoderutils.IPAddress, 4)
+		}
+		gateway := sflow.ExtendedGateway{
+			NextHop:     nextHop,
+			SrcAS:       m.SrcAs,
+			ASPath:      m.AsPath,
+			Communities: m.BgpCommunities,
+		}
+		if len(gateway.ASPath) == 0 && m.DstAs != 0 {
+			gateway.ASPath = []uint32{m.DstAs}
+		}
+		if len(gateway.ASPath) > 0 {
+			gateway.ASDestinations, gateway.ASPathType = 1, asPathSequence
+		}
+		records = append(records, sflow.FlowRecord{
+			Header: sflow.RecordHeader{DataFormat: sflow.FLOW_TYPE_EXT_GATEWAY},
+			Data:   gateway,
+		})
+	}
+
+	return sflow.FlowSample{
+		Header: sflow.SampleHeader{
+			SampleSequenceNumber: sequence,
+			SourceIdValue:        m.InIf & 0xffffff,
+		},
+		SamplingRate: samplingRate,
+		SamplePool:   samplingRate,
+		Input:        m.InIf,
+		Output:       m.OutIf,
+		Records:      records,
+	}
+}
+
+// sflowHeaderLength returns the length of an sFlow datagram header for an agent address.
+func sflowHeaderLength(agent decoderutils.IPAddress) int {
+	return 6*4 + len(agent)
+}
+
+// encodeSFlow encodes each flow as a flow sample of its exporter.
+func (c *Converter) encodeSFlow(msg *utils.Message, flows []*protoproducer.ProtoProducerMessage) ([][]byte, error) {
+	uptime := c.uptime(msg.Received)
+	var datagrams [][]byte
+	for _, group := range groupByExporter(flows) {
+		addr := exporter(group[0])
+		if !addr.IsValid() {
+			addr = msg.Src.Addr().Unmap()
+		}
+		agent := decoderutils.IPAddress(addr.AsSlice())
+
+		var samples []interface{}
+		length := sflowHeaderLength(agent)
+		flush := func() error {
+			if len(samples) == 0 {
+				return nil
+			}
+			packet := sflow.Packet{
+				Version:        5,
+				AgentIP:        agent,
+				SequenceNumber: c.nextSequence(addr, 1),
+				Uptime:         uptime,
+				Samples:        samples,
+			}
+			b, err := sflow.EncodeMessage(&packet)
+			if err != nil {
+				return fmt.Errorf("encode sflow: %w", err)
+			}
+			datagrams = append(datagrams, b)
+			samples, length = nil, sflowHeaderLength(agent)
+			return nil
+		}
+
+		for _, m := range group {
+			sample := flowSample(m, c.nextSampleSequence(addr))
+			size, err := sampleLength(agent, sample)
+			if err != nil {
+				return nil, err
+			}
+			if length+size > c.mtu {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			samples = append(samples, sample)
+			length += size
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return datagrams, nil
+}
+
+// sampleLength returns the encoded length of a sample.
+func sampleLength(agent decoderutils.IPAddress, sample sflow.FlowSample) (int, error) {
+	b, err := sflow.EncodeMessage(&sflow.Packet{Version: 5, AgentIP: agent, Samples: []interface{}{sample}})
+	if err != nil {
+		return 0, fmt.Errorf("encode sflow sample: %w", err)
+	}
+	return len(b) - sflowHeaderLength(agent), nil
+}
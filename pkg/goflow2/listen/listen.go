@@ -5,6 +5,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+
+	"github.com/tgragnato/goflow/utils"
 )
 
 // ListenerConfig defines a parsed listen address.
@@ -16,6 +18,34 @@ type ListenerConfig struct {
 	NumWorkers int
 	Blocking   bool
 	QueueSize  int
+	Replicate  []*utils.ReplicateDestination
+	Spoof      bool
+
+	// pcap scheme: capture to replay, replay speed (0 as fast as possible) and destination ports
+	Path  string
+	Speed float64
+	Ports []uint16
+
+	// grpc scheme: server certificate and key, CA of the clients for mTLS, and concurrent streams per connection
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
+	MaxStreams  uint32
+}
+
+// parseSpeed parses a replay speed like 2x or 0.5, max replays as fast as possible.
+func parseSpeed(value string) (float64, error) {
+	if value == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if speed <= 0 {
+		return 0, fmt.Errorf("speed must be positive")
+	}
+	return speed, nil
 }
 
 // ParseListenAddresses parses a comma-separated list of listen URLs.
@@ -70,11 +100,69 @@ func ParseListenAddresses(spec string) ([]ListenerConfig, error) {
 			queueSize = 1000000
 		}
 
+		var replicate []*utils.ReplicateDestination
+		for _, spec := range listenAddrURL.Query()["replicate"] {
+			destination, err := utils.ParseReplicateDestination(spec)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing replicate in URL: %w", err)
+			}
+			replicate = append(replicate, destination)
+		}
+
+		var spoof bool
+		if listenAddrURL.Query().Has("spoof") {
+			spoof, err = strconv.ParseBool(listenAddrURL.Query().Get("spoof"))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing spoof in URL: %w", err)
+			}
+		}
+
+		if listenAddrURL.Scheme == "pcap" {
+			// pcap:///absolute/path or pcap://relative/path
+			path := listenAddrURL.Host + listenAddrURL.Path
+			if path == "" {
+				return nil, fmt.Errorf("missing capture path in URL: %s", listenAddress)
+			}
+			speed := 1.0
+			if listenAddrURL.Query().Has("speed") {
+				speed, err = parseSpeed(listenAddrURL.Query().Get("speed"))
+				if err != nil {
+					return nil, fmt.Errorf("error parsing speed in URL: %w", err)
+				}
+			}
+			var ports []uint16
+			for _, value := range listenAddrURL.Query()["port"] {
+				port, err := strconv.ParseUint(value, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing port in URL: %w", err)
+				}
+				ports = append(ports, uint16(port))
+			}
+			cfgs = append(cfgs, ListenerConfig{
+				Scheme:    listenAddrURL.Scheme,
+				Replicate: replicate,
+				Spoof:     spoof,
+				Path:      path,
+				Speed:     speed,
+				Ports:     ports,
+			})
+			continue
+		}
+
 		port, err := strconv.ParseUint(listenAddrURL.Port(), 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("port could not be converted to integer: %s: %w", listenAddrURL.Port(), err)
 		}
 
+		var maxStreams uint32
+		if listenAddrURL.Query().Has("max_streams") {
+			maxStreamsTmp, err := strconv.ParseUint(listenAddrURL.Query().Get("max_streams"), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing max_streams in URL: %w", err)
+			}
+			maxStreams = uint32(maxStreamsTmp)
+		}
+
 		cfgs = append(cfgs, ListenerConfig{
 			Scheme:     listenAddrURL.Scheme,
 			Hostname:   listenAddrURL.Hostname(),
@@ -83,6 +171,13 @@ func ParseListenAddresses(spec string) ([]ListenerConfig, error) {
 			NumWorkers: numWorkers,
 			Blocking:   isBlocking,
 			QueueSize:  queueSize,
+			Replicate:  replicate,
+			Spoof:      spoof,
+
+			TLSCert:     listenAddrURL.Query().Get("cert"),
+			TLSKey:      listenAddrURL.Query().Get("key"),
+			TLSClientCA: listenAddrURL.Query().Get("client_ca"),
+			MaxStreams:  maxStreams,
 		})
 	}
 
@@ -77,6 +77,13 @@ type FormatterMapper interface {
 	IsArray(name string) bool
 }
 
+// FormatterExtendedMapper is optionally implemented by a FormatterMapper to describe the tags
+// (used by the influx format) and the custom protobuf fields of the mapping.
+type FormatterExtendedMapper interface {
+	IsTag(name string) bool
+	Protobuf() []ProtobufFormatterConfig
+}
+
 // ProtoProducerConfig is the top level configuration for a general flow to protobuf producer
 type ProtoProducerConfig interface {
 	GetFormatter() FormatterMapper
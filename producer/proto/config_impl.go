@@ -3,6 +3,7 @@ package protoproducer
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
@@ -82,6 +83,7 @@ type FormatterConfig struct {
 	Render   map[string]RendererID     `yaml:"render"`
 	Rename   map[string]string         `yaml:"rename"`
 	Protobuf []ProtobufFormatterConfig `yaml:"protobuf"`
+	Tags     []string                  `yaml:"tags"` // fields used as tags by formats which distinguish them (eg: influx)
 }
 
 // ProducerConfig is the top-level config for protobuf producers.
@@ -139,6 +141,8 @@ type FormatterConfigMapper struct {
 	pbMap   map[string]ProtobufFormatterConfig
 	numToPb map[int32]ProtobufFormatterConfig
 	isSlice map[string]bool
+	tags    map[string]bool
+	pbList  []ProtobufFormatterConfig // custom protobuf fields ordered by index
 }
 
 func (f *FormatterConfigMapper) Keys() []string {
@@ -173,6 +177,14 @@ func (f *FormatterConfigMapper) IsArray(name string) bool {
 	return f.isSlice[name]
 }
 
+func (f *FormatterConfigMapper) IsTag(name string) bool {
+	return f.tags[name]
+}
+
+func (f *FormatterConfigMapper) Protobuf() []ProtobufFormatterConfig {
+	return f.pbList
+}
+
 type NetFlowMapper struct {
 	data map[string]*DataMap // maps field to destination
 }
@@ -465,8 +477,23 @@ func mapFormat(cfg *ProducerConfig) (*FormatterConfigMapper, error) {
 			formatterMapped.fields = cfgFormatter.Fields
 		}
 
+		// populate tags, which must be part of the output fields
+		formatterMapped.tags = make(map[string]bool)
+		for _, tag := range cfgFormatter.Tags {
+			if !slices.Contains(formatterMapped.fields, tag) {
+				return formatterMapped, fmt.Errorf("tag %s is not a formatter field", tag)
+			}
+			formatterMapped.tags[tag] = true
+		}
+
 		formatterMapped.pbMap = pbMap
 		formatterMapped.numToPb = numToPb
+		for _, pbField := range numToPb {
+			formatterMapped.pbList = append(formatterMapped.pbList, pbField)
+		}
+		slices.SortFunc(formatterMapped.pbList, func(a, b ProtobufFormatterConfig) int {
+			return int(a.Index - b.Index)
+		})
 
 	} else {
 		formatterMapped.fields = fields
@@ -306,3 +306,82 @@ func (m *ProtoProducerMessage) FormatMessageReflectCustom(ext, quotes, sep, sign
 
 	return strings.Join(fstr, sep)
 }
+
+// FormatFields returns the configured output fields in order with their rendered values.
+// Unlike the JSON and text representations, absent fields are kept with a nil value so that
+// positional formats get a stable set of columns. Arrays are rendered as []interface{}.
+func (m *ProtoProducerMessage) FormatFields() ([]string, []interface{}) {
+	vfm := reflect.Indirect(reflect.ValueOf(m))
+	unkMap := m.mapUnknown()
+
+	fields := m.formatter.Fields()
+	names := make([]string, len(fields))
+	values := make([]interface{}, len(fields))
+	for i, s := range fields {
+		fieldName := s
+		names[i] = s
+		if fieldRename, ok := m.formatter.Rename(s); ok && fieldRename != "" {
+			names[i] = fieldRename
+		}
+		fieldNameMap, isMapped := m.formatter.Remap(fieldName)
+		if isMapped && fieldNameMap != "" {
+			fieldName = fieldNameMap
+		}
+
+		renderer, okRenderer := m.formatter.Render(fieldName)
+		if !okRenderer {
+			renderer = NilRenderer
+		}
+
+		fieldValue := vfm.FieldByName(fieldName)
+		if !fieldValue.IsValid() {
+			if unkField, ok := unkMap[s]; ok {
+				fieldValue = reflect.ValueOf(unkField)
+			} else if isMapped { // custom protobuf field absent from this message
+				continue
+			}
+		}
+
+		if m.formatter.IsArray(fieldName) {
+			var items []interface{}
+			if fieldValue.IsValid() {
+				for j := 0; j < fieldValue.Len(); j++ {
+					if rendered := renderer(m, fieldName, fieldValue.Index(j).Interface()); rendered != nil {
+						items = append(items, rendered)
+					}
+				}
+			}
+			values[i] = items
+			continue
+		}
+
+		var val interface{}
+		if fieldValue.IsValid() {
+			val = fieldValue.Interface()
+		}
+		values[i] = renderer(m, fieldName, val)
+	}
+	return names, values
+}
+
+// FormatTags reports, for each field returned by FormatFields, whether it is configured as a tag.
+func (m *ProtoProducerMessage) FormatTags() []bool {
+	fields := m.formatter.Fields()
+	tags := make([]bool, len(fields))
+	if ext, ok := m.formatter.(FormatterExtendedMapper); ok {
+		for i, s := range fields {
+			tags[i] = ext.IsTag(s)
+		}
+	}
+	return tags
+}
+
+// CustomFields returns the custom protobuf fields of the mapping ordered by index,
+// and their values in the message: uint64 for varints, []byte otherwise, []interface{} for arrays.
+func (m *ProtoProducerMessage) CustomFields() ([]ProtobufFormatterConfig, map[string]interface{}) {
+	var custom []ProtobufFormatterConfig
+	if ext, ok := m.formatter.(FormatterExtendedMapper); ok {
+		custom = ext.Protobuf()
+	}
+	return custom, m.mapUnknown()
+}
@@ -69,3 +69,127 @@ func TestMarshalJSON(t *testing.T) {
 		t.Fatalf("expected %s, got %s", want, string(out))
 	}
 }
+
+func TestFormatFields(t *testing.T) {
+	t.Parallel()
+	var m ProtoProducerMessage
+
+	m.formatter = &FormatterConfigMapper{
+		fields: []string{"Etype", "Bytes", "test1", "as_path"},
+		rename: map[string]string{
+			"Etype": "etype",
+		},
+		reMap: map[string]string{
+			"test1":   "",
+			"as_path": "AsPath",
+		},
+		numToPb: map[int32]ProtobufFormatterConfig{
+			100: {
+				Name:  "test1",
+				Index: 100,
+				Type:  "varint",
+			},
+		},
+		render: map[string]RenderFunc{
+			"Etype": EtypeRenderer,
+		},
+		isSlice: map[string]bool{
+			"AsPath": true,
+		},
+	}
+	m.Etype = 0x800
+	m.Bytes = 1500
+	m.AsPath = []uint32{65000, 65001}
+
+	names, values := m.FormatFields()
+	wantNames := []string{"etype", "Bytes", "test1", "as_path"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("expected %v, got %v", wantNames, names)
+	}
+	for i := range wantNames {
+		if names[i] != wantNames[i] {
+			t.Fatalf("expected %v, got %v", wantNames, names)
+		}
+	}
+	if values[0] != "IPv4" {
+		t.Fatalf("expected rendered etype, got %v", values[0])
+	}
+	if values[1] != uint64(1500) {
+		t.Fatalf("expected 1500 bytes, got %v", values[1])
+	}
+	if values[2] != nil {
+		t.Fatalf("expected nil for absent field, got %v", values[2])
+	}
+	path, ok := values[3].([]interface{})
+	if !ok || len(path) != 2 || path[0] != uint32(65000) || path[1] != uint32(65001) {
+		t.Fatalf("expected rendered AS path, got %v", values[3])
+	}
+}
+
+// baseFormatter only implements FormatterMapper.
+type baseFormatter struct {
+	FormatterMapper
+}
+
+func TestFormatTags(t *testing.T) {
+	t.Parallel()
+	cfg := &ProducerConfig{
+		Formatter: FormatterConfig{
+			Fields: []string{"sampler_address", "proto", "bytes"},
+			Tags:   []string{"sampler_address", "proto"},
+		},
+	}
+	formatter, err := mapFormat(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := ProtoProducerMessage{formatter: formatter}
+	tags := m.FormatTags()
+	if len(tags) != 3 || !tags[0] || !tags[1] || tags[2] {
+		t.Fatalf("expected [true true false], got %v", tags)
+	}
+	// the tags are optional for the formatters
+	m.formatter = baseFormatter{formatter}
+	if tags := m.FormatTags(); len(tags) != 3 || tags[0] || tags[1] || tags[2] {
+		t.Fatalf("expected no tag, got %v", tags)
+	}
+	if custom, _ := m.CustomFields(); custom != nil {
+		t.Fatalf("expected no custom field, got %v", custom)
+	}
+
+	cfg.Formatter.Tags = []string{"src_addr"}
+	if _, err := mapFormat(cfg); err == nil {
+		t.Fatal("expected error for a tag absent from fields")
+	}
+}
+
+func TestRenderedType(t *testing.T) {
+	t.Parallel()
+	formatter, err := mapFormat(&ProducerConfig{
+		Formatter: FormatterConfig{
+			Fields: []string{"src_addr", "time_flow_start_ns", "proto", "type", "bytes", "as_path", "src_mac", "mpls_ip", "custom"},
+			Render: map[string]RendererID{"time_flow_start_ns": RendererDateTimeNano},
+			Protobuf: []ProtobufFormatterConfig{
+				{Name: "custom", Index: 1000, Type: "varint"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("map format: %v", err)
+	}
+	for field, expected := range map[string]string{
+		"src_addr":           "ip",
+		"time_flow_start_ns": "datetime",
+		"proto":              "string",
+		"type":               "string",
+		"bytes":              "integer",
+		"as_path":            "integer",
+		"src_mac":            "string",
+		"mpls_ip":            "ip",
+		"custom":             "",
+	} {
+		if typ := RenderedType(formatter, field); typ != expected {
+			t.Fatalf("expected %q type for %s, got %q", expected, field, typ)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/tgragnato/goflow/decoders/utils"
 	flowmessage "github.com/tgragnato/goflow/pb"
 	"github.com/tgragnato/goflow/producer"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 )
 
@@ -224,6 +225,14 @@ func ConvertNTPEpoch(ntpTime uint64) uint64 {
 	return seconds*1e9 + uint64(fraction)
 }
 
+// UptimeDiffNs returns how long before the export a switched uptime was recorded,
+// in nanoseconds. Both values are milliseconds of the exporter's 32-bit uptime:
+// the modular difference stays correct when the counter wraps (~49.7 days) between
+// the flow and the export, and is negative for flows reported slightly ahead of the header.
+func UptimeDiffNs(uptime, switched uint32) int64 {
+	return int64(int32(uptime-switched)) * 1e6
+}
+
 // ConvertNetFlowDataSet maps a data record into a flow message.
 func ConvertNetFlowDataSet(flowMessage *ProtoProducerMessage, version uint16, baseTime uint32, uptime uint32, record []netflow.DataField, mapperNetFlow TemplateMapper, mapperSFlow PacketMapper) error {
 	var time uint64
@@ -267,6 +276,52 @@ func ConvertNetFlowDataSet(flowMessage *ProtoProducerMessage, version uint16, ba
 				return wrapFieldErr(err)
 			}
 
+		// Application
+		case netflow.IPFIX_FIELD_applicationId:
+			if len(v) <= 8 {
+				if err := DecodeUNumber(v, &(flowMessage.ApplicationId)); err != nil {
+					return wrapFieldErr(err)
+				}
+			}
+		case netflow.IPFIX_FIELD_applicationName:
+			flowMessage.ApplicationName = string(bytes.TrimRight(v, "\x00"))
+
+		// Firewall events (NSEL)
+		case netflow.NFV9_FIELD_NF_F_FW_EVENT, netflow.NFV9_FIELD_NF_F_FW_EVENT_84:
+			if err := DecodeUNumber(v, &(flowMessage.FwEvent)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_FW_EXT_EVENT:
+			if err := DecodeUNumber(v, &(flowMessage.FwExtEvent)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_XLATE_SRC_ADDR_IPV4, netflow.NFV9_FIELD_NF_F_XLATE_SRC_ADDR_IPV6, netflow.NFV9_FIELD_NF_F_XLATE_SRC_ADDR_84:
+			flowMessage.XlateSrcAddr = v
+		case netflow.NFV9_FIELD_NF_F_XLATE_DST_ADDR_IPV4, netflow.NFV9_FIELD_NF_F_XLATE_DST_ADDR_IPV6, netflow.NFV9_FIELD_NF_F_XLATE_DST_ADDR_84:
+			flowMessage.XlateDstAddr = v
+		case netflow.NFV9_FIELD_NF_F_XLATE_SRC_PORT, netflow.NFV9_FIELD_NF_F_XLATE_SRC_PORT_84:
+			if err := DecodeUNumber(v, &(flowMessage.XlateSrcPort)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_XLATE_DST_PORT, netflow.NFV9_FIELD_NF_F_XLATE_DST_PORT_84:
+			if err := DecodeUNumber(v, &(flowMessage.XlateDstPort)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_INGRESS_ACL_ID:
+			flowMessage.IngressAclId = DecodeACLID(v)
+		case netflow.NFV9_FIELD_NF_F_EGRESS_ACL_ID:
+			flowMessage.EgressAclId = DecodeACLID(v)
+		case netflow.NFV9_FIELD_NF_F_FWD_FLOW_DELTA_BYTES:
+			if err := DecodeUNumber(v, &(flowMessage.InitiatorOctets)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_REV_FLOW_DELTA_BYTES:
+			if err := DecodeUNumber(v, &(flowMessage.ResponderOctets)); err != nil {
+				return wrapFieldErr(err)
+			}
+		case netflow.NFV9_FIELD_NF_F_USERNAME:
+			flowMessage.Username = string(bytes.TrimRight(v, "\x00"))
+
 		// Statistics
 		case netflow.NFV9_FIELD_IN_BYTES:
 			if err := DecodeUNumber(v, &(flowMessage.Bytes)); err != nil {
@@ -511,22 +566,30 @@ func ConvertNetFlowDataSet(flowMessage *ProtoProducerMessage, version uint16, ba
 			switch version {
 			case 9:
 				// NetFlow v9 time works with a differential based on router's uptime
-				uptimeNs := uint64(uptime) * 1e6 // uptime is in milliseconds in NetFlow v9, converts to nanoseconds
 				switch df.Type {
 				case netflow.NFV9_FIELD_FIRST_SWITCHED:
 					var timeFirstSwitched uint32
 					if err := DecodeUNumber(v, &timeFirstSwitched); err != nil {
 						return wrapFieldErr(err)
 					}
-					timeDiff := (uptimeNs - uint64(timeFirstSwitched)*1e6)
-					flowMessage.TimeFlowStartNs = baseTimeNs - timeDiff
+					flowMessage.TimeFlowStartNs = uint64(int64(baseTimeNs) - UptimeDiffNs(uptime, timeFirstSwitched))
 				case netflow.NFV9_FIELD_LAST_SWITCHED:
 					var timeLastSwitched uint32
 					if err := DecodeUNumber(v, &timeLastSwitched); err != nil {
 						return wrapFieldErr(err)
 					}
-					timeDiff := (uptimeNs - uint64(timeLastSwitched)*1e6)
-					flowMessage.TimeFlowEndNs = baseTimeNs - timeDiff
+					flowMessage.TimeFlowEndNs = uint64(int64(baseTimeNs) - UptimeDiffNs(uptime, timeLastSwitched))
+				// NSEL carries absolute timestamps in milliseconds
+				case netflow.NFV9_FIELD_NF_F_FLOW_CREATE_TIME_MSEC:
+					if err := DecodeUNumber(v, &time); err != nil {
+						return wrapFieldErr(err)
+					}
+					flowMessage.TimeFlowStartNs = time * 1000000
+				case netflow.NFV9_FIELD_NF_F_FLOW_END_TIME_MSEC:
+					if err := DecodeUNumber(v, &time); err != nil {
+						return wrapFieldErr(err)
+					}
+					flowMessage.TimeFlowEndNs = time * 1000000
 				}
 			case 10:
 				switch df.Type {
@@ -599,10 +662,93 @@ func ConvertNetFlowDataSet(flowMessage *ProtoProducerMessage, version uint16, ba
 		}
 
 	}
+	// NSEL exporters report bytes as initiator/responder deltas only
+	if flowMessage.Bytes == 0 {
+		flowMessage.Bytes = flowMessage.InitiatorOctets + flowMessage.ResponderOctets
+	}
 	return nil
 }
 
+// DecodeACLID splits an NSEL ACL identifier into its 32-bit components
+// (ACL hash, ACE hash and extended ACE hash).
+func DecodeACLID(v []byte) []uint32 {
+	aclId := make([]uint32, 0, len(v)/4)
+	for i := 0; i+4 <= len(v); i += 4 {
+		aclId = append(aclId, binary.BigEndian.Uint32(v[i:i+4]))
+	}
+	return aclId
+}
+
+var (
+	// biflowSwappedFields pairs source and destination IEs exchanged in the reverse direction
+	biflowSwappedFields = map[uint16]uint16{
+		netflow.IPFIX_FIELD_sourceIPv4Address:           netflow.IPFIX_FIELD_destinationIPv4Address,
+		netflow.IPFIX_FIELD_destinationIPv4Address:      netflow.IPFIX_FIELD_sourceIPv4Address,
+		netflow.IPFIX_FIELD_sourceIPv6Address:           netflow.IPFIX_FIELD_destinationIPv6Address,
+		netflow.IPFIX_FIELD_destinationIPv6Address:      netflow.IPFIX_FIELD_sourceIPv6Address,
+		netflow.IPFIX_FIELD_sourceIPv4PrefixLength:      netflow.IPFIX_FIELD_destinationIPv4PrefixLength,
+		netflow.IPFIX_FIELD_destinationIPv4PrefixLength: netflow.IPFIX_FIELD_sourceIPv4PrefixLength,
+		netflow.IPFIX_FIELD_sourceIPv6PrefixLength:      netflow.IPFIX_FIELD_destinationIPv6PrefixLength,
+		netflow.IPFIX_FIELD_destinationIPv6PrefixLength: netflow.IPFIX_FIELD_sourceIPv6PrefixLength,
+		netflow.IPFIX_FIELD_sourceTransportPort:         netflow.IPFIX_FIELD_destinationTransportPort,
+		netflow.IPFIX_FIELD_destinationTransportPort:    netflow.IPFIX_FIELD_sourceTransportPort,
+		netflow.IPFIX_FIELD_ingressInterface:            netflow.IPFIX_FIELD_egressInterface,
+		netflow.IPFIX_FIELD_egressInterface:             netflow.IPFIX_FIELD_ingressInterface,
+		netflow.IPFIX_FIELD_bgpSourceAsNumber:           netflow.IPFIX_FIELD_bgpDestinationAsNumber,
+		netflow.IPFIX_FIELD_bgpDestinationAsNumber:      netflow.IPFIX_FIELD_bgpSourceAsNumber,
+		netflow.IPFIX_FIELD_sourceMacAddress:            netflow.IPFIX_FIELD_destinationMacAddress,
+		netflow.IPFIX_FIELD_destinationMacAddress:       netflow.IPFIX_FIELD_sourceMacAddress,
+		netflow.IPFIX_FIELD_postSourceMacAddress:        netflow.IPFIX_FIELD_postDestinationMacAddress,
+		netflow.IPFIX_FIELD_postDestinationMacAddress:   netflow.IPFIX_FIELD_postSourceMacAddress,
+	}
+	// biflowForwardOnlyFields are never carried over to the reverse direction
+	biflowForwardOnlyFields = map[uint16]bool{
+		netflow.IPFIX_FIELD_octetDeltaCount:      true,
+		netflow.IPFIX_FIELD_packetDeltaCount:     true,
+		netflow.IPFIX_FIELD_postOctetDeltaCount:  true,
+		netflow.IPFIX_FIELD_postPacketDeltaCount: true,
+		netflow.IPFIX_FIELD_octetTotalCount:      true,
+		netflow.IPFIX_FIELD_packetTotalCount:     true,
+		netflow.IPFIX_FIELD_tcpControlBits:       true,
+	}
+)
+
+// ReverseIPFIXRecord builds the reverse direction of an RFC 5103 biflow record.
+// Reverse information elements (PEN 29305) replace their forward counterpart,
+// source and destination fields are swapped and forward counters are dropped.
+// It returns false when the record does not contain reverse information elements.
+func ReverseIPFIXRecord(record []netflow.DataField) ([]netflow.DataField, bool) {
+	reversed := make(map[uint16]bool)
+	for _, df := range record {
+		if df.PenProvided && df.Pen == netflow.IPFIX_PEN_REVERSE {
+			reversed[df.Type] = true
+		}
+	}
+	if len(reversed) == 0 {
+		return nil, false
+	}
+
+	reverseRecord := make([]netflow.DataField, 0, len(record))
+	for _, df := range record {
+		switch {
+		case df.PenProvided && df.Pen == netflow.IPFIX_PEN_REVERSE:
+			df.PenProvided = false
+			df.Pen = 0
+		case df.PenProvided:
+		case biflowForwardOnlyFields[df.Type] || reversed[df.Type]:
+			continue
+		default:
+			if swapped, ok := biflowSwappedFields[df.Type]; ok {
+				df.Type = swapped
+			}
+		}
+		reverseRecord = append(reverseRecord, df)
+	}
+	return reverseRecord, true
+}
+
 // SearchNetFlowDataSetsRecords converts data records into producer messages.
+// IPFIX biflow records produce an additional message for the reverse direction.
 func SearchNetFlowDataSetsRecords(version uint16, baseTime uint32, uptime uint32, dataRecords []netflow.DataRecord, mapperNetFlow TemplateMapper, mapperSFlow PacketMapper) (flowMessageSet []producer.ProducerMessage, err error) {
 	for _, record := range dataRecords {
 		fmsg := protoMessagePool.Get().(*ProtoProducerMessage)
@@ -613,6 +759,27 @@ func SearchNetFlowDataSetsRecords(version uint16, baseTime uint32, uptime uint32
 		if fmsg != nil {
 			flowMessageSet = append(flowMessageSet, fmsg)
 		}
+
+		if version != 10 {
+			continue
+		}
+		reverseRecord, ok := ReverseIPFIXRecord(record.Values)
+		if !ok {
+			continue
+		}
+		rmsg := protoMessagePool.Get().(*ProtoProducerMessage)
+		rmsg.Reset()
+		if err := ConvertNetFlowDataSet(rmsg, version, baseTime, uptime, reverseRecord, mapperNetFlow, mapperSFlow); err != nil {
+			protoMessagePool.Put(rmsg)
+			return flowMessageSet, fmt.Errorf("netflow reverse data record: %w", err)
+		}
+		// a biflow without reverse traffic only describes the forward direction
+		if rmsg.Bytes == 0 && rmsg.Packets == 0 {
+			protoMessagePool.Put(rmsg)
+			continue
+		}
+		rmsg.BiflowReverse = true
+		flowMessageSet = append(flowMessageSet, rmsg)
 	}
 	return flowMessageSet, nil
 }
@@ -658,6 +825,77 @@ func SearchNetFlowOptionDataSets(dataFlowSet []netflow.OptionsDataFlowSet) (samp
 	return samplingRate, found, err
 }
 
+// SearchNetFlowOptionDataSetsApplications extracts application id to name mappings from options sets.
+// The application name (96) is preferred over the description (94).
+func SearchNetFlowOptionDataSetsApplications(dataFlowSet []netflow.OptionsDataFlowSet) (map[uint64]string, error) {
+	var applicationNames map[uint64]string
+	for _, dataFlowSetItem := range dataFlowSet {
+		for _, record := range dataFlowSetItem.Records {
+			found, value := NetFlowLookFor(record.ScopesValues, netflow.IPFIX_FIELD_applicationId)
+			if !found {
+				found, value = NetFlowLookFor(record.OptionsValues, netflow.IPFIX_FIELD_applicationId)
+			}
+			v, ok := value.([]byte)
+			if !found || !ok || len(v) > 8 {
+				continue
+			}
+			var applicationId uint64
+			if err := DecodeUNumber(v, &applicationId); err != nil {
+				return applicationNames, fmt.Errorf("netflow options field %d: %w", netflow.IPFIX_FIELD_applicationId, err)
+			}
+			name := optionsString(record.OptionsValues, netflow.IPFIX_FIELD_applicationName)
+			if name == "" {
+				name = optionsString(record.OptionsValues, netflow.IPFIX_FIELD_applicationDescription)
+			}
+			if name == "" {
+				continue
+			}
+			if applicationNames == nil {
+				applicationNames = make(map[uint64]string)
+			}
+			applicationNames[applicationId] = name
+		}
+	}
+	return applicationNames, nil
+}
+
+func optionsString(dataFields []netflow.DataField, typeId uint16) string {
+	for _, dataField := range dataFields {
+		if dataField.PenProvided || dataField.Type != typeId {
+			continue
+		}
+		if v, ok := dataField.Value.([]byte); ok {
+			return string(bytes.TrimRight(v, "\x00"))
+		}
+	}
+	return ""
+}
+
+// ProcessApplicationNames stores application mappings found in options sets
+// and fills in the application name of messages carrying only an identifier.
+func ProcessApplicationNames(optionDataFlowSet []netflow.OptionsDataFlowSet, ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationStore applications.Store, flowMessageSet []producer.ProducerMessage) error {
+	if applicationStore == nil {
+		return nil
+	}
+	applicationNames, err := SearchNetFlowOptionDataSetsApplications(optionDataFlowSet)
+	if err != nil {
+		return fmt.Errorf("application option data sets: %w", err)
+	}
+	for applicationId, name := range applicationNames {
+		_ = applicationStore.Set(ctx, version, obsDomainId, applicationId, name)
+	}
+	for _, msg := range flowMessageSet {
+		fmsg, ok := msg.(*ProtoProducerMessage)
+		if !ok || fmsg.ApplicationId == 0 || fmsg.ApplicationName != "" {
+			continue
+		}
+		if name, ok, _ := applicationStore.Get(ctx, version, obsDomainId, fmsg.ApplicationId); ok {
+			fmsg.ApplicationName = name
+		}
+	}
+	return nil
+}
+
 // SplitNetFlowSets partitions v9 flow sets by type.
 func SplitNetFlowSets(packetNFv9 netflow.NFv9Packet) ([]netflow.DataFlowSet, []netflow.TemplateFlowSet, []netflow.NFv9OptionsTemplateFlowSet, []netflow.OptionsDataFlowSet) {
 	var dataFlowSet []netflow.DataFlowSet
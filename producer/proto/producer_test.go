@@ -2,11 +2,18 @@ package protoproducer
 
 import (
 	"bytes"
+	"net/netip"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
 	"github.com/tgragnato/goflow/decoders/sflow"
+	flowmessage "github.com/tgragnato/goflow/pb"
+	"github.com/tgragnato/goflow/producer"
+	"github.com/tgragnato/goflow/utils/exporters"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 )
 
@@ -271,6 +278,244 @@ func getSflowPacket() *sflow.Packet {
 	return &pkt
 }
 
+func TestProcessApplicationNames(t *testing.T) {
+	t.Parallel()
+	options := []netflow.OptionsDataFlowSet{
+		netflow.OptionsDataFlowSet{
+			Records: []netflow.OptionsDataRecord{
+				netflow.OptionsDataRecord{
+					ScopesValues: []netflow.DataField{
+						netflow.DataField{
+							Type:  netflow.IPFIX_FIELD_applicationId,
+							Value: []byte{0x03, 0x00, 0x00, 0x50},
+						},
+					},
+					OptionsValues: []netflow.DataField{
+						netflow.DataField{
+							Type:  netflow.IPFIX_FIELD_applicationName,
+							Value: []byte("http\x00\x00"),
+						},
+						netflow.DataField{
+							Type:  netflow.IPFIX_FIELD_applicationDescription,
+							Value: []byte("Hypertext Transfer Protocol"),
+						},
+					},
+				},
+				netflow.OptionsDataRecord{
+					OptionsValues: []netflow.DataField{
+						netflow.DataField{
+							Type:  netflow.IPFIX_FIELD_applicationId,
+							Value: []byte{0x03, 0x00, 0x00, 0x35},
+						},
+						netflow.DataField{
+							Type:  netflow.IPFIX_FIELD_applicationDescription,
+							Value: []byte("Domain Name System"),
+						},
+					},
+				},
+			},
+		},
+	}
+	store := applications.NewApplicationFlowStore()
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+	if err := ProcessApplicationNames(options, ctx, 10, 1, store, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name, ok, _ := store.Get(ctx, 10, 1, 0x03000035); !ok || name != "Domain Name System" {
+		t.Fatalf("expected description fallback, got %q (%v)", name, ok)
+	}
+
+	var flowMessage ProtoProducerMessage
+	err := ConvertNetFlowDataSet(&flowMessage, 10, 1704067200, 0, []netflow.DataField{
+		netflow.DataField{
+			Type:  netflow.IPFIX_FIELD_applicationId,
+			Value: []byte{0x03, 0x00, 0x00, 0x50},
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flowMessage.ApplicationId != 0x03000050 {
+		t.Fatalf("expected ApplicationId %d, got %d", 0x03000050, flowMessage.ApplicationId)
+	}
+	if err := ProcessApplicationNames(nil, ctx, 10, 1, store, []producer.ProducerMessage{&flowMessage}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flowMessage.ApplicationName != "http" {
+		t.Fatalf("expected ApplicationName http, got %q", flowMessage.ApplicationName)
+	}
+}
+
+func TestConvertNetFlowNSEL(t *testing.T) {
+	t.Parallel()
+	var flowMessage ProtoProducerMessage
+	err := ConvertNetFlowDataSet(&flowMessage, 9, 1704067200, 2000, []netflow.DataField{
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_FW_EVENT,
+			Value: []byte{0x03},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_FW_EXT_EVENT,
+			Value: []byte{0x03, 0xe9}, // 1001
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_XLATE_SRC_ADDR_IPV4,
+			Value: []byte{192, 0, 2, 1},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_XLATE_SRC_PORT,
+			Value: []byte{0x1f, 0x90},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_INGRESS_ACL_ID,
+			Value: []byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_FWD_FLOW_DELTA_BYTES,
+			Value: []byte{0x0, 0x0, 0x0, 0x64},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_REV_FLOW_DELTA_BYTES,
+			Value: []byte{0x0, 0x0, 0x0, 0xc8},
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_USERNAME,
+			Value: []byte("alice\x00\x00"),
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_NF_F_FLOW_CREATE_TIME_MSEC,
+			Value: []byte{0x0, 0x0, 0x01, 0x8c, 0xc2, 0x51, 0xf4, 0x00}, // 1704067200000
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flowMessage.FwEvent != 3 || flowMessage.FwExtEvent != 1001 {
+		t.Fatalf("expected events 3/1001, got %d/%d", flowMessage.FwEvent, flowMessage.FwExtEvent)
+	}
+	if got := RenderIP(flowMessage.XlateSrcAddr); got != "192.0.2.1" || flowMessage.XlateSrcPort != 8080 {
+		t.Fatalf("expected translation 192.0.2.1:8080, got %s:%d", got, flowMessage.XlateSrcPort)
+	}
+	if !reflect.DeepEqual(flowMessage.IngressAclId, []uint32{1, 2, 3}) {
+		t.Fatalf("expected IngressAclId %v, got %v", []uint32{1, 2, 3}, flowMessage.IngressAclId)
+	}
+	if flowMessage.Bytes != 300 {
+		t.Fatalf("expected Bytes 300, got %d", flowMessage.Bytes)
+	}
+	if flowMessage.Username != "alice" {
+		t.Fatalf("expected Username alice, got %q", flowMessage.Username)
+	}
+	if flowMessage.TimeFlowStartNs != uint64(1704067200)*1e9 {
+		t.Fatalf("expected TimeFlowStartNs %d, got %d", uint64(1704067200)*1e9, flowMessage.TimeFlowStartNs)
+	}
+	if got := FirewallEventRenderer(&flowMessage, "fw_event_name", nil); got != "DeniedIngressACL" {
+		t.Fatalf("expected DeniedIngressACL, got %v", got)
+	}
+	if got := FirewallEventRenderer(&flowMessage, "FwEvent", flowMessage.FwEvent); got != "FlowDenied" {
+		t.Fatalf("expected FlowDenied, got %v", got)
+	}
+}
+
+func TestProcessMessageIPFIXBiflow(t *testing.T) {
+	t.Parallel()
+	records := []netflow.DataRecord{
+		netflow.DataRecord{
+			Values: []netflow.DataField{
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_sourceIPv4Address,
+					Value: []byte{10, 0, 0, 1},
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_destinationIPv4Address,
+					Value: []byte{10, 0, 0, 2},
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_sourceTransportPort,
+					Value: []byte{0xc3, 0x50}, // 50000
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_destinationTransportPort,
+					Value: []byte{0x01, 0xbb}, // 443
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_vlanId,
+					Value: []byte{0x0, 0x64}, // 100
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_octetDeltaCount,
+					Value: []byte{0x0, 0x0, 0x03, 0xe8}, // 1000
+				},
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_packetDeltaCount,
+					Value: []byte{0x0, 0x0, 0x0, 0x0a},
+				},
+				netflow.DataField{
+					PenProvided: true,
+					Pen:         netflow.IPFIX_PEN_REVERSE,
+					Type:        netflow.IPFIX_FIELD_octetDeltaCount,
+					Value:       []byte{0x0, 0x0, 0x4e, 0x20}, // 20000
+				},
+				netflow.DataField{
+					PenProvided: true,
+					Pen:         netflow.IPFIX_PEN_REVERSE,
+					Type:        netflow.IPFIX_FIELD_packetDeltaCount,
+					Value:       []byte{0x0, 0x0, 0x0, 0x14},
+				},
+			},
+		},
+		netflow.DataRecord{
+			// reverse elements without reverse traffic
+			Values: []netflow.DataField{
+				netflow.DataField{
+					Type:  netflow.IPFIX_FIELD_octetDeltaCount,
+					Value: []byte{0x0, 0x0, 0x0, 0x40},
+				},
+				netflow.DataField{
+					PenProvided: true,
+					Pen:         netflow.IPFIX_PEN_REVERSE,
+					Type:        netflow.IPFIX_FIELD_octetDeltaCount,
+					Value:       []byte{0x0, 0x0, 0x0, 0x0},
+				},
+			},
+		},
+	}
+	pktipfix := netflow.IPFIXPacket{
+		FlowSets: []interface{}{
+			netflow.DataFlowSet{
+				Records: records,
+			},
+		},
+	}
+	msgs, err := ProcessMessageIPFIXConfig(&pktipfix, netflow.FlowContext{RouterKey: "router1"}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(msgs))
+	}
+	fwd := msgs[0].(*ProtoProducerMessage)
+	rev := msgs[1].(*ProtoProducerMessage)
+	if fwd.BiflowReverse || fwd.Bytes != 1000 || fwd.Packets != 10 {
+		t.Fatalf("expected forward 1000 bytes/10 packets, got %d/%d (reverse %v)", fwd.Bytes, fwd.Packets, fwd.BiflowReverse)
+	}
+	if !rev.BiflowReverse || rev.Bytes != 20000 || rev.Packets != 20 {
+		t.Fatalf("expected reverse 20000 bytes/20 packets, got %d/%d (reverse %v)", rev.Bytes, rev.Packets, rev.BiflowReverse)
+	}
+	if RenderIP(rev.SrcAddr) != "10.0.0.2" || RenderIP(rev.DstAddr) != "10.0.0.1" {
+		t.Fatalf("expected reverse 10.0.0.2 -> 10.0.0.1, got %s -> %s", RenderIP(rev.SrcAddr), RenderIP(rev.DstAddr))
+	}
+	if rev.SrcPort != 443 || rev.DstPort != 50000 {
+		t.Fatalf("expected reverse ports 443 -> 50000, got %d -> %d", rev.SrcPort, rev.DstPort)
+	}
+	// the VLAN is not a direction, it is kept as is
+	if rev.VlanId != 100 || rev.SrcVlan != 100 || rev.DstVlan != 0 {
+		t.Fatalf("expected the reverse VLAN 100, got %d (src %d, dst %d)", rev.VlanId, rev.SrcVlan, rev.DstVlan)
+	}
+	if msgs[2].(*ProtoProducerMessage).BiflowReverse {
+		t.Fatal("expected no reverse message without reverse traffic")
+	}
+}
+
 func TestNetFlowV9Time(t *testing.T) {
 	t.Parallel()
 	// This test ensures the NetFlow v9 timestamps are properly calculated.
@@ -292,6 +537,182 @@ func TestNetFlowV9Time(t *testing.T) {
 	}
 }
 
+func TestNetFlowV9UptimeWrap(t *testing.T) {
+	t.Parallel()
+	// The exporter's uptime wrapped 1 second ago (uptime 1000ms),
+	// the flow started 500ms before the wrap and ended 500ms after it.
+	var flowMessage ProtoProducerMessage
+	err := ConvertNetFlowDataSet(&flowMessage, 9, 1704067200, 1000, []netflow.DataField{
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_FIRST_SWITCHED,
+			Value: []byte{0xff, 0xff, 0xfe, 0x0b}, // 2^32 - 501
+		},
+		netflow.DataField{
+			Type:  netflow.NFV9_FIELD_LAST_SWITCHED,
+			Value: []byte{0x0, 0x0, 0x01, 0xf4}, // 500
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := uint64(1704067200)*1e9 - 1501*1e6; flowMessage.TimeFlowStartNs != expected {
+		t.Fatalf("expected TimeFlowStartNs %d, got %d", expected, flowMessage.TimeFlowStartNs)
+	}
+	if expected := uint64(1704067200)*1e9 - 500*1e6; flowMessage.TimeFlowEndNs != expected {
+		t.Fatalf("expected TimeFlowEndNs %d, got %d", expected, flowMessage.TimeFlowEndNs)
+	}
+}
+
+func TestProtoProducerTimeCorrection(t *testing.T) {
+	t.Parallel()
+	tr := uint64(1704067200) * 1e9
+
+	// exporter clock one hour ahead
+	p := &ProtoProducer{maxClockSkew: time.Minute}
+	var flowMessage ProtoProducerMessage
+	flowMessage.TimeFlowStartNs = tr + 3600*1e9 - 10*1e9
+	flowMessage.TimeFlowEndNs = tr + 3600*1e9
+	p.correctTime(&flowMessage, tr+3600*1e9, tr, nil)
+	if flowMessage.TimeFlowStartNs != tr-10*1e9 || flowMessage.TimeFlowEndNs != tr {
+		t.Fatalf("expected skew corrected times, got %d-%d", flowMessage.TimeFlowStartNs, flowMessage.TimeFlowEndNs)
+	}
+
+	// small skew below the threshold is clamped instead
+	p = &ProtoProducer{clampTime: true, maxClockSkew: time.Minute}
+	flowMessage.TimeFlowStartNs = tr + 5*1e9
+	flowMessage.TimeFlowEndNs = tr + 6*1e9
+	p.correctTime(&flowMessage, tr+6*1e9, tr, nil)
+	if flowMessage.TimeFlowStartNs != tr || flowMessage.TimeFlowEndNs != tr {
+		t.Fatalf("expected clamped times, got %d-%d", flowMessage.TimeFlowStartNs, flowMessage.TimeFlowEndNs)
+	}
+}
+
+func TestProtoProducerTimeCorrectionAbsentTimes(t *testing.T) {
+	t.Parallel()
+	// exporter clock one hour ahead, flow with unset timestamps
+	tr := uint64(1704067200) * 1e9
+	packet := netflow.IPFIXPacket{
+		ExportTime: uint32(tr/1e9 + 3600),
+		FlowSets: []interface{}{
+			netflow.DataFlowSet{
+				Records: []netflow.DataRecord{
+					{Values: []netflow.DataField{
+						{Type: netflow.IPFIX_FIELD_sourceIPv4Address, Value: []byte{10, 0, 0, 1}},
+						{Type: netflow.IPFIX_FIELD_flowStartMilliseconds, Value: make([]byte, 8)},
+						{Type: netflow.IPFIX_FIELD_flowEndMilliseconds, Value: make([]byte, 8)},
+					}},
+				},
+			},
+		},
+	}
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+	msgs, err := ProcessMessageIPFIXConfig(&packet, ctx, samplingrate.NewSamplingRateFlowStore(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	fmsg := msgs[0].(*ProtoProducerMessage)
+
+	p := &ProtoProducer{clampTime: true, maxClockSkew: time.Minute}
+	p.correctTime(fmsg, uint64(packet.ExportTime)*1e9, tr, nil)
+	if fmsg.TimeFlowStartNs != 0 || fmsg.TimeFlowEndNs != 0 {
+		t.Fatalf("expected absent times kept, got %d-%d", fmsg.TimeFlowStartNs, fmsg.TimeFlowEndNs)
+	}
+}
+
+func TestProtoProducerExporterOverrides(t *testing.T) {
+	t.Parallel()
+	overrides, err := exporters.Load(strings.NewReader(`
+exporters:
+  - match: 192.0.2.0/24
+    name: edge-1
+    site: par1
+    sampling_rate: 512
+    trust_as: true
+`))
+	if err != nil {
+		t.Fatalf("load exporters: %v", err)
+	}
+	exporter, ok := overrides.Lookup(netip.MustParseAddr("192.0.2.1"))
+	if !ok {
+		t.Fatal("expected exporter found")
+	}
+
+	var msg ProtoProducerMessage
+	msg.SamplingRate = 1
+	msg.SamplerHostname = "ptr.example.net"
+	msg.LmsTargetIndex = LMS_TARGET_INDEX
+	msg.SrcAs = 65000
+	enrichAS(&msg, exporter.TrustASFields())
+	applyExporter(&msg, exporter)
+	if msg.SamplingRate != 512 || msg.SamplerHostname != "edge-1" || msg.SamplerSite != "par1" {
+		t.Fatalf("expected overrides applied, got rate %d hostname %q site %q", msg.SamplingRate, msg.SamplerHostname, msg.SamplerSite)
+	}
+	if msg.LmsTargetIndex != LMS_TARGET_INDEX {
+		t.Fatalf("expected default target index, got %q", msg.LmsTargetIndex)
+	}
+	if msg.SrcAs != 65000 {
+		t.Fatalf("expected trusted SrcAs 65000, got %d", msg.SrcAs)
+	}
+
+	enrichAS(&msg, false)
+	if msg.SrcAs != 0 {
+		t.Fatalf("expected untrusted SrcAs replaced by GeoIP, got %d", msg.SrcAs)
+	}
+}
+
+func TestProtoProducerForwarded(t *testing.T) {
+	t.Parallel()
+	cfg, err := (&ProducerConfig{}).Compile()
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	overrides, err := exporters.Load(strings.NewReader(`
+exporters:
+  - match: 192.0.2.0/24
+    name: central
+`))
+	if err != nil {
+		t.Fatalf("load exporters: %v", err)
+	}
+	p, err := CreateProtoProducer(cfg, nil, WithExporterOverrides(overrides))
+	if err != nil {
+		t.Fatalf("create producer: %v", err)
+	}
+	defer p.Close()
+
+	flow := &flowmessage.FlowMessage{
+		Bytes:           1500,
+		SamplerAddress:  netip.MustParseAddr("192.0.2.1").AsSlice(),
+		SamplerHostname: "edge-1",
+		SrcCountry:      "FR",
+	}
+	tr := time.Unix(1700000000, 0)
+	flowMessageSet, err := p.Produce(flow, &producer.ProduceArgs{
+		SamplerAddress: netip.MustParseAddr("192.0.2.1"),
+		TimeReceived:   tr,
+	})
+	if err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+	defer p.Commit(flowMessageSet)
+	if len(flowMessageSet) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(flowMessageSet))
+	}
+	fmsg := flowMessageSet[0].(*ProtoProducerMessage)
+	if fmsg.Bytes != 1500 || fmsg.SamplerHostname != "edge-1" || fmsg.SrcCountry != "FR" {
+		t.Fatalf("expected the forwarded values kept, got %v", &fmsg.FlowMessage)
+	}
+	if fmsg.TimeReceivedNs != uint64(tr.UnixNano()) || fmsg.formatter == nil {
+		t.Fatalf("expected the reception time and the formatter set, got %d", fmsg.TimeReceivedNs)
+	}
+	if &fmsg.FlowMessage == flow {
+		t.Fatal("expected the forwarded flow copied")
+	}
+}
+
 func TestConvertNTPEpoch(t *testing.T) {
 	t.Parallel()
 	e := ConvertNTPEpoch(0xebe50e38c50cc000)
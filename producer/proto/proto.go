@@ -3,22 +3,128 @@ package protoproducer
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
 	"github.com/tgragnato/goflow/decoders/netflowlegacy"
 	"github.com/tgragnato/goflow/decoders/sflow"
 	"github.com/tgragnato/goflow/geoip"
+	flowmessage "github.com/tgragnato/goflow/pb"
 	"github.com/tgragnato/goflow/producer"
 	"github.com/tgragnato/goflow/sampler"
+	"github.com/tgragnato/goflow/utils/exporters"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
+	"google.golang.org/protobuf/proto"
 )
 
 const LMS_TARGET_INDEX = "goflow.local"
 
 // ProtoProducer converts decoded packets into protobuf flow messages.
 type ProtoProducer struct {
-	cfg           ProtoProducerConfig
-	samplingStore samplingrate.Store
+	cfg              ProtoProducerConfig
+	samplingStore    samplingrate.Store
+	applicationStore applications.Store
+
+	clampTime    bool
+	maxClockSkew time.Duration
+
+	exporterOverrides *exporters.Overrides
+}
+
+// ProtoProducerOption configures optional ProtoProducer behavior.
+type ProtoProducerOption func(*ProtoProducer)
+
+// WithApplicationStore resolves application names announced in options data.
+func WithApplicationStore(store applications.Store) ProtoProducerOption {
+	return func(p *ProtoProducer) {
+		p.applicationStore = store
+	}
+}
+
+// WithTimeCorrection adjusts NetFlow/IPFIX flow timestamps against the reception time.
+// When the exporter's clock differs from the collector's by more than maxClockSkew,
+// flow times are shifted by the difference (0 disables). When clamp is set, flow times
+// in the future are clamped to the reception time.
+func WithTimeCorrection(clamp bool, maxClockSkew time.Duration) ProtoProducerOption {
+	return func(p *ProtoProducer) {
+		p.clampTime = clamp
+		p.maxClockSkew = maxClockSkew
+	}
+}
+
+// WithExporterOverrides applies per-exporter defaults and overrides when enriching messages.
+func WithExporterOverrides(overrides *exporters.Overrides) ProtoProducerOption {
+	return func(p *ProtoProducer) {
+		p.exporterOverrides = overrides
+	}
+}
+
+// shiftTime subtracts the skew from a flow time, absent times (0) being kept.
+func shiftTime(ns uint64, skew int64) uint64 {
+	if ns == 0 {
+		return ns
+	}
+	return uint64(int64(ns) - skew)
+}
+
+// correctTime applies the configured clock skew correction and clamping.
+// exportNs is the export time claimed by the exporter, tr the reception time.
+func (p *ProtoProducer) correctTime(fmsg *ProtoProducerMessage, exportNs, tr uint64, loc *time.Location) {
+	if loc != nil {
+		fmsg.TimeFlowStartNs = exporters.LocalToUTC(fmsg.TimeFlowStartNs, loc)
+		fmsg.TimeFlowEndNs = exporters.LocalToUTC(fmsg.TimeFlowEndNs, loc)
+		exportNs = exporters.LocalToUTC(exportNs, loc)
+	}
+	if p.maxClockSkew > 0 {
+		skew := int64(exportNs) - int64(tr)
+		if skew > int64(p.maxClockSkew) || -skew > int64(p.maxClockSkew) {
+			fmsg.TimeFlowStartNs = shiftTime(fmsg.TimeFlowStartNs, skew)
+			fmsg.TimeFlowEndNs = shiftTime(fmsg.TimeFlowEndNs, skew)
+		}
+	}
+	if p.clampTime {
+		if fmsg.TimeFlowEndNs > tr {
+			fmsg.TimeFlowEndNs = tr
+		}
+		if fmsg.TimeFlowStartNs > fmsg.TimeFlowEndNs {
+			fmsg.TimeFlowStartNs = fmsg.TimeFlowEndNs
+		}
+	}
+}
+
+// enrichAS resolves AS numbers and organizations with GeoIP.
+// AS numbers reported by a trusted exporter are kept.
+func enrichAS(fmsg *ProtoProducerMessage, trustAS bool) {
+	srcAs, srcAsn := geoip.GetASNByByteSlice(fmsg.SrcAddr)
+	if !trustAS || fmsg.SrcAs == 0 {
+		fmsg.SrcAs = srcAs
+	}
+	if fmsg.SrcAs == srcAs {
+		fmsg.SrcAsn = srcAsn
+	}
+	dstAs, dstAsn := geoip.GetASNByByteSlice(fmsg.DstAddr)
+	if !trustAS || fmsg.DstAs == 0 {
+		fmsg.DstAs = dstAs
+	}
+	if fmsg.DstAs == dstAs {
+		fmsg.DstAsn = dstAsn
+	}
+}
+
+// applyExporter overrides message values with the exporter configuration.
+func applyExporter(fmsg *ProtoProducerMessage, exporter exporters.Config) {
+	if exporter.SamplingRate != 0 {
+		fmsg.SamplingRate = exporter.SamplingRate
+	}
+	if exporter.Name != "" {
+		fmsg.SamplerHostname = exporter.Name
+	}
+	if exporter.TargetIndex != "" {
+		fmsg.LmsTargetIndex = exporter.TargetIndex
+	}
+	fmsg.SamplerSite = exporter.Site
+	fmsg.SamplerTenant = exporter.Tenant
 }
 
 func (p *ProtoProducer) enrich(flowMessageSet []producer.ProducerMessage, cb func(msg *ProtoProducerMessage)) {
@@ -38,18 +144,20 @@ func (p *ProtoProducer) Produce(msg interface{}, args *producer.ProduceArgs) (fl
 	if args.FlowContext != nil {
 		ctx = *args.FlowContext
 	}
+	exporter, hasExporter := p.exporterOverrides.Lookup(args.SamplerAddress)
 	switch msgConv := msg.(type) {
 	case *netflowlegacy.PacketNetFlowV5:
 		flowMessageSet, err = ProcessMessageNetFlowLegacy(msgConv)
+		exportNs := uint64(msgConv.UnixSecs)*1e9 + uint64(msgConv.UnixNSecs)
 
 		p.enrich(flowMessageSet, func(fmsg *ProtoProducerMessage) {
 			fmsg.TimeReceivedNs = tr
+			p.correctTime(fmsg, exportNs, tr, exporter.Location())
 			fmsg.SamplerAddress = sa
 			fmsg.LmsTargetIndex = LMS_TARGET_INDEX
 			fmsg.SrcCountry = geoip.GetCountryByByteSlice(fmsg.SrcAddr)
-			fmsg.SrcAs, fmsg.SrcAsn = geoip.GetASNByByteSlice(fmsg.SrcAddr)
+			enrichAS(fmsg, exporter.TrustASFields())
 			fmsg.DstCountry = geoip.GetCountryByByteSlice(fmsg.DstAddr)
-			fmsg.DstAs, fmsg.DstAsn = geoip.GetASNByByteSlice(fmsg.DstAddr)
 			fmsg.SamplerHostname = sampler.GetHostnameByByteSlice(fmsg.SamplerAddress)
 			if len(fmsg.AsPath) == 0 {
 				fmsg.AsPath = []uint32{fmsg.SrcAs, 0, fmsg.DstAs}
@@ -60,15 +168,20 @@ func (p *ProtoProducer) Produce(msg interface{}, args *producer.ProduceArgs) (fl
 		})
 	case *netflow.NFv9Packet:
 		flowMessageSet, err = ProcessMessageNetFlowV9Config(msgConv, ctx, p.samplingStore, p.cfg)
+		if err == nil {
+			_, _, _, optionDataFlowSet := SplitNetFlowSets(*msgConv)
+			err = ProcessApplicationNames(optionDataFlowSet, ctx, 9, msgConv.SourceId, p.applicationStore, flowMessageSet)
+		}
+		exportNs := uint64(msgConv.UnixSeconds) * 1e9
 
 		p.enrich(flowMessageSet, func(fmsg *ProtoProducerMessage) {
 			fmsg.TimeReceivedNs = tr
+			p.correctTime(fmsg, exportNs, tr, exporter.Location())
 			fmsg.SamplerAddress = sa
 			fmsg.LmsTargetIndex = LMS_TARGET_INDEX
 			fmsg.SrcCountry = geoip.GetCountryByByteSlice(fmsg.SrcAddr)
-			fmsg.SrcAs, fmsg.SrcAsn = geoip.GetASNByByteSlice(fmsg.SrcAddr)
+			enrichAS(fmsg, exporter.TrustASFields())
 			fmsg.DstCountry = geoip.GetCountryByByteSlice(fmsg.DstAddr)
-			fmsg.DstAs, fmsg.DstAsn = geoip.GetASNByByteSlice(fmsg.DstAddr)
 			fmsg.SamplerHostname = sampler.GetHostnameByByteSlice(fmsg.SamplerAddress)
 			if len(fmsg.AsPath) == 0 {
 				fmsg.AsPath = []uint32{fmsg.SrcAs, 0, fmsg.DstAs}
@@ -79,15 +192,20 @@ func (p *ProtoProducer) Produce(msg interface{}, args *producer.ProduceArgs) (fl
 		})
 	case *netflow.IPFIXPacket:
 		flowMessageSet, err = ProcessMessageIPFIXConfig(msgConv, ctx, p.samplingStore, p.cfg)
+		if err == nil {
+			_, _, _, optionDataFlowSet := SplitIPFIXSets(*msgConv)
+			err = ProcessApplicationNames(optionDataFlowSet, ctx, 10, msgConv.ObservationDomainId, p.applicationStore, flowMessageSet)
+		}
+		exportNs := uint64(msgConv.ExportTime) * 1e9
 
 		p.enrich(flowMessageSet, func(fmsg *ProtoProducerMessage) {
 			fmsg.TimeReceivedNs = tr
+			p.correctTime(fmsg, exportNs, tr, exporter.Location())
 			fmsg.SamplerAddress = sa
 			fmsg.LmsTargetIndex = LMS_TARGET_INDEX
 			fmsg.SrcCountry = geoip.GetCountryByByteSlice(fmsg.SrcAddr)
-			fmsg.SrcAs, fmsg.SrcAsn = geoip.GetASNByByteSlice(fmsg.SrcAddr)
+			enrichAS(fmsg, exporter.TrustASFields())
 			fmsg.DstCountry = geoip.GetCountryByByteSlice(fmsg.DstAddr)
-			fmsg.DstAs, fmsg.DstAsn = geoip.GetASNByByteSlice(fmsg.DstAddr)
 			fmsg.SamplerHostname = sampler.GetHostnameByByteSlice(fmsg.SamplerAddress)
 			if len(fmsg.AsPath) == 0 {
 				fmsg.AsPath = []uint32{fmsg.SrcAs, 0, fmsg.DstAs}
@@ -105,9 +223,8 @@ func (p *ProtoProducer) Produce(msg interface{}, args *producer.ProduceArgs) (fl
 			fmsg.TimeFlowEndNs = tr
 			fmsg.LmsTargetIndex = LMS_TARGET_INDEX
 			fmsg.SrcCountry = geoip.GetCountryByByteSlice(fmsg.SrcAddr)
-			fmsg.SrcAs, fmsg.SrcAsn = geoip.GetASNByByteSlice(fmsg.SrcAddr)
+			enrichAS(fmsg, exporter.TrustASFields())
 			fmsg.DstCountry = geoip.GetCountryByByteSlice(fmsg.DstAddr)
-			fmsg.DstAs, fmsg.DstAsn = geoip.GetASNByByteSlice(fmsg.DstAddr)
 			fmsg.SamplerHostname = sampler.GetHostnameByByteSlice(fmsg.SamplerAddress)
 			if len(fmsg.AsPath) == 0 {
 				fmsg.AsPath = []uint32{fmsg.SrcAs, 0, fmsg.DstAs}
@@ -116,10 +233,25 @@ func (p *ProtoProducer) Produce(msg interface{}, args *producer.ProduceArgs) (fl
 			fmsg.AsPathEnd = fmsg.DstAs
 			fmsg.AsPathString = fmt.Sprintf("%v", fmsg.AsPath)
 		})
+	case *flowmessage.FlowMessage:
+		// forwarded by another collector, already enriched
+		fmsg := protoMessagePool.Get().(*ProtoProducerMessage)
+		fmsg.Reset()
+		proto.Merge(&fmsg.FlowMessage, msgConv)
+		if fmsg.TimeReceivedNs == 0 {
+			fmsg.TimeReceivedNs = tr
+		}
+		flowMessageSet = []producer.ProducerMessage{fmsg}
+		hasExporter = false
 	default:
 		return flowMessageSet, fmt.Errorf("flow not recognized")
 	}
 
+	if hasExporter {
+		p.enrich(flowMessageSet, func(fmsg *ProtoProducerMessage) {
+			applyExporter(fmsg, exporter)
+		})
+	}
 	p.enrich(flowMessageSet, func(fmsg *ProtoProducerMessage) {
 		fmsg.formatter = p.cfg.GetFormatter()
 	})
@@ -141,10 +273,13 @@ func (p *ProtoProducer) Close() {
 	if p.samplingStore != nil {
 		p.samplingStore.Close()
 	}
+	if p.applicationStore != nil {
+		p.applicationStore.Close()
+	}
 }
 
 // CreateProtoProducer creates a ProtoProducer with config and sampling system.
-func CreateProtoProducer(cfg ProtoProducerConfig, samplingStore samplingrate.Store) (producer.ProducerInterface, error) {
+func CreateProtoProducer(cfg ProtoProducerConfig, samplingStore samplingrate.Store, opts ...ProtoProducerOption) (producer.ProducerInterface, error) {
 	if samplingStore == nil {
 		samplingStore = samplingrate.NewSamplingRateFlowStore()
 	}
@@ -154,6 +289,12 @@ func CreateProtoProducer(cfg ProtoProducerConfig, samplingStore samplingrate.Sto
 		cfg:           cfg,
 		samplingStore: samplingStore,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.applicationStore != nil {
+		p.applicationStore.Start()
+	}
 
 	return p, nil
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"net"
 	"net/netip"
+	"reflect"
 	"time"
 )
 
@@ -26,6 +27,7 @@ const (
 	RendererDateTime     RendererID = "datetime"
 	RendererDateTimeNano RendererID = "datetimenano"
 	RendererString       RendererID = "string"
+	RendererFwEvent      RendererID = "fwevent"
 )
 
 var (
@@ -38,6 +40,7 @@ var (
 		RendererDateTime:     DateTimeRenderer,
 		RendererDateTimeNano: DateTimeNanoRenderer,
 		RendererString:       StringRenderer,
+		RendererFwEvent:      FirewallEventRenderer,
 	}
 
 	defaultRenderers = map[string]RenderFunc{
@@ -54,8 +57,11 @@ var (
 		"Proto":          ProtoRenderer,
 		"SrcNet":         NetworkRenderer,
 		"DstNet":         NetworkRenderer,
+		"XlateSrcAddr":   IPRenderer,
+		"XlateDstAddr":   IPRenderer,
 
-		"icmp_name": ICMPRenderer,
+		"icmp_name":     ICMPRenderer,
+		"fw_event_name": FirewallEventRenderer,
 
 		"Ipv6RoutingHeaderAddresses": IPRenderer,
 	}
@@ -230,6 +236,19 @@ var (
 		133: "RouterSolicitation",
 		134: "RouterAdvertisement",
 	}
+	// NSEL firewall events (233) and extended events (33002)
+	fwEventName = map[uint32]string{
+		0:    "Ignore",
+		1:    "FlowCreated",
+		2:    "FlowDeleted",
+		3:    "FlowDenied",
+		4:    "FlowAlert",
+		5:    "FlowUpdate",
+		1001: "DeniedIngressACL",
+		1002: "DeniedEgressACL",
+		1003: "DeniedInterface",
+		1004: "DeniedNotSYN",
+	}
 )
 
 // NilRenderer returns nil for any field.
@@ -381,3 +400,70 @@ func IcmpCodeType(proto, icmpCode, icmpType uint32) string {
 func ICMPRenderer(msg *ProtoProducerMessage, fieldName string, data interface{}) interface{} {
 	return IcmpCodeType(uint32(msg.Proto), uint32(msg.IcmpCode), uint32(msg.IcmpType))
 }
+
+// FirewallEventName returns the name of an NSEL firewall or extended event.
+func FirewallEventName(event uint32) string {
+	if name, ok := fwEventName[event]; ok {
+		return name
+	} else if event > 2000 {
+		return "FlowDeleted"
+	}
+	return "unknown"
+}
+
+// FirewallEventRenderer formats NSEL event values. As a virtual field,
+// it prefers the extended event over the base firewall event.
+func FirewallEventRenderer(msg *ProtoProducerMessage, fieldName string, data interface{}) interface{} {
+	if dataC, ok := data.(uint32); ok {
+		return FirewallEventName(dataC)
+	} else if dataC, ok := data.(uint64); ok {
+		return FirewallEventName(uint32(dataC))
+	}
+	if msg.FwExtEvent != 0 {
+		return FirewallEventName(msg.FwExtEvent)
+	}
+	return FirewallEventName(msg.FwEvent)
+}
+
+func sameRenderer(a, b RenderFunc) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// RenderedType returns the type of the rendered values of an output field of the formatter:
+// ip, datetime, string, integer, float or bool. It is empty when unknown (eg: custom protobuf fields).
+func RenderedType(formatter FormatterMapper, name string) string {
+	if remap, ok := formatter.Remap(name); ok && remap != "" {
+		name = remap
+	}
+	if renderer, ok := formatter.Render(name); ok && !sameRenderer(renderer, NilRenderer) {
+		switch {
+		case sameRenderer(renderer, IPRenderer):
+			return "ip"
+		case sameRenderer(renderer, DateTimeRenderer), sameRenderer(renderer, DateTimeNanoRenderer):
+			return "datetime"
+		}
+		return "string"
+	}
+	field, ok := reflect.TypeOf(ProtoProducerMessage{}).FieldByName(name)
+	if !ok {
+		return ""
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem() // arrays have the type of their items
+	}
+	if typ.Implements(reflect.TypeFor[interface{ String() string }]()) {
+		return "string" // enumerations are rendered with their names
+	}
+	switch typ.Kind() {
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String, reflect.Slice:
+		return "string" // bytes are rendered in hexadecimal
+	}
+	return ""
+}
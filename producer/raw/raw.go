@@ -10,6 +10,7 @@ import (
 	"github.com/tgragnato/goflow/decoders/netflow"
 	"github.com/tgragnato/goflow/decoders/netflowlegacy"
 	"github.com/tgragnato/goflow/decoders/sflow"
+	flowpb "github.com/tgragnato/goflow/pb"
 	"github.com/tgragnato/goflow/producer"
 )
 
@@ -36,6 +37,8 @@ func (m RawMessage) MarshalJSON() ([]byte, error) {
 		typeStr = "ipfix"
 	case *sflow.Packet:
 		typeStr = "sflow"
+	case *flowpb.FlowMessage:
+		typeStr = "forwarded"
 	}
 
 	tmpStruct := struct {
@@ -0,0 +1,240 @@
+// Package batcher implements the batching, queuing and retries of the transports
+// writing messages in batches (eg: with HTTP requests).
+package batcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/metrics"
+)
+
+// ErrClosed is returned when adding messages to a closed batcher.
+var ErrClosed = errors.New("transport closed")
+
+// Batch holds the messages written together.
+type Batch interface {
+	Len() int  // number of messages
+	Size() int // size of the messages in bytes
+}
+
+// Config configures a Batcher.
+type Config struct {
+	Name          string        // name of the transport in the metrics
+	BatchSize     int           // maximum number of messages per batch
+	BatchBytes    int           // maximum size of the messages of a batch (0 for no limit)
+	FlushInterval time.Duration // maximum time before writing a partial batch (0 to disable)
+	QueueSize     int           // number of batches waiting to be written before blocking
+	Retries       int           // maximum number of retries of a failed write
+	RetryBackoff  time.Duration // initial delay between retries, doubled after each attempt
+	RetryMax      time.Duration // maximum delay between retries (0 for no limit)
+}
+
+// WriteFunc writes a batch and returns the number of messages which could not be written.
+type WriteFunc[B Batch] func(b B) (int, error)
+
+// Batcher accumulates messages in batches, queued when full or at the flush interval,
+// and writes them from a single routine. The written and failed messages are counted
+// in the transport metrics.
+type Batcher[B Batch] struct {
+	cfg      Config
+	newBatch func() B
+	write    WriteFunc[B]
+
+	lock   sync.Mutex
+	batch  B
+	closed bool
+
+	queueLock   sync.RWMutex // sends to the queue, which is closed with the write lock
+	queueClosed bool
+	queue       chan B
+	errors      chan error
+	stopCh      chan struct{}
+	closeOnce   sync.Once
+	wg          sync.WaitGroup // write routine
+	tickWg      sync.WaitGroup // flush routine
+}
+
+// New starts the routines of a batcher writing its batches with write.
+func New[B Batch](cfg Config, newBatch func() B, write WriteFunc[B]) *Batcher[B] {
+	b := &Batcher[B]{
+		cfg:      cfg,
+		newBatch: newBatch,
+		write:    write,
+		batch:    newBatch(),
+		queue:    make(chan B, cfg.QueueSize),
+		errors:   make(chan error, 16),
+		stopCh:   make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	if cfg.FlushInterval > 0 {
+		b.tickWg.Add(1)
+		go func() {
+			defer b.tickWg.Done()
+			ticker := time.NewTicker(cfg.FlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-b.stopCh:
+					return
+				case <-ticker.C:
+					b.flush()
+				}
+			}
+		}()
+	}
+	return b
+}
+
+// Add appends a message to the current batch with add, called with the lock held,
+// and queues the batch when full. It fails with ErrClosed once the batcher is closed.
+func (b *Batcher[B]) Add(add func(batch B) error) error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return ErrClosed
+	}
+	if err := add(b.batch); err != nil {
+		b.lock.Unlock()
+		return err
+	}
+	if b.batch.Len() < b.cfg.BatchSize && (b.cfg.BatchBytes <= 0 || b.batch.Size() < b.cfg.BatchBytes) {
+		b.lock.Unlock()
+		return nil
+	}
+	batch := b.batch
+	b.batch = b.newBatch()
+	b.lock.Unlock()
+	return b.enqueue(batch)
+}
+
+// flush queues the current batch for writing if it is not empty.
+func (b *Batcher[B]) flush() {
+	b.lock.Lock()
+	if b.closed || b.batch.Len() == 0 {
+		b.lock.Unlock()
+		return
+	}
+	batch := b.batch
+	b.batch = b.newBatch()
+	b.lock.Unlock()
+	_ = b.enqueue(batch)
+}
+
+// enqueue queues a batch for writing. The messages of a batch queued while closing are dropped.
+func (b *Batcher[B]) enqueue(batch B) error {
+	b.queueLock.RLock()
+	defer b.queueLock.RUnlock()
+	if b.queueClosed {
+		metrics.TransportMessages.WithLabelValues(b.cfg.Name, "failure").Add(float64(batch.Len()))
+		return ErrClosed
+	}
+	b.queue <- batch
+	return nil
+}
+
+// ReportError sends an error to the errors channel, unless it is full.
+func (b *Batcher[B]) ReportError(err error) {
+	select {
+	case b.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+func (b *Batcher[B]) run() {
+	defer b.wg.Done()
+	for batch := range b.queue {
+		failed, err := b.write(batch)
+		failed = min(failed, batch.Len())
+		metrics.TransportMessages.WithLabelValues(b.cfg.Name, "success").Add(float64(batch.Len() - failed))
+		if failed > 0 {
+			metrics.TransportMessages.WithLabelValues(b.cfg.Name, "failure").Add(float64(failed))
+		}
+		if err != nil {
+			b.ReportError(err)
+		}
+	}
+}
+
+// Retry calls attempt until it succeeds, fails with an error which cannot be retried
+// or the retries are exhausted, and returns its last error. attempt reports whether
+// its failure can be retried, and after which delay if the server asked for one.
+// The delays are cut short when the batcher is closed, so that Close does not wait for them.
+func (b *Batcher[B]) Retry(attempt func() (time.Duration, bool, error)) error {
+	backoff := b.cfg.RetryBackoff
+	for n := 0; ; n++ {
+		retryAfter, retry, err := attempt()
+		if err == nil {
+			metrics.TransportRequests.WithLabelValues(b.cfg.Name, "success").Inc()
+			return nil
+		}
+		if !retry || n >= b.cfg.Retries {
+			metrics.TransportRequests.WithLabelValues(b.cfg.Name, "failure").Inc()
+			return err
+		}
+		metrics.TransportRequests.WithLabelValues(b.cfg.Name, "retry").Inc()
+		delay := max(backoff, retryAfter)
+		if b.cfg.RetryMax > 0 {
+			delay = min(delay, b.cfg.RetryMax)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-b.stopCh:
+			timer.Stop()
+		}
+		backoff *= 2
+	}
+}
+
+// Errors returns the errors of the writes.
+func (b *Batcher[B]) Errors() <-chan error {
+	if b == nil {
+		return nil
+	}
+	return b.errors
+}
+
+// Close writes the remaining messages, retrying them without delay, and stops the routines.
+// The messages added afterwards are rejected with ErrClosed.
+func (b *Batcher[B]) Close() {
+	b.closeOnce.Do(func() {
+		close(b.stopCh)
+		b.tickWg.Wait()
+		b.lock.Lock()
+		b.closed = true
+		batch := b.batch
+		b.batch = b.newBatch()
+		b.lock.Unlock()
+		if batch.Len() > 0 {
+			_ = b.enqueue(batch)
+		}
+		// the write routine drains the queue, so pending sends complete before it is closed
+		b.queueLock.Lock()
+		b.queueClosed = true
+		close(b.queue)
+		b.queueLock.Unlock()
+		b.wg.Wait()
+		close(b.errors)
+	})
+}
+
+// Gzip returns a payload compressed with gzip.
+func Gzip(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,162 @@
+package batcher
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testBatch struct {
+	messages []string
+	bytes    int
+}
+
+func (b *testBatch) Len() int  { return len(b.messages) }
+func (b *testBatch) Size() int { return b.bytes }
+
+func add(b *Batcher[*testBatch], msg string) error {
+	return b.Add(func(batch *testBatch) error {
+		batch.messages = append(batch.messages, msg)
+		batch.bytes += len(msg)
+		return nil
+	})
+}
+
+func TestBatcher(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	var written [][]string
+	var b *Batcher[*testBatch]
+	b = New(Config{Name: "test", BatchSize: 3, BatchBytes: 8, QueueSize: 4}, func() *testBatch { return &testBatch{} },
+		func(batch *testBatch) (int, error) {
+			lock.Lock()
+			written = append(written, batch.messages)
+			lock.Unlock()
+			if batch.messages[0] == "fail" {
+				return 1, errors.New("failed")
+			}
+			return 0, nil
+		})
+	// batches are queued at 3 messages or 8 bytes, the remaining ones on Close
+	for _, msg := range []string{"a", "b", "c", "long msg", "fail", "d"} {
+		if err := add(b, msg); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if err := b.Add(func(*testBatch) error { return errors.New("invalid") }); err == nil {
+		t.Fatal("expected the error of add")
+	}
+	b.Close()
+	b.Close()
+	// adding after close fails instead of sending on the closed queue
+	for _, msg := range []string{"e", "f", "g"} {
+		if err := add(b, msg); !errors.Is(err, ErrClosed) {
+			t.Fatalf("expected ErrClosed after close, got %v", err)
+		}
+	}
+	var errs []error
+	for err := range b.Errors() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0].Error() != "failed" {
+		t.Fatalf("expected the write error, got %v", errs)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(written) != 3 || len(written[0]) != 3 || len(written[1]) != 1 || len(written[2]) != 2 {
+		t.Fatalf("unexpected batches %q", written)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	b := New(Config{Name: "test", BatchSize: 1, Retries: 2, RetryBackoff: time.Millisecond}, func() *testBatch { return &testBatch{} },
+		func(*testBatch) (int, error) { return 0, nil })
+	defer b.Close()
+
+	for _, test := range []struct {
+		name     string
+		retry    bool
+		failures int
+		attempts int
+		err      bool
+	}{
+		{"success", true, 0, 1, false},
+		{"retried", true, 2, 3, false},
+		{"exhausted", true, 5, 3, true},
+		{"permanent", false, 5, 1, true},
+	} {
+		var attempts int
+		err := b.Retry(func() (time.Duration, bool, error) {
+			attempts++
+			if attempts <= test.failures {
+				return 0, test.retry, errors.New("failed")
+			}
+			return 0, false, nil
+		})
+		if attempts != test.attempts || (err != nil) != test.err {
+			t.Fatalf("%s: expected %d attempts (error %v), got %d (%v)", test.name, test.attempts, test.err, attempts, err)
+		}
+	}
+}
+
+func TestRetryClose(t *testing.T) {
+	t.Parallel()
+	b := New(Config{Name: "test", BatchSize: 1, Retries: 3, RetryBackoff: time.Hour}, func() *testBatch { return &testBatch{} },
+		func(*testBatch) (int, error) { return 0, nil })
+
+	// the delays are cut short once closing, the retries still being attempted
+	done := make(chan int)
+	go func() {
+		var attempts int
+		_ = b.Retry(func() (time.Duration, bool, error) {
+			attempts++
+			return time.Hour, true, errors.New("failed")
+		})
+		done <- attempts
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Close()
+	select {
+	case attempts := <-done:
+		if attempts != 4 {
+			t.Fatalf("expected 4 attempts, got %d", attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the retries to stop waiting on close")
+	}
+}
+
+func TestGzip(t *testing.T) {
+	t.Parallel()
+	payload, err := Gzip([]byte("flows"))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if len(payload) < 2 || payload[0] != 0x1f || payload[1] != 0x8b {
+		t.Fatalf("expected a gzip header, got %x", payload)
+	}
+}
+
+func TestAddClose(t *testing.T) {
+	t.Parallel()
+	b := New(Config{Name: "test", BatchSize: 1, QueueSize: 1}, func() *testBatch { return &testBatch{} },
+		func(*testBatch) (int, error) { return 0, nil })
+	// the adds racing with Close either queue their batch or fail, without panicking
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := add(b, "msg"); err != nil && !errors.Is(err, ErrClosed) {
+					t.Errorf("add: %v", err)
+				}
+			}
+		}()
+	}
+	b.Close()
+	wg.Wait()
+}
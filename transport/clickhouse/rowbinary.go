@@ -0,0 +1,260 @@
+package clickhouse
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encoder appends the RowBinary encoding of a JSON value.
+type encoder func(b []byte, value interface{}) ([]byte, error)
+
+// unwrap returns the argument of a parametric type, or false if the type is not name(...).
+func unwrap(typ, name string) (string, bool) {
+	if !strings.HasPrefix(typ, name+"(") || !strings.HasSuffix(typ, ")") {
+		return "", false
+	}
+	return strings.TrimSpace(typ[len(name)+1 : len(typ)-1]), true
+}
+
+// toInt converts a JSON number, string or boolean to an integer.
+func toInt(value interface{}, unsigned bool) (int64, uint64, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return 0, 0, nil
+	case bool:
+		if v {
+			return 1, 1, nil
+		}
+		return 0, 0, nil
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return 0, 0, fmt.Errorf("cannot convert %T to an integer", value)
+	}
+	if unsigned {
+		u, err := strconv.ParseUint(s, 10, 64)
+		return int64(u), u, err
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	return i, uint64(i), err
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to a float", value)
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func toAddr(value interface{}) (netip.Addr, error) {
+	s, ok := value.(string)
+	if value == nil || (ok && s == "") {
+		return netip.IPv6Unspecified(), nil
+	}
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("cannot convert %T to an address", value)
+	}
+	return netip.ParseAddr(s)
+}
+
+// toTime converts an RFC 3339 string or a number of nanoseconds (eg: time_received_ns) to a time.
+func toTime(value interface{}) (time.Time, error) {
+	if s, ok := value.(string); ok {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	}
+	i, _, err := toInt(value, false)
+	return time.Unix(0, i), err
+}
+
+func intEncoder(size int, unsigned bool) encoder {
+	return func(b []byte, value interface{}) ([]byte, error) {
+		_, u, err := toInt(value, unsigned)
+		if err != nil {
+			return nil, err
+		}
+		switch size {
+		case 1:
+			return append(b, byte(u)), nil
+		case 2:
+			return binary.LittleEndian.AppendUint16(b, uint16(u)), nil
+		case 4:
+			return binary.LittleEndian.AppendUint32(b, uint32(u)), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, u), nil
+	}
+}
+
+// newEncoder returns the encoder of a column type.
+func newEncoder(typ string) (encoder, error) {
+	typ = strings.TrimSpace(typ)
+	if inner, ok := unwrap(typ, "LowCardinality"); ok {
+		return newEncoder(inner)
+	}
+	if inner, ok := unwrap(typ, "Nullable"); ok {
+		enc, err := newEncoder(inner)
+		if err != nil {
+			return nil, err
+		}
+		return func(b []byte, value interface{}) ([]byte, error) {
+			if value == nil {
+				return append(b, 1), nil
+			}
+			return enc(append(b, 0), value)
+		}, nil
+	}
+	if inner, ok := unwrap(typ, "Array"); ok {
+		enc, err := newEncoder(inner)
+		if err != nil {
+			return nil, err
+		}
+		return func(b []byte, value interface{}) ([]byte, error) {
+			items, _ := value.([]interface{})
+			if value != nil && items == nil {
+				items = []interface{}{value}
+			}
+			b = binary.AppendUvarint(b, uint64(len(items)))
+			for _, item := range items {
+				var err error
+				if b, err = enc(b, item); err != nil {
+					return nil, err
+				}
+			}
+			return b, nil
+		}, nil
+	}
+	if inner, ok := unwrap(typ, "FixedString"); ok {
+		size, err := strconv.Atoi(inner)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type %s", typ)
+		}
+		return func(b []byte, value interface{}) ([]byte, error) {
+			s, err := toString(value)
+			if err != nil {
+				return nil, err
+			}
+			fixed := make([]byte, size)
+			copy(fixed, s)
+			return append(b, fixed...), nil
+		}, nil
+	}
+	if typ == "DateTime" || strings.HasPrefix(typ, "DateTime(") {
+		return func(b []byte, value interface{}) ([]byte, error) {
+			t, err := toTime(value)
+			if err != nil {
+				return nil, err
+			}
+			return binary.LittleEndian.AppendUint32(b, uint32(t.Unix())), nil
+		}, nil
+	}
+	if inner, ok := unwrap(typ, "DateTime64"); ok {
+		precision, _, _ := strings.Cut(inner, ",")
+		p, err := strconv.Atoi(strings.TrimSpace(precision))
+		if err != nil || p < 0 || p > 9 {
+			return nil, fmt.Errorf("invalid type %s", typ)
+		}
+		scale := int64(math.Pow10(9 - p))
+		return func(b []byte, value interface{}) ([]byte, error) {
+			t, err := toTime(value)
+			if err != nil {
+				return nil, err
+			}
+			return binary.LittleEndian.AppendUint64(b, uint64(t.UnixNano()/scale)), nil
+		}, nil
+	}
+
+	switch typ {
+	case "UInt8":
+		return intEncoder(1, true), nil
+	case "UInt16":
+		return intEncoder(2, true), nil
+	case "UInt32":
+		return intEncoder(4, true), nil
+	case "UInt64":
+		return intEncoder(8, true), nil
+	case "Int8":
+		return intEncoder(1, false), nil
+	case "Int16":
+		return intEncoder(2, false), nil
+	case "Int32":
+		return intEncoder(4, false), nil
+	case "Int64":
+		return intEncoder(8, false), nil
+	case "Bool":
+		return intEncoder(1, true), nil
+	case "Float32":
+		return func(b []byte, value interface{}) ([]byte, error) {
+			f, err := toFloat(value)
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f))), err
+		}, nil
+	case "Float64":
+		return func(b []byte, value interface{}) ([]byte, error) {
+			f, err := toFloat(value)
+			return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), err
+		}, nil
+	case "String":
+		return func(b []byte, value interface{}) ([]byte, error) {
+			s, err := toString(value)
+			if err != nil {
+				return nil, err
+			}
+			b = binary.AppendUvarint(b, uint64(len(s)))
+			return append(b, s...), nil
+		}, nil
+	case "IPv4":
+		return func(b []byte, value interface{}) ([]byte, error) {
+			addr, err := toAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			if addr = addr.Unmap(); addr == netip.IPv6Unspecified() {
+				addr = netip.IPv4Unspecified()
+			}
+			if !addr.Is4() {
+				return nil, fmt.Errorf("%s is not an IPv4 address", addr)
+			}
+			a := addr.As4()
+			return binary.LittleEndian.AppendUint32(b, binary.BigEndian.Uint32(a[:])), nil
+		}, nil
+	case "IPv6":
+		return func(b []byte, value interface{}) ([]byte, error) {
+			addr, err := toAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			a := addr.As16()
+			return append(b, a[:]...), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
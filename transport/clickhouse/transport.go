@@ -0,0 +1,383 @@
+// Package clickhouse implements a ClickHouse HTTP insert transport.
+package clickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+)
+
+const (
+	formatJSONEachRow = "JSONEachRow"
+	formatRowBinary   = "RowBinary"
+)
+
+// transientErrors are the codes of the ClickHouse exceptions for which an insert is retried
+// (timeouts, network errors, memory limit, too many parts or queries, replicas unavailable).
+var transientErrors = []int{159, 202, 203, 209, 210, 241, 242, 252, 285, 319, 425, 999}
+
+// column is a column of the table.
+type column struct {
+	name    string
+	typ     string
+	encoder encoder
+}
+
+type batch struct {
+	buf  bytes.Buffer
+	rows int
+}
+
+func (b *batch) Len() int  { return b.rows }
+func (b *batch) Size() int { return b.buf.Len() }
+
+// ClickhouseDriver batches JSON messages (see the json format) and inserts them in a table
+// with the ClickHouse HTTP interface, as JSONEachRow or encoded as RowBinary.
+// The columns are the output fields of the mapping present in the table, unless set explicitly.
+type ClickhouseDriver struct {
+	url           string
+	database      string
+	table         string
+	username      string
+	password      string
+	format        string
+	columnList    string
+	asyncInsert   bool
+	asyncWait     bool
+	settings      string
+	timeout       time.Duration
+	batchSize     int
+	batchBytes    int
+	flushInterval time.Duration
+	compression   bool
+	retries       int
+	retryBackoff  time.Duration
+	queueSize     int
+
+	client      *http.Client
+	tableCols   []column
+	columns     []column // columns of the inserts, set with the first batch
+	insertQuery string
+	batcher     *batcher.Batcher[*batch]
+
+	lock   sync.Mutex
+	fields []string
+}
+
+// Prepare registers flags for the ClickHouse transport configuration.
+func (d *ClickhouseDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.clickhouse.url", "http://localhost:8123", "ClickHouse HTTP interface URL")
+	flag.StringVar(&d.database, "transport.clickhouse.database", "default", "Database of the table")
+	flag.StringVar(&d.table, "transport.clickhouse.table", "flows", "Table receiving the flows")
+	flag.StringVar(&d.username, "transport.clickhouse.username", "default", "ClickHouse user")
+	flag.StringVar(&d.password, "transport.clickhouse.password", "", "ClickHouse password")
+	flag.StringVar(&d.format, "transport.clickhouse.format", formatJSONEachRow, "Insert format (JSONEachRow, RowBinary)")
+	flag.StringVar(&d.columnList, "transport.clickhouse.columns", "", "Comma-separated list of the columns to insert (empty for the fields of the mapping)")
+	flag.BoolVar(&d.asyncInsert, "transport.clickhouse.async", false, "Use asynchronous inserts")
+	flag.BoolVar(&d.asyncWait, "transport.clickhouse.async.wait", true, "Wait for asynchronous inserts to be written")
+	flag.StringVar(&d.settings, "transport.clickhouse.settings", "", "Comma-separated list of key=value settings of the inserts")
+	flag.DurationVar(&d.timeout, "transport.clickhouse.timeout", 30*time.Second, "Insert request timeout")
+	flag.IntVar(&d.batchSize, "transport.clickhouse.batch", 10000, "Maximum number of rows per insert")
+	flag.IntVar(&d.batchBytes, "transport.clickhouse.batch.bytes", 16<<20, "Maximum size of the rows of an insert (0 for no limit)")
+	flag.DurationVar(&d.flushInterval, "transport.clickhouse.flush", 5*time.Second, "Maximum time before inserting a partial batch")
+	flag.BoolVar(&d.compression, "transport.clickhouse.gzip", true, "Compress inserts with gzip")
+	flag.IntVar(&d.retries, "transport.clickhouse.retries", 5, "Maximum number of retries of an insert failing with a transient error")
+	flag.DurationVar(&d.retryBackoff, "transport.clickhouse.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.IntVar(&d.queueSize, "transport.clickhouse.queue", 16, "Number of batches waiting to be inserted before blocking")
+	return nil
+}
+
+// SetFields sets the output fields of the mapping, used as columns.
+func (d *ClickhouseDriver) SetFields(fields []transport.Field) {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	d.lock.Lock()
+	d.fields = names
+	d.lock.Unlock()
+}
+
+// quote returns an identifier quoted with backticks.
+func quote(name string) string {
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Init describes the table and starts the batching and insert routines.
+func (d *ClickhouseDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("clickhouse transport: batch size must be positive")
+	}
+	if d.format != formatJSONEachRow && d.format != formatRowBinary {
+		return fmt.Errorf("clickhouse transport: unsupported format %s", d.format)
+	}
+	for _, setting := range splitList(d.settings) {
+		if key, _, ok := strings.Cut(setting, "="); !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("clickhouse transport: invalid setting %q", setting)
+		}
+	}
+	d.url = strings.TrimSuffix(d.url, "/")
+	d.client = &http.Client{Timeout: d.timeout}
+	if err := d.describe(); err != nil {
+		return fmt.Errorf("clickhouse transport: describe table: %w", err)
+	}
+	for _, name := range splitList(d.columnList) {
+		if !slices.ContainsFunc(d.tableCols, func(c column) bool { return c.name == name }) {
+			return fmt.Errorf("clickhouse transport: no column %s in table %s", name, d.table)
+		}
+	}
+
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "clickhouse",
+		BatchSize:     d.batchSize,
+		BatchBytes:    d.batchBytes,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+	}, func() *batch { return &batch{} }, d.insert)
+	return nil
+}
+
+// describe reads the insertable columns of the table and their types.
+func (d *ClickhouseDriver) describe() error {
+	query := fmt.Sprintf("DESCRIBE TABLE %s.%s FORMAT TabSeparated", quote(d.database), quote(d.table))
+	resp, body, err := d.request(url.Values{}, []byte(query), "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	d.tableCols = nil
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) < 2 {
+			continue
+		}
+		if len(parts) > 2 && (parts[2] == "MATERIALIZED" || parts[2] == "ALIAS" || parts[2] == "EPHEMERAL") {
+			continue
+		}
+		c := column{name: parts[0], typ: parts[1]}
+		if d.format == formatRowBinary {
+			if c.encoder, err = newEncoder(c.typ); err != nil {
+				return fmt.Errorf("column %s: %w", c.name, err)
+			}
+		}
+		d.tableCols = append(d.tableCols, c)
+	}
+	if len(d.tableCols) == 0 {
+		return fmt.Errorf("no insertable column")
+	}
+	return nil
+}
+
+// prepareInsert selects the columns of the inserts: the configured ones, or the fields
+// of the mapping present in the table, or all the columns.
+func (d *ClickhouseDriver) prepareInsert() {
+	names := splitList(d.columnList)
+	if len(names) == 0 {
+		d.lock.Lock()
+		names = d.fields
+		d.lock.Unlock()
+	}
+	d.columns = nil
+	for _, c := range d.tableCols {
+		if len(names) == 0 || slices.Contains(names, c.name) {
+			d.columns = append(d.columns, c)
+		}
+	}
+	if len(d.columns) == 0 {
+		d.columns = d.tableCols
+	}
+	quoted := make([]string, len(d.columns))
+	for i, c := range d.columns {
+		quoted[i] = quote(c.name)
+	}
+	d.insertQuery = fmt.Sprintf("INSERT INTO %s.%s (%s) FORMAT %s",
+		quote(d.database), quote(d.table), strings.Join(quoted, ", "), d.format)
+}
+
+// encodeRow appends the RowBinary encoding of the columns of a JSON row.
+func (d *ClickhouseDriver) encodeRow(b, row []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(row))
+	dec.UseNumber()
+	var values map[string]interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("decode row: %w", err)
+	}
+	for _, c := range d.columns {
+		var err error
+		if b, err = c.encoder(b, values[c.name]); err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+	}
+	return b, nil
+}
+
+// insert inserts a batch and returns the number of rows which were not inserted. With RowBinary,
+// the rows which cannot be encoded are skipped and reported, the others being inserted.
+func (d *ClickhouseDriver) insert(b *batch) (int, error) {
+	if d.insertQuery == "" {
+		d.prepareInsert()
+	}
+	payload := b.buf.Bytes()
+	rows := b.rows
+	if d.format == formatRowBinary {
+		var encoded []byte
+		scanner := bufio.NewScanner(bytes.NewReader(payload))
+		scanner.Buffer(nil, len(payload)+1)
+		for scanner.Scan() {
+			row, err := d.encodeRow(encoded, scanner.Bytes())
+			if err != nil {
+				rows--
+				d.batcher.ReportError(fmt.Errorf("skip row: %w", err))
+				continue
+			}
+			encoded = row
+		}
+		if rows == 0 {
+			return b.rows, nil
+		}
+		payload = encoded
+	}
+
+	params := url.Values{}
+	params.Set("query", d.insertQuery)
+	if d.format == formatJSONEachRow {
+		params.Set("input_format_skip_unknown_fields", "1")
+	}
+	if d.asyncInsert {
+		params.Set("async_insert", "1")
+		if d.asyncWait {
+			params.Set("wait_for_async_insert", "1")
+		} else {
+			params.Set("wait_for_async_insert", "0")
+		}
+	}
+	for _, setting := range splitList(d.settings) {
+		key, value, _ := strings.Cut(setting, "=")
+		params.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	encoding := ""
+	if d.compression {
+		var err error
+		if payload, err = batcher.Gzip(payload); err != nil {
+			return b.rows, fmt.Errorf("insert batch: %w", err)
+		}
+		encoding = "gzip"
+	}
+
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		retry, err := d.insertOnce(params, payload, encoding)
+		return 0, retry, err
+	})
+	if err != nil {
+		return b.rows, fmt.Errorf("insert batch: %w", err)
+	}
+	return b.rows - rows, nil
+}
+
+// insertOnce sends an insert and reports whether a failure is transient.
+func (d *ClickhouseDriver) insertOnce(params url.Values, payload []byte, encoding string) (bool, error) {
+	resp, body, err := d.request(params, payload, encoding)
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	if code, convErr := strconv.Atoi(resp.Header.Get("X-ClickHouse-Exception-Code")); convErr == nil {
+		return slices.Contains(transientErrors, code), err
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, err
+	}
+	return false, err
+}
+
+// request posts a payload and returns the response and its body.
+func (d *ClickhouseDriver) request(params url.Values, payload []byte, encoding string) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url+"/?"+params.Encode(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("create request: %w", err)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("X-ClickHouse-User", d.username)
+	if d.password != "" {
+		req.Header.Set("X-ClickHouse-Key", d.password)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp, body, nil
+}
+
+// Send appends a row to the current batch, queuing it for insertion when full.
+func (d *ClickhouseDriver) Send(key, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return d.batcher.Add(func(b *batch) error {
+		b.buf.Write(data)
+		b.buf.WriteByte('\n')
+		b.rows++
+		return nil
+	})
+}
+
+// Errors returns insert errors.
+func (d *ClickhouseDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close inserts the remaining rows and stops the routines.
+func (d *ClickhouseDriver) Close() error {
+	if d.batcher != nil {
+		d.batcher.Close()
+	}
+	return nil
+}
+
+func init() {
+	d := &ClickhouseDriver{}
+	transport.RegisterTransportDriver("clickhouse", d)
+}
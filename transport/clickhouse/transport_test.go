@@ -0,0 +1,203 @@
+package clickhouse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+)
+
+const describeTable = "time_received_ns\tDateTime64(9)\t\t\t\t\t\n" +
+	"src_addr\tIPv6\t\t\t\t\t\n" +
+	"proto\tLowCardinality(String)\t\t\t\t\t\n" +
+	"bytes\tUInt64\t\t\t\t\t\n" +
+	"as_path\tArray(UInt32)\t\t\t\t\t\n" +
+	"date\tDate\tMATERIALIZED\ttoDate(time_received_ns)\t\t\t\n"
+
+// testServer answers DESCRIBE queries and records the queries and bodies of the inserts.
+func testServer(t *testing.T, failures int) (*httptest.Server, func() ([]string, [][]byte)) {
+	var lock sync.Mutex
+	var queries []string
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-ClickHouse-User") != "default" || r.Header.Get("X-ClickHouse-Key") != "secret" {
+			t.Errorf("unexpected authentication %v", r.Header)
+		}
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("gzip: %v", err)
+				return
+			}
+			reader = zr
+		}
+		body, _ := io.ReadAll(reader)
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			if !strings.HasPrefix(string(body), "DESCRIBE TABLE `default`.`flows`") {
+				t.Errorf("unexpected query %s", body)
+			}
+			io.WriteString(w, describeTable)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			failures--
+			w.Header().Set("X-ClickHouse-Exception-Code", "252")
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Code: 252. DB::Exception: Too many parts")
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		bodies = append(bodies, body)
+	}))
+	return server, func() ([]string, [][]byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		return queries, bodies
+	}
+}
+
+func newTestDriver(url, format string) *ClickhouseDriver {
+	return &ClickhouseDriver{
+		url:          url,
+		database:     "default",
+		table:        "flows",
+		username:     "default",
+		password:     "secret",
+		format:       format,
+		asyncInsert:  true,
+		timeout:      time.Second,
+		batchSize:    10,
+		compression:  true,
+		retries:      2,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+	}
+}
+
+func TestClickhouseJSONEachRow(t *testing.T) {
+	t.Parallel()
+	server, inserts := testServer(t, 1)
+	defer server.Close()
+
+	d := newTestDriver(server.URL, formatJSONEachRow)
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	// fields of the mapping which are not in the table are not inserted
+	d.SetFields([]transport.Field{{Name: "src_addr"}, {Name: "bytes"}, {Name: "sampler_address"}})
+	rows := []string{
+		`{"src_addr":"2001:db8::1","bytes":1500,"sampler_address":"192.0.2.1"}`,
+		`{"src_addr":"2001:db8::2","bytes":100,"sampler_address":"192.0.2.1"}`,
+	}
+	for _, row := range rows {
+		if err := d.Send(nil, []byte(row)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queries, bodies := inserts()
+	if len(queries) != 1 {
+		t.Fatalf("expected 1 insert, got %d", len(queries))
+	}
+	for _, expected := range []string{
+		"INSERT+INTO+%60default%60.%60flows%60+%28%60src_addr%60%2C+%60bytes%60%29+FORMAT+JSONEachRow",
+		"async_insert=1",
+		"input_format_skip_unknown_fields=1",
+	} {
+		if !strings.Contains(queries[0], expected) {
+			t.Fatalf("expected %s in the query, got %s", expected, queries[0])
+		}
+	}
+	if expected := strings.Join(rows, "\n") + "\n"; string(bodies[0]) != expected {
+		t.Fatalf("expected %q, got %q", expected, bodies[0])
+	}
+}
+
+func TestClickhouseRowBinary(t *testing.T) {
+	t.Parallel()
+	server, inserts := testServer(t, 0)
+	defer server.Close()
+
+	d := newTestDriver(server.URL, formatRowBinary)
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	// the row which cannot be encoded is skipped, the other one inserted
+	for _, row := range []string{
+		`{"time_received_ns":1714554000000000001,"src_addr":"invalid","proto":"TCP","bytes":1500}`,
+		`{"time_received_ns":1714554000000000001,"src_addr":"192.0.2.1","proto":"TCP","bytes":1500,"as_path":[65000,65001]}`,
+	} {
+		if err := d.Send(nil, []byte(row)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var errs []error
+	for err := range d.Errors() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "skip row: column src_addr") {
+		t.Fatalf("expected the skipped row error, got %v", errs)
+	}
+
+	queries, bodies := inserts()
+	if len(queries) != 1 || !strings.Contains(queries[0], "%60as_path%60%29+FORMAT+RowBinary") {
+		t.Fatalf("expected 1 insert of all the columns, got %v", queries)
+	}
+	expected, _ := hex.DecodeString("01a03966c751cb17" + // time_received_ns
+		"00000000000000000000ffffc0000201" + // src_addr
+		"03544350" + // proto
+		"dc05000000000000" + // bytes
+		"02e8fd0000e9fd0000") // as_path
+	if !bytes.Equal(bodies[0], expected) {
+		t.Fatalf("expected %x, got %x", expected, bodies[0])
+	}
+}
+
+func TestRowBinaryDateTime(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		typ      string
+		value    interface{}
+		expected string
+	}{
+		{"DateTime", json.Number("1714554000123456789"), "90043266"},
+		{"DateTime('UTC')", "2024-05-01T09:00:00.123456789Z", "90043266"},
+		{"DateTime64(3)", json.Number("1714554000123456789"), "fbd261338f010000"},
+		{"DateTime64(6, 'UTC')", "2024-05-01T09:00:00.123456789Z", "402620b660170600"},
+		{"DateTime64(9)", json.Number("1714554000123456789"), "156d956dc751cb17"},
+	} {
+		enc, err := newEncoder(test.typ)
+		if err != nil {
+			t.Fatalf("%s: %v", test.typ, err)
+		}
+		b, err := enc(nil, test.value)
+		if err != nil {
+			t.Fatalf("%s: %v", test.typ, err)
+		}
+		if encoded := hex.EncodeToString(b); encoded != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.typ, test.expected, encoded)
+		}
+	}
+}
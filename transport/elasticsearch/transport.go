@@ -0,0 +1,375 @@
+// Package elasticsearch implements an Elasticsearch/OpenSearch bulk transport.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+)
+
+// item is a document and the action line indexing it.
+type item struct {
+	action []byte
+	doc    []byte
+}
+
+type batch struct {
+	items []item
+	bytes int
+}
+
+func (b *batch) Len() int  { return len(b.items) }
+func (b *batch) Size() int { return b.bytes }
+
+// bulkResponse is the part of a bulk response describing the result of each item.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// ElasticsearchDriver batches JSON documents (see the json and ecs formats) and writes them
+// with the bulk API of Elasticsearch or OpenSearch, in an index named after the current date.
+// The items rejected with a 429 or 5xx status are retried, the others are dropped.
+// The index template is created from the output fields of the mapping.
+type ElasticsearchDriver struct {
+	url           string
+	index         string
+	action        string
+	username      string
+	password      string
+	apiKey        string
+	timeout       time.Duration
+	batchSize     int
+	batchBytes    int
+	flushInterval time.Duration
+	compression   bool
+	retries       int
+	retryBackoff  time.Duration
+	queueSize     int
+	template      bool
+	templateName  string
+
+	client          *http.Client
+	templateCreated bool
+	batcher         *batcher.Batcher[*batch]
+
+	lock   sync.Mutex
+	fields []transport.Field
+}
+
+// Prepare registers flags for the Elasticsearch transport configuration.
+func (d *ElasticsearchDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.elasticsearch.url", "http://localhost:9200", "Elasticsearch or OpenSearch URL")
+	flag.StringVar(&d.index, "transport.elasticsearch.index", "goflow-%Y.%m.%d", "Index name, %Y, %m, %d and %H are replaced by the current date (UTC)")
+	flag.StringVar(&d.action, "transport.elasticsearch.action", "index", "Bulk action (index, or create for data streams)")
+	flag.StringVar(&d.username, "transport.elasticsearch.username", "", "Username of the basic authentication")
+	flag.StringVar(&d.password, "transport.elasticsearch.password", "", "Password of the basic authentication")
+	flag.StringVar(&d.apiKey, "transport.elasticsearch.apikey", "", "API key (base64 encoded)")
+	flag.DurationVar(&d.timeout, "transport.elasticsearch.timeout", 30*time.Second, "Bulk request timeout")
+	flag.IntVar(&d.batchSize, "transport.elasticsearch.batch", 1000, "Maximum number of documents per bulk request")
+	flag.IntVar(&d.batchBytes, "transport.elasticsearch.batch.bytes", 5<<20, "Maximum size of the documents of a bulk request (0 for no limit)")
+	flag.DurationVar(&d.flushInterval, "transport.elasticsearch.flush", 5*time.Second, "Maximum time before writing a partial batch")
+	flag.BoolVar(&d.compression, "transport.elasticsearch.gzip", false, "Compress bulk requests with gzip")
+	flag.IntVar(&d.retries, "transport.elasticsearch.retries", 5, "Maximum number of retries of the failed items of a bulk request")
+	flag.DurationVar(&d.retryBackoff, "transport.elasticsearch.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.IntVar(&d.queueSize, "transport.elasticsearch.queue", 16, "Number of batches waiting to be written before blocking")
+	flag.BoolVar(&d.template, "transport.elasticsearch.template", false, "Create an index template from the output fields of the mapping")
+	flag.StringVar(&d.templateName, "transport.elasticsearch.template.name", "goflow", "Name of the index template")
+	return nil
+}
+
+// SetFields sets the output fields of the mapping, used in the index template.
+func (d *ElasticsearchDriver) SetFields(fields []transport.Field) {
+	d.lock.Lock()
+	d.fields = fields
+	d.lock.Unlock()
+}
+
+// Init starts the batching and write routines.
+func (d *ElasticsearchDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("elasticsearch transport: batch size must be positive")
+	}
+	if d.action != "index" && d.action != "create" {
+		return fmt.Errorf("elasticsearch transport: unsupported action %s", d.action)
+	}
+	if d.index == "" {
+		return fmt.Errorf("elasticsearch transport: missing index")
+	}
+	d.url = strings.TrimSuffix(d.url, "/")
+	d.client = &http.Client{Timeout: d.timeout}
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "elasticsearch",
+		BatchSize:     d.batchSize,
+		BatchBytes:    d.batchBytes,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+	}, func() *batch { return &batch{} }, d.write)
+	return nil
+}
+
+// indexName returns the index of the documents written at t.
+func indexName(pattern string, t time.Time) string {
+	t = t.UTC()
+	return strings.NewReplacer(
+		"%Y", fmt.Sprintf("%04d", t.Year()),
+		"%m", fmt.Sprintf("%02d", t.Month()),
+		"%d", fmt.Sprintf("%02d", t.Day()),
+		"%H", fmt.Sprintf("%02d", t.Hour()),
+		"%%", "%",
+	).Replace(pattern)
+}
+
+// indexPattern returns the pattern matching the indices of the documents.
+func indexPattern(pattern string) string {
+	return strings.NewReplacer("%Y", "*", "%m", "*", "%d", "*", "%H", "*", "%%", "%").Replace(pattern)
+}
+
+// fieldTypes are the types of the index template by type of rendered field.
+var fieldTypes = map[string]string{
+	"ip":       "ip",
+	"datetime": "date",
+	"string":   "keyword",
+	"integer":  "long",
+	"float":    "double",
+	"bool":     "boolean",
+}
+
+// indexTemplate returns an index template with the types of the fields.
+// The fields of unknown type are mapped dynamically.
+func (d *ElasticsearchDriver) indexTemplate(fields []transport.Field) ([]byte, error) {
+	properties := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if t, ok := fieldTypes[field.Type]; ok {
+			properties[field.Name] = map[string]string{"type": t}
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"index_patterns": []string{indexPattern(d.index)},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{"properties": properties},
+		},
+	})
+}
+
+// write creates the index template if needed and writes a batch, retrying the failed
+// requests and the failed items.
+func (d *ElasticsearchDriver) write(b *batch) (int, error) {
+	if d.template && !d.templateCreated {
+		d.createTemplate()
+	}
+	items := b.items
+	var dropped int
+	var dropErr error
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		res := d.bulkOnce(items)
+		if res.dropped > 0 {
+			dropped += res.dropped
+			if dropErr == nil {
+				dropErr = res.dropErr
+			}
+		}
+		items = res.retry
+		if len(items) > 0 {
+			return 0, true, res.retryErr
+		}
+		if dropped == len(b.items) {
+			return 0, false, dropErr // the request failed if nothing was written
+		}
+		return 0, false, nil
+	})
+	switch {
+	case len(items) > 0:
+		return len(items) + dropped, fmt.Errorf("write batch: %d documents not written: %w", len(items), err)
+	case dropped > 0:
+		return dropped, fmt.Errorf("write batch: %d documents dropped, first error: %w", dropped, dropErr)
+	}
+	return 0, nil
+}
+
+// createTemplate puts the index template, which is attempted again before the next batch on failure.
+func (d *ElasticsearchDriver) createTemplate() {
+	d.lock.Lock()
+	fields := d.fields
+	d.lock.Unlock()
+	if len(fields) == 0 {
+		d.templateCreated = true // the fields are only known with the sample producer
+		d.batcher.ReportError(fmt.Errorf("create index template: no output fields of the mapping"))
+		return
+	}
+	if err := d.putTemplate(fields); err != nil {
+		d.batcher.ReportError(fmt.Errorf("create index template: %w", err))
+		return
+	}
+	d.templateCreated = true
+}
+
+func (d *ElasticsearchDriver) putTemplate(fields []transport.Field) error {
+	template, err := d.indexTemplate(fields)
+	if err != nil {
+		return err
+	}
+	resp, body, err := d.request(http.MethodPut, "/_index_template/"+d.templateName, "application/json", template)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// request sends a request and returns its response and body.
+func (d *ElasticsearchDriver) request(method, path, contentType string, payload []byte) (*http.Response, []byte, error) {
+	encoding := ""
+	if d.compression {
+		var err error
+		if payload, err = batcher.Gzip(payload); err != nil {
+			return nil, nil, err
+		}
+		encoding = "gzip"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, d.url+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if d.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+d.apiKey)
+	} else if d.username != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp, body, nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// bulkResult is the outcome of a bulk request for the items which were not written.
+type bulkResult struct {
+	retry    []item // items to retry
+	retryErr error  // error of the first item to retry
+	dropped  int    // number of items which cannot be retried
+	dropErr  error  // error of the first dropped item
+}
+
+// bulkOnce sends a bulk request and returns the items to retry and the dropped items.
+func (d *ElasticsearchDriver) bulkOnce(items []item) bulkResult {
+	var body bytes.Buffer
+	for _, it := range items {
+		body.Write(it.action)
+		body.WriteByte('\n')
+		body.Write(it.doc)
+		body.WriteByte('\n')
+	}
+	resp, respBody, err := d.request(http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return bulkResult{retry: items, retryErr: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(respBody))
+		if retryable(resp.StatusCode) {
+			return bulkResult{retry: items, retryErr: err}
+		}
+		return bulkResult{dropped: len(items), dropErr: err}
+	}
+
+	// the documents of an unexpected response are dropped, as their result is unknown
+	var result bulkResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return bulkResult{dropped: len(items), dropErr: fmt.Errorf("decode bulk response: %w", err)}
+	}
+	if !result.Errors {
+		return bulkResult{}
+	}
+	if len(result.Items) != len(items) {
+		return bulkResult{dropped: len(items), dropErr: fmt.Errorf("bulk response has %d items, expected %d", len(result.Items), len(items))}
+	}
+	var res bulkResult
+	for i, r := range result.Items {
+		for _, status := range r {
+			switch {
+			case status.Status >= 200 && status.Status < 300:
+			case retryable(status.Status):
+				res.retry = append(res.retry, items[i])
+				if res.retryErr == nil {
+					res.retryErr = fmt.Errorf("document rejected with status %d: %s", status.Status, status.Error)
+				}
+			default:
+				res.dropped++
+				if res.dropErr == nil {
+					res.dropErr = fmt.Errorf("document rejected with status %d: %s", status.Status, status.Error)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Send appends a document to the current batch, queuing it for writing when full.
+func (d *ElasticsearchDriver) Send(key, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	action, err := json.Marshal(map[string]map[string]string{
+		d.action: {"_index": indexName(d.index, time.Now())},
+	})
+	if err != nil {
+		return fmt.Errorf("elasticsearch transport: %w", err)
+	}
+	doc := append([]byte(nil), data...)
+	return d.batcher.Add(func(b *batch) error {
+		b.items = append(b.items, item{action, doc})
+		b.bytes += len(doc)
+		return nil
+	})
+}
+
+// Errors returns write errors.
+func (d *ElasticsearchDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close writes the remaining documents and stops the routines.
+func (d *ElasticsearchDriver) Close() error {
+	if d.batcher != nil {
+		d.batcher.Close()
+	}
+	return nil
+}
+
+func init() {
+	d := &ElasticsearchDriver{}
+	transport.RegisterTransportDriver("elasticsearch", d)
+}
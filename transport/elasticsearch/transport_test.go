@@ -0,0 +1,145 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+)
+
+func TestIndexName(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if name := indexName("goflow-%Y.%m.%d-%H", now); name != "goflow-2024.05.01-09" {
+		t.Fatalf("expected goflow-2024.05.01-09, got %s", name)
+	}
+	if pattern := indexPattern("goflow-%Y.%m.%d"); pattern != "goflow-*.*.*" {
+		t.Fatalf("expected goflow-*.*.*, got %s", pattern)
+	}
+}
+
+func TestElasticsearchTransport(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	var template map[string]interface{}
+	var written []string
+	var requests, templates int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "elastic" || password != "secret" {
+			t.Errorf("unexpected authentication %v", r.Header)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Method == http.MethodPut && r.URL.Path == "/_index_template/goflow" {
+			// the template is created again before the next batch after a failure
+			if templates++; templates == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+				t.Errorf("decode template: %v", err)
+			}
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/_bulk" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			return
+		}
+		requests++
+		var docs []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			action := scanner.Text()
+			if !strings.HasPrefix(action, `{"index":{"_index":"goflow-`) || !scanner.Scan() {
+				t.Errorf("unexpected action %s", action)
+				return
+			}
+			docs = append(docs, scanner.Text())
+		}
+		// the first request has a rejected and a throttled document
+		var items []string
+		for _, doc := range docs {
+			status := 201
+			if requests == 1 && strings.Contains(doc, `"bytes":100`) {
+				status = 429
+			} else if strings.Contains(doc, `"bytes":"invalid"`) {
+				status = 400
+			} else {
+				written = append(written, doc)
+			}
+			items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"test"}}}`, status))
+		}
+		io.WriteString(w, `{"errors":true,"items":[`+strings.Join(items, ",")+`]}`)
+	}))
+	defer server.Close()
+
+	d := &ElasticsearchDriver{
+		url:          server.URL,
+		index:        "goflow-%Y.%m.%d",
+		action:       "index",
+		username:     "elastic",
+		password:     "secret",
+		timeout:      time.Second,
+		batchSize:    2,
+		retries:      1,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+		template:     true,
+		templateName: "goflow",
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	d.SetFields([]transport.Field{
+		{Name: "src_addr", Type: "ip"},
+		{Name: "proto", Type: "string"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "time_received", Type: "datetime"},
+		{Name: "custom"},
+	})
+	for _, doc := range []string{
+		`{"src_addr":"10.0.0.1","proto":"TCP","bytes":1500,"time_received":"2024-05-01T09:00:00Z"}`,
+		`{"src_addr":"10.0.0.2","proto":"UDP","bytes":100}`,
+		`{"src_addr":"10.0.0.3","proto":"UDP","bytes":"invalid"}`,
+	} {
+		if err := d.Send(nil, []byte(doc)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var errs []error
+	for err := range d.Errors() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "create index template") || !strings.Contains(errs[1].Error(), "1 documents dropped") {
+		t.Fatalf("expected the template and rejected document errors, got %v", errs)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 3 || len(written) != 2 || !strings.Contains(written[1], `"bytes":100`) {
+		t.Fatalf("expected 2 documents in 3 requests, got %d requests: %q", requests, written)
+	}
+	if templates != 2 {
+		t.Fatalf("expected the template created at the second attempt, got %d attempts", templates)
+	}
+	properties := template["template"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	for field, expected := range map[string]string{"src_addr": "ip", "proto": "keyword", "bytes": "long", "time_received": "date"} {
+		if typ := properties[field].(map[string]interface{})["type"]; typ != expected {
+			t.Fatalf("expected %s type for %s, got %v", expected, field, typ)
+		}
+	}
+	if _, ok := properties["custom"]; ok {
+		t.Fatal("expected the field of unknown type mapped dynamically")
+	}
+}
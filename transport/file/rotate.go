@@ -0,0 +1,286 @@
+package file
+
+import (
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Segments are written under a temporary name and renamed once closed,
+// so that loaders watching the output directory only see complete files.
+const partialSuffix = ".tmp"
+
+// maxCounters bounds the names for which the last counter is remembered.
+const maxCounters = 1024
+
+// pathReplacer prevents field values from changing the directory of a segment.
+var pathReplacer = strings.NewReplacer("/", "_", "\\", "_", "..", "_")
+
+// segment is an output file being written.
+type segment struct {
+	partition string // rendered template
+	path      string // final path, the file is written at path+partialSuffix
+	file      *os.File
+	size      int64
+	deadline  time.Time
+
+	key    []byte
+	fields map[string]string
+	elem   *list.Element
+}
+
+func (d *FileDriver) compressionExt() string {
+	switch d.rotateCompress {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	}
+	return ""
+}
+
+// segmentPath returns the final path of a new segment of a partition, adding a
+// counter before the extension if the name is already used.
+func (d *FileDriver) segmentPath(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	used := func(path string) bool {
+		for _, s := range d.segments {
+			if s.path == path {
+				return true
+			}
+		}
+		for _, suffix := range []string{"", partialSuffix, d.compressionExt()} {
+			if _, err := os.Stat(path + suffix); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	// the counter does not go back when older segments are removed by the retention
+	i := d.counters[base]
+	if i > 0 {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	for used(name) {
+		i++
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if i > 0 {
+		if len(d.counters) >= maxCounters {
+			clear(d.counters)
+		}
+		d.counters[base] = i
+	}
+	return name
+}
+
+// openSegment creates a segment for the messages of a partition.
+func (d *FileDriver) openSegment(now time.Time, partition string, key []byte, fields map[string]string) (*segment, error) {
+	s := &segment{
+		partition: partition,
+		path:      d.segmentPath(partition),
+		key:       append([]byte(nil), key...),
+		fields:    fields,
+	}
+	if d.rotateInterval > 0 {
+		s.deadline = now.Truncate(d.rotateInterval).Add(d.rotateInterval)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path+partialSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open file %s: %w", s.path, err)
+	}
+	s.file = file
+	if err := d.writeHeader(s); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *segment) Write(b []byte) (int, error) {
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	return n, err
+}
+
+// sendSegment writes a message to the segment of its partition, rotating it when it
+// reaches the maximum size. It must be called with the lock held.
+func (d *FileDriver) sendSegment(key, data []byte) error {
+	now := time.Now()
+	fields := d.template.Fields(data)
+	partition := d.template.RenderFields(now, key, fields)
+	s, ok := d.segments[partition]
+	if ok {
+		d.lru.MoveToFront(s.elem)
+	} else {
+		if d.maxOpen > 0 && len(d.segments) >= d.maxOpen {
+			d.closeSegment(d.lru.Back().Value.(*segment))
+		}
+		var err error
+		if s, err = d.openSegment(now, partition, key, fields); err != nil {
+			return err
+		}
+		d.segments[partition] = s
+		s.elem = d.lru.PushFront(s)
+	}
+	if err := d.write(s, data); err != nil {
+		return err
+	}
+	if d.rotateSize > 0 && s.size >= d.rotateSize {
+		d.closeSegment(s)
+	}
+	return nil
+}
+
+// closeSegment closes a segment and makes it visible under its final name,
+// compressing it in the background if configured.
+func (d *FileDriver) closeSegment(s *segment) {
+	delete(d.segments, s.partition)
+	d.lru.Remove(s.elem)
+	if err := s.file.Close(); err != nil {
+		d.reportError(fmt.Errorf("close %s: %w", s.path, err))
+	}
+	if d.rotateCompress == "" {
+		if err := os.Rename(s.path+partialSuffix, s.path); err != nil {
+			d.reportError(fmt.Errorf("rename %s: %w", s.path, err))
+		}
+		d.applyRetention()
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if err := d.compress(s.path); err != nil {
+			d.reportError(fmt.Errorf("compress %s: %w", s.path, err))
+		}
+		d.applyRetention()
+	}()
+}
+
+// rotate closes the segments that reached their deadline or whose partition is over
+// (eg: the hour of the name is past), or all of them if force is set.
+// It must be called with the lock held.
+func (d *FileDriver) rotate(now time.Time, force bool) {
+	for _, s := range d.segments {
+		if force || (!s.deadline.IsZero() && !now.Before(s.deadline)) ||
+			d.template.RenderFields(now, s.key, s.fields) != s.partition {
+			d.closeSegment(s)
+		}
+	}
+}
+
+// compress writes the compressed copy of a closed segment and removes the original.
+func (d *FileDriver) compress(path string) error {
+	src, err := os.Open(path + partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dstPath := path + d.compressionExt()
+	dst, err := os.OpenFile(dstPath+partialSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var zw io.WriteCloser
+	if d.rotateCompress == "zstd" {
+		if zw, err = zstd.NewWriter(dst); err != nil {
+			dst.Close()
+			return err
+		}
+	} else {
+		zw = gzip.NewWriter(dst)
+	}
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// keeps the closing time of the segment for the retention
+		err = os.Chtimes(dstPath+partialSuffix, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(dstPath+partialSuffix, dstPath)
+	}
+	if err != nil {
+		os.Remove(dstPath + partialSuffix)
+		return err
+	}
+	return os.Remove(path + partialSuffix)
+}
+
+// retentionPattern returns the glob matching the closed segments of the template.
+func (d *FileDriver) retentionPattern() string {
+	pattern := d.template.Pattern("*")
+	ext := filepath.Ext(pattern)
+	return strings.TrimSuffix(pattern, ext) + "*" + ext
+}
+
+// applyRetention removes the oldest closed segments beyond the maximum count
+// and the ones older than the maximum age.
+func (d *FileDriver) applyRetention() {
+	if d.rotateKeep <= 0 && d.rotateMaxAge <= 0 {
+		return
+	}
+	d.retentionLock.Lock()
+	defer d.retentionLock.Unlock()
+
+	pattern := d.retentionPattern()
+	var matches []string
+	for _, p := range []string{pattern, pattern + d.compressionExt()} {
+		m, err := filepath.Glob(p)
+		if err != nil {
+			d.reportError(fmt.Errorf("retention: %w", err))
+			return
+		}
+		matches = append(matches, m...)
+	}
+	slices.Sort(matches)
+	matches = slices.Compact(matches)
+
+	type closedSegment struct {
+		path    string
+		modTime time.Time
+	}
+	var closed []closedSegment
+	for _, path := range matches {
+		if strings.HasSuffix(path, partialSuffix) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		closed = append(closed, closedSegment{path, info.ModTime()})
+	}
+	// newest first
+	slices.SortFunc(closed, func(a, b closedSegment) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	for i, s := range closed {
+		if (d.rotateKeep > 0 && i >= d.rotateKeep) || (d.rotateMaxAge > 0 && time.Since(s.modTime) > d.rotateMaxAge) {
+			if err := os.Remove(s.path); err != nil {
+				d.reportError(fmt.Errorf("retention: %w", err))
+			}
+		}
+	}
+}
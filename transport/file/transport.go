@@ -2,6 +2,7 @@
 package file
 
 import (
+	"container/list"
 	"flag"
 	"fmt"
 	"io"
@@ -9,11 +10,14 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/tgragnato/goflow/transport"
 )
 
 // FileDriver writes formatted messages to stdout or a file.
+// When rotation is enabled or the file name has placeholders, the file name is a template
+// and messages are written to segments.
 type FileDriver struct {
 	fileDestination string
 	lineSeparator   string
@@ -21,12 +25,61 @@ type FileDriver struct {
 	file            *os.File
 	lock            *sync.RWMutex
 	reloadCh        chan os.Signal
+	header          func() []byte
+	headerPending   bool // the output is empty, the header is written before the next message
+	closed          bool
+
+	rotateSize     int64
+	rotateInterval time.Duration
+	rotateCompress string
+	rotateKeep     int
+	rotateMaxAge   time.Duration
+	maxOpen        int
+
+	template      *transport.Template
+	segments      map[string]*segment
+	lru           *list.List
+	counters      map[string]int
+	retentionLock sync.Mutex
+	errors        chan error
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+// SetHeader sets the function returning the header written at the start of each file.
+func (d *FileDriver) SetHeader(header func() []byte) {
+	d.lock.Lock()
+	d.header = header
+	d.lock.Unlock()
+}
+
+func (d *FileDriver) writeHeader(w io.Writer) error {
+	if d.header == nil {
+		return nil
+	}
+	header := d.header()
+	if header == nil {
+		return nil
+	}
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	if _, err := w.Write([]byte(d.lineSeparator)); err != nil {
+		return fmt.Errorf("write header separator: %w", err)
+	}
+	return nil
 }
 
 // Prepare registers flags for file transport configuration.
 func (d *FileDriver) Prepare() error {
-	flag.StringVar(&d.fileDestination, "transport.file", "", "File/console output (empty for stdout)")
+	flag.StringVar(&d.fileDestination, "transport.file", "", "File/console output (empty for stdout), a name template when rotating")
 	flag.StringVar(&d.lineSeparator, "transport.file.sep", "\n", "Line separator")
+	flag.Int64Var(&d.rotateSize, "transport.file.rotate.size", 0, "Rotate the file when it reaches this size in bytes (0 to disable)")
+	flag.DurationVar(&d.rotateInterval, "transport.file.rotate.interval", 0, "Rotate the file at this interval (0 to disable)")
+	flag.StringVar(&d.rotateCompress, "transport.file.rotate.compress", "", "Compression of the rotated files (gzip, zstd)")
+	flag.IntVar(&d.rotateKeep, "transport.file.rotate.keep", 0, "Number of rotated files to keep (0 to keep all)")
+	flag.DurationVar(&d.rotateMaxAge, "transport.file.rotate.maxage", 0, "Remove the rotated files older than this (0 to keep all)")
+	flag.IntVar(&d.maxOpen, "transport.file.maxopen", 64, "Maximum number of files open at once, the least recently written is closed first (0 for no limit)")
 	// idea: add terminal coloring based on key partitioning (if any)
 	return nil
 }
@@ -36,15 +89,100 @@ func (d *FileDriver) openFile() error {
 	if err != nil {
 		return fmt.Errorf("open file %s: %w", d.fileDestination, err)
 	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat file %s: %w", d.fileDestination, err)
+	}
 	d.file = file
 	d.w = d.file
+	// the header is not written in the middle of an appended file
+	d.headerPending = info.Size() == 0
+	return nil
+}
+
+func (d *FileDriver) segmented() bool {
+	return d.rotateSize > 0 || d.rotateInterval > 0 || d.rotateCompress != "" || !d.template.Static()
+}
+
+func (d *FileDriver) reportError(err error) {
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// Errors returns rotation errors.
+func (d *FileDriver) Errors() <-chan error {
+	return d.errors
+}
+
+// initSegments checks the rotation options and starts the interval and reload handling.
+func (d *FileDriver) initSegments() error {
+	if d.fileDestination == "" {
+		return fmt.Errorf("rotation requires a file")
+	}
+	switch d.rotateCompress {
+	case "", "gzip", "zstd":
+	default:
+		return fmt.Errorf("unknown compression %s", d.rotateCompress)
+	}
+	if d.rotateSize < 0 || d.rotateInterval < 0 || d.rotateKeep < 0 || d.rotateMaxAge < 0 || d.maxOpen < 0 {
+		return fmt.Errorf("negative rotation option")
+	}
+
+	d.segments = make(map[string]*segment)
+	d.lru = list.New()
+	d.counters = make(map[string]int)
+	d.errors = make(chan error, 16)
+	d.stopCh = make(chan struct{})
+	d.reloadCh = make(chan os.Signal, 1)
+	signal.Notify(d.reloadCh, syscall.SIGHUP)
+
+	// an idle segment is closed at its deadline or at the end of its time partition
+	// rather than on the next message
+	tick := time.Second
+	if d.rotateInterval > 0 && d.rotateInterval < tick {
+		tick = d.rotateInterval
+	}
+	ticker := time.NewTicker(tick)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stopCh:
+				return
+			case <-d.reloadCh:
+				d.lock.Lock()
+				d.rotate(time.Now(), true)
+				d.lock.Unlock()
+			case now := <-ticker.C:
+				d.lock.Lock()
+				d.rotate(now, false)
+				d.lock.Unlock()
+			}
+		}
+	}()
 	return nil
 }
 
 // Init initializes the output destination and reload handling.
 func (d *FileDriver) Init() error {
-	if d.fileDestination == "" {
+	d.template = transport.NewTemplate(d.fileDestination, pathReplacer)
+	d.lock.Lock()
+	d.closed = false
+	d.lock.Unlock()
+	if d.segmented() {
+		if err := d.initSegments(); err != nil {
+			return fmt.Errorf("file transport init: %w", err)
+		}
+	} else if d.fileDestination == "" {
+		d.lock.Lock()
 		d.w = os.Stdout
+		d.headerPending = true
+		d.lock.Unlock()
 	} else {
 		var err error
 
@@ -80,11 +218,36 @@ func (d *FileDriver) Init() error {
 	return nil
 }
 
-// Send writes a formatted message and separator to the destination.
+// Send writes a formatted message and separator to the destination, after the header
+// at the start of an empty file or of stdout. It fails once the transport is closed.
 func (d *FileDriver) Send(key, data []byte) error {
 	d.lock.RLock()
-	w := d.w
+	closed, segmented, headerPending, w := d.closed, d.segments != nil, d.headerPending, d.w
 	d.lock.RUnlock()
+	if closed {
+		return fmt.Errorf("file transport: closed")
+	}
+	if !segmented && !headerPending {
+		return d.write(w, data)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return fmt.Errorf("file transport: closed")
+	}
+	if segmented {
+		return d.sendSegment(key, data)
+	}
+	if d.headerPending {
+		d.headerPending = false
+		if err := d.writeHeader(d.w); err != nil {
+			return err
+		}
+	}
+	return d.write(d.w, data)
+}
+
+func (d *FileDriver) write(w io.Writer, data []byte) error {
 	if len(data) > 0 {
 		if _, err := w.Write(data); err != nil {
 			return fmt.Errorf("write message: %w", err)
@@ -101,7 +264,26 @@ func (d *FileDriver) Send(key, data []byte) error {
 }
 
 // Close closes the output file and stops reload handling.
+// Segments are closed and renamed, waiting for their compression.
 func (d *FileDriver) Close() error {
+	d.lock.Lock()
+	closed := d.closed
+	d.closed = true
+	d.lock.Unlock()
+	if closed {
+		return nil
+	}
+	if d.segments != nil {
+		signal.Stop(d.reloadCh)
+		close(d.stopCh)
+		d.lock.Lock()
+		d.rotate(time.Now(), true)
+		d.segments = nil
+		d.lock.Unlock()
+		d.wg.Wait()
+		close(d.errors)
+		return nil
+	}
 	var closeErr error
 	if d.fileDestination != "" {
 		d.lock.Lock()
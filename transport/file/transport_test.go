@@ -0,0 +1,193 @@
+package file
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRotateSize(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	d := &FileDriver{
+		fileDestination: filepath.Join(dir, "flows.csv"),
+		lineSeparator:   "\n",
+		lock:            &sync.RWMutex{},
+		rotateSize:      25,
+		rotateCompress:  "gzip",
+		rotateKeep:      2,
+	}
+	d.SetHeader(func() []byte { return []byte("proto,bytes") })
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, line := range []string{"TCP,1500", "UDP,100", "TCP,40", "UDP,60", "ICMP,84"} {
+		if err := d.Send(nil, []byte(line)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected rotation error: %v", err)
+	}
+
+	// 3 segments of 2, 2 and 1 rows, the oldest is removed by the retention
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 || names[0] != "flows-1.csv.gz" || names[1] != "flows-2.csv.gz" {
+		t.Fatalf("expected 2 compressed segments, got %v", names)
+	}
+	f, err := os.Open(filepath.Join(dir, names[1]))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(content) != "proto,bytes\nICMP,84\n" {
+		t.Fatalf("unexpected segment %q", content)
+	}
+}
+
+func TestRotateIntervalByKey(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	d := &FileDriver{
+		fileDestination: filepath.Join(dir, "{key}", "flows.log"),
+		lineSeparator:   "\n",
+		lock:            &sync.RWMutex{},
+		rotateInterval:  50 * time.Millisecond,
+		rotateCompress:  "zstd",
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	defer d.Close()
+	if err := d.Send([]byte{1}, []byte("a")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := d.Send([]byte{2}, []byte("b")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	// the segments are closed at their deadline without further messages
+	path := filepath.Join(dir, "02", "flows.log.zst")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatalf("zstd reader: %v", err)
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(content) != "b\n" {
+		t.Fatalf("unexpected segment %q", content)
+	}
+}
+
+func TestPartitionByField(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	d := &FileDriver{
+		fileDestination: filepath.Join(dir, "{sampler_address}", "{yyyy}{mm}{dd}.ndjson"),
+		lineSeparator:   "\n",
+		lock:            &sync.RWMutex{},
+		maxOpen:         1,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, line := range []string{
+		`{"sampler_address":"192.0.2.1","bytes":1}`,
+		`{"sampler_address":"192.0.2.1","bytes":2}`,
+		`{"sampler_address":"../192.0.2.2","bytes":3}`, // closes the least recently written file
+		`{"sampler_address":"192.0.2.1","bytes":4}`,
+		`not json`,
+	} {
+		if err := d.Send(nil, []byte(line)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	name := time.Now().UTC().Format("20060102")
+	for path, expected := range map[string]string{
+		filepath.Join(dir, "192.0.2.1", name+".ndjson"):   `{"sampler_address":"192.0.2.1","bytes":1}` + "\n" + `{"sampler_address":"192.0.2.1","bytes":2}` + "\n",
+		filepath.Join(dir, "192.0.2.1", name+"-1.ndjson"): `{"sampler_address":"192.0.2.1","bytes":4}` + "\n",
+		filepath.Join(dir, "__192.0.2.2", name+".ndjson"): `{"sampler_address":"../192.0.2.2","bytes":3}` + "\n",
+		filepath.Join(dir, "none", name+".ndjson"):        "not json\n",
+	} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if string(content) != expected {
+			t.Fatalf("expected %q in %s, got %q", expected, path, content)
+		}
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for _, destination := range []string{"flows.ndjson", "{proto}.ndjson"} {
+		d := &FileDriver{
+			fileDestination: filepath.Join(dir, destination),
+			lineSeparator:   "\n",
+			lock:            &sync.RWMutex{},
+		}
+		if err := d.Init(); err != nil {
+			t.Fatalf("init: %v", err)
+		}
+		if err := d.Send(nil, []byte(`{"proto":"TCP"}`)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if err := d.Send(nil, []byte(`{"proto":"UDP"}`)); err == nil {
+			t.Fatalf("%s: expected an error after close", destination)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("%s: expected a second close to succeed, got %v", destination, err)
+		}
+	}
+}
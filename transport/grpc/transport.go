@@ -0,0 +1,364 @@
+// Package grpc implements a transport forwarding flows to another collector over gRPC.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/metrics"
+	flowpb "github.com/tgragnato/goflow/pb"
+	"github.com/tgragnato/goflow/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// GrpcDriver batches the flows, formatted with the bin format, and streams them to the grpc
+// listener of another collector. At most window batches are sent without being acknowledged,
+// the batches not acknowledged being sent again after a reconnection (so a flow may be received twice).
+type GrpcDriver struct {
+	target        string
+	tls           bool
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+	tlsInsecure   bool
+	timeout       time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	window        int
+	retryBackoff  time.Duration
+	retryMax      time.Duration
+	queueSize     int
+
+	conn   *grpc.ClientConn
+	client flowpb.ForwarderClient
+
+	lock  sync.Mutex
+	batch *flowpb.FlowBatch
+
+	queue  chan *flowpb.FlowBatch
+	errors chan error
+	stopCh chan struct{}
+	wg     sync.WaitGroup // forward routine
+	tickWg sync.WaitGroup // flush routine
+}
+
+// Prepare registers flags for the gRPC transport configuration.
+func (d *GrpcDriver) Prepare() error {
+	flag.StringVar(&d.target, "transport.grpc.target", "localhost:9000", "Address of the collector receiving the flows (grpc listen scheme)")
+	flag.BoolVar(&d.tls, "transport.grpc.tls", false, "Use TLS with the system CA certificates")
+	flag.StringVar(&d.tlsCA, "transport.grpc.tls.ca", "", "CA certificates file of the server (empty for the system ones)")
+	flag.StringVar(&d.tlsCert, "transport.grpc.tls.cert", "", "Client certificate file (mTLS)")
+	flag.StringVar(&d.tlsKey, "transport.grpc.tls.key", "", "Client key file (mTLS)")
+	flag.StringVar(&d.tlsServerName, "transport.grpc.tls.servername", "", "Server name verified in the certificate (empty for the host of the target)")
+	flag.BoolVar(&d.tlsInsecure, "transport.grpc.tls.insecure", false, "Skip the verification of the server certificate")
+	flag.DurationVar(&d.timeout, "transport.grpc.timeout", 10*time.Second, "Connection timeout, and delay to send the remaining flows when closing")
+	flag.IntVar(&d.batchSize, "transport.grpc.batch", 1000, "Maximum number of flows per batch")
+	flag.DurationVar(&d.flushInterval, "transport.grpc.flush", time.Second, "Maximum time before sending a partial batch")
+	flag.IntVar(&d.window, "transport.grpc.window", 16, "Maximum number of batches sent without being acknowledged")
+	flag.DurationVar(&d.retryBackoff, "transport.grpc.retry.backoff", time.Second, "Initial delay between reconnections, doubled after each attempt")
+	flag.DurationVar(&d.retryMax, "transport.grpc.retry.max", 30*time.Second, "Maximum delay between reconnections")
+	flag.IntVar(&d.queueSize, "transport.grpc.queue", 16, "Number of batches waiting to be sent before blocking")
+	return nil
+}
+
+func (d *GrpcDriver) loadTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: d.tlsInsecure,
+		ServerName:         d.tlsServerName,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if d.tlsCA != "" {
+		ca, err := os.ReadFile(d.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in %s", d.tlsCA)
+		}
+	}
+	if d.tlsCert != "" || d.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(d.tlsCert, d.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Init creates the client and starts the batching and forward routines.
+func (d *GrpcDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("grpc transport: batch size must be positive")
+	}
+	if d.window <= 0 {
+		return fmt.Errorf("grpc transport: window must be positive")
+	}
+	creds := insecure.NewCredentials()
+	if d.tls || d.tlsCA != "" || d.tlsCert != "" || d.tlsKey != "" || d.tlsInsecure {
+		config, err := d.loadTLSConfig()
+		if err != nil {
+			return fmt.Errorf("grpc transport: %w", err)
+		}
+		creds = credentials.NewTLS(config)
+	}
+	conn, err := grpc.NewClient(d.target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  d.retryBackoff,
+				Multiplier: 2,
+				Jitter:     0.2,
+				MaxDelay:   d.retryMax,
+			},
+			MinConnectTimeout: d.timeout,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("grpc transport: %w", err)
+	}
+	d.conn = conn
+	d.client = flowpb.NewForwarderClient(conn)
+	d.batch = &flowpb.FlowBatch{}
+	d.queue = make(chan *flowpb.FlowBatch, d.queueSize)
+	d.errors = make(chan error, 16)
+	d.stopCh = make(chan struct{})
+
+	d.wg.Add(1)
+	go d.forward()
+
+	if d.flushInterval > 0 {
+		d.tickWg.Add(1)
+		go func() {
+			defer d.tickWg.Done()
+			ticker := time.NewTicker(d.flushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-d.stopCh:
+					return
+				case <-ticker.C:
+					d.flush()
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// flush queues the current batch if it is not empty.
+func (d *GrpcDriver) flush() {
+	d.lock.Lock()
+	if len(d.batch.Flows) == 0 {
+		d.lock.Unlock()
+		return
+	}
+	b := d.batch
+	d.batch = &flowpb.FlowBatch{}
+	d.lock.Unlock()
+	d.queue <- b
+}
+
+func (d *GrpcDriver) reportError(err error) {
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// stream is a Forward call, its acknowledgements being read by a routine.
+type stream struct {
+	client grpc.BidiStreamingClient[flowpb.FlowBatch, flowpb.FlowAck]
+	cancel context.CancelFunc
+	acks   chan uint64
+	done   chan error
+}
+
+func (d *GrpcDriver) open() (*stream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := d.client.Forward(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := &stream{
+		client: client,
+		cancel: cancel,
+		acks:   make(chan uint64, d.window),
+		done:   make(chan error, 1),
+	}
+	go func() {
+		for {
+			ack, err := client.Recv()
+			if err != nil {
+				s.done <- err
+				return
+			}
+			select {
+			case s.acks <- ack.Sequence:
+			case <-ctx.Done():
+				s.done <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+func (d *GrpcDriver) drop(batches []*flowpb.FlowBatch, err error) {
+	var flows int
+	for _, b := range batches {
+		flows += len(b.Flows)
+	}
+	if flows == 0 {
+		return
+	}
+	metrics.TransportRequests.WithLabelValues("grpc", "failure").Add(float64(len(batches)))
+	metrics.TransportMessages.WithLabelValues("grpc", "failure").Add(float64(flows))
+	d.reportError(fmt.Errorf("%d flows dropped: %w", flows, err))
+}
+
+// forward sends the queued batches while fewer than window batches are pending,
+// and sends the pending batches again after a reconnection.
+func (d *GrpcDriver) forward() {
+	defer d.wg.Done()
+	var s *stream
+	var pending []*flowpb.FlowBatch
+	var sequence uint64
+	var retry, deadline <-chan time.Time
+	queue, stopCh := d.queue, d.stopCh
+	delay := d.retryBackoff
+	defer func() {
+		if s != nil {
+			s.cancel()
+		}
+	}()
+
+	for {
+		if s == nil && retry == nil {
+			var err error
+			if s, err = d.open(); err != nil {
+				metrics.TransportRequests.WithLabelValues("grpc", "retry").Inc()
+				d.reportError(fmt.Errorf("open stream: %w", err))
+				retry = time.After(delay)
+				delay = min(delay*2, d.retryMax)
+			} else {
+				// send errors are returned by the acknowledgement routine
+				for _, b := range pending {
+					_ = s.client.Send(b)
+				}
+			}
+		}
+
+		var next <-chan *flowpb.FlowBatch
+		var acks <-chan uint64
+		var done <-chan error
+		if s != nil {
+			acks, done = s.acks, s.done
+			if len(pending) < d.window {
+				next = queue
+			}
+		}
+		select {
+		case b, ok := <-next:
+			if !ok {
+				if len(pending) == 0 {
+					return
+				}
+				queue = nil
+				continue
+			}
+			sequence++
+			b.Sequence = sequence
+			pending = append(pending, b)
+			_ = s.client.Send(b)
+		case seq := <-acks:
+			delay = d.retryBackoff
+			for len(pending) > 0 && pending[0].Sequence <= seq {
+				metrics.TransportRequests.WithLabelValues("grpc", "success").Inc()
+				metrics.TransportMessages.WithLabelValues("grpc", "success").Add(float64(len(pending[0].Flows)))
+				pending = pending[1:]
+			}
+			if queue == nil && len(pending) == 0 {
+				return
+			}
+		case err := <-done:
+			s.cancel()
+			s = nil
+			metrics.TransportRequests.WithLabelValues("grpc", "retry").Inc()
+			d.reportError(fmt.Errorf("stream: %w", err))
+			retry = time.After(delay)
+			delay = min(delay*2, d.retryMax)
+		case <-retry:
+			retry = nil
+		case <-stopCh:
+			stopCh = nil
+			deadline = time.After(d.timeout)
+		case <-deadline:
+			d.drop(pending, fmt.Errorf("closing"))
+			if queue != nil {
+				for b := range queue {
+					d.drop([]*flowpb.FlowBatch{b}, fmt.Errorf("closing"))
+				}
+			}
+			return
+		}
+	}
+}
+
+// Send decodes a message of the bin format and adds it to the current batch.
+func (d *GrpcDriver) Send(key, data []byte) error {
+	flow := &flowpb.FlowMessage{}
+	if err := protodelim.UnmarshalFrom(bytes.NewReader(data), flow); err != nil {
+		return fmt.Errorf("grpc transport: decode message (bin format expected): %w", err)
+	}
+	d.lock.Lock()
+	d.batch.Flows = append(d.batch.Flows, flow)
+	if len(d.batch.Flows) < d.batchSize {
+		d.lock.Unlock()
+		return nil
+	}
+	b := d.batch
+	d.batch = &flowpb.FlowBatch{}
+	d.lock.Unlock()
+	d.queue <- b
+	return nil
+}
+
+// Errors returns a channel of asynchronous stream errors.
+func (d *GrpcDriver) Errors() <-chan error {
+	return d.errors
+}
+
+// Close sends the remaining flows, waiting for their acknowledgement up to the timeout, and closes the connection.
+func (d *GrpcDriver) Close() error {
+	if d.stopCh == nil {
+		return nil
+	}
+	close(d.stopCh)
+	d.tickWg.Wait()
+	d.flush()
+	close(d.queue)
+	d.wg.Wait()
+	close(d.errors)
+	d.stopCh = nil
+	return d.conn.Close()
+}
+
+func init() {
+	d := &GrpcDriver{}
+	transport.RegisterTransportDriver("grpc", d)
+}
@@ -0,0 +1,203 @@
+package grpc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	"github.com/tgragnato/goflow/utils"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// writeCert writes a certificate signed by parent (self-signed if nil) and its key as name.crt and name.key.
+func writeCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, key
+}
+
+// receiver is a grpc listener recording the sampler addresses of the flows.
+type receiver struct {
+	lock     sync.Mutex
+	samplers []string
+	received chan struct{}
+	hold     chan struct{}
+}
+
+func (r *receiver) decode(msg interface{}) error {
+	batch := msg.(*utils.ForwardedBatch)
+	if r.hold != nil {
+		r.received <- struct{}{}
+		<-r.hold
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, flow := range batch.Batch.Flows {
+		addr, _ := netip.AddrFromSlice(flow.SamplerAddress)
+		r.samplers = append(r.samplers, addr.String())
+	}
+	return nil
+}
+
+func startReceiver(t *testing.T, dir string, port int, r *receiver) *utils.GRPCReceiver {
+	recv, err := utils.NewGRPCReceiver(&utils.GRPCReceiverConfig{
+		TLSCert:     filepath.Join(dir, "server.crt"),
+		TLSKey:      filepath.Join(dir, "server.key"),
+		TLSClientCA: filepath.Join(dir, "ca.crt"),
+	})
+	if err != nil {
+		t.Fatalf("new receiver: %v", err)
+	}
+	if err := recv.Start("127.0.0.1", port, r.decode); err != nil {
+		t.Fatalf("start receiver: %v", err)
+	}
+	return recv
+}
+
+func send(t *testing.T, d *GrpcDriver, sampler string) {
+	var buf bytes.Buffer
+	protodelim.MarshalTo(&buf, &flowpb.FlowMessage{
+		Bytes:          1500,
+		SamplerAddress: netip.MustParseAddr(sampler).AsSlice(),
+	})
+	if err := d.Send(nil, buf.Bytes()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func TestGrpcTransport(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	// the first listener stops without acknowledging the batches
+	first := &receiver{received: make(chan struct{}, 2), hold: make(chan struct{})}
+	recv := startReceiver(t, dir, port, first)
+
+	d := &GrpcDriver{
+		target:       ln.Addr().String(),
+		tlsCA:        filepath.Join(dir, "ca.crt"),
+		tlsCert:      filepath.Join(dir, "client.crt"),
+		tlsKey:       filepath.Join(dir, "client.key"),
+		timeout:      5 * time.Second,
+		batchSize:    1,
+		window:       2,
+		retryBackoff: 10 * time.Millisecond,
+		retryMax:     100 * time.Millisecond,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	send(t, d, "192.0.2.1")
+	send(t, d, "192.0.2.2")
+	send(t, d, "192.0.2.3")
+	<-first.received
+	recv.Stop()
+	close(first.hold)
+
+	second := &receiver{}
+	recv = startReceiver(t, dir, port, second)
+	defer recv.Stop()
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var errs []string
+	for err := range d.Errors() {
+		errs = append(errs, err.Error())
+	}
+	for _, err := range errs {
+		if strings.Contains(err, "dropped") {
+			t.Fatalf("unexpected dropped flows: %q", errs)
+		}
+	}
+	if len(errs) == 0 {
+		t.Fatal("expected a stream error")
+	}
+	second.lock.Lock()
+	defer second.lock.Unlock()
+	if samplers := strings.Join(second.samplers, ","); samplers != "192.0.2.1,192.0.2.2,192.0.2.3" {
+		t.Fatalf("expected the 3 flows sent again in order, got %s", samplers)
+	}
+
+	// without client certificate
+	d = &GrpcDriver{
+		target:       ln.Addr().String(),
+		tlsCA:        filepath.Join(dir, "ca.crt"),
+		timeout:      200 * time.Millisecond,
+		batchSize:    1,
+		window:       2,
+		retryBackoff: 10 * time.Millisecond,
+		retryMax:     100 * time.Millisecond,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	send(t, d, "192.0.2.4")
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	errs = nil
+	for err := range d.Errors() {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 || !strings.Contains(errs[len(errs)-1], "1 flows dropped") {
+		t.Fatalf("expected the flow dropped, got %q", errs)
+	}
+	if len(second.samplers) != 3 {
+		t.Fatalf("expected no flow received without client certificate, got %d", len(second.samplers))
+	}
+}
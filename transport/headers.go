@@ -0,0 +1,24 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ParseHeaders parses a comma-separated list of key=value HTTP headers.
+func ParseHeaders(headers string) (http.Header, error) {
+	h := make(http.Header)
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		h.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return h, nil
+}
@@ -0,0 +1,19 @@
+package transport
+
+import "testing"
+
+func TestParseHeaders(t *testing.T) {
+	t.Parallel()
+	h, err := ParseHeaders(" Authorization = Bearer a=b , x-tenant=acme,")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(h) != 2 || h.Get("Authorization") != "Bearer a=b" || h.Get("X-Tenant") != "acme" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+	for _, headers := range []string{"Authorization", "=value"} {
+		if _, err := ParseHeaders(headers); err == nil {
+			t.Fatalf("expected an error for %q", headers)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package http implements a generic HTTP batch transport.
+package http
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strconv"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+)
+
+// batch holds the messages of a request.
+type batch struct {
+	buf      bytes.Buffer
+	messages int
+}
+
+func (b *batch) Len() int  { return b.messages }
+func (b *batch) Size() int { return b.buf.Len() }
+
+// HttpDriver batches messages, separated by new lines by default, and posts them to a URL
+// (eg: Vector, Loki, Splunk HEC or any service accepting NDJSON).
+type HttpDriver struct {
+	url           string
+	contentType   string
+	separator     string
+	headers       string
+	token         string
+	timeout       time.Duration
+	batchSize     int
+	batchBytes    int
+	flushInterval time.Duration
+	compression   bool
+	retries       int
+	retryBackoff  time.Duration
+	retryMax      time.Duration
+	queueSize     int
+
+	client      *nethttp.Client
+	httpHeaders nethttp.Header
+	batcher     *batcher.Batcher[*batch]
+}
+
+// Prepare registers flags for the HTTP transport configuration.
+func (d *HttpDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.http.url", "http://localhost:8080/", "URL receiving the batches")
+	flag.StringVar(&d.contentType, "transport.http.content.type", "application/x-ndjson", "Content type of the batches")
+	flag.StringVar(&d.separator, "transport.http.sep", "\n", "Separator written after each message of a batch")
+	flag.StringVar(&d.headers, "transport.http.headers", "", "Comma-separated list of key=value HTTP headers")
+	flag.StringVar(&d.token, "transport.http.token", "", "Bearer token of the requests")
+	flag.DurationVar(&d.timeout, "transport.http.timeout", 10*time.Second, "Request timeout")
+	flag.IntVar(&d.batchSize, "transport.http.batch", 1000, "Maximum number of messages per request")
+	flag.IntVar(&d.batchBytes, "transport.http.batch.bytes", 4<<20, "Maximum size of the messages of a request (0 for no limit)")
+	flag.DurationVar(&d.flushInterval, "transport.http.flush", 5*time.Second, "Maximum time before posting a partial batch")
+	flag.BoolVar(&d.compression, "transport.http.gzip", false, "Compress requests with gzip")
+	flag.IntVar(&d.retries, "transport.http.retries", 5, "Maximum number of retries of a request failing with a 429 or 5xx status or a network error")
+	flag.DurationVar(&d.retryBackoff, "transport.http.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.DurationVar(&d.retryMax, "transport.http.retry.max", 30*time.Second, "Maximum delay between retries")
+	flag.IntVar(&d.queueSize, "transport.http.queue", 16, "Number of batches waiting to be posted before blocking")
+	return nil
+}
+
+// Init starts the batching and post routines.
+func (d *HttpDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("http transport: batch size must be positive")
+	}
+	headers, err := transport.ParseHeaders(d.headers)
+	if err != nil {
+		return fmt.Errorf("http transport: %w", err)
+	}
+	d.httpHeaders = headers
+	d.client = &nethttp.Client{Timeout: d.timeout}
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "http",
+		BatchSize:     d.batchSize,
+		BatchBytes:    d.batchBytes,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+		RetryMax:      d.retryMax,
+	}, func() *batch { return &batch{} }, d.post)
+	return nil
+}
+
+// post posts a batch, retrying the failed requests.
+func (d *HttpDriver) post(b *batch) (int, error) {
+	payload := b.buf.Bytes()
+	encoding := ""
+	if d.compression {
+		var err error
+		if payload, err = batcher.Gzip(payload); err != nil {
+			return b.messages, fmt.Errorf("post batch: %w", err)
+		}
+		encoding = "gzip"
+	}
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		return d.postOnce(payload, encoding)
+	})
+	if err != nil {
+		return b.messages, fmt.Errorf("post batch: %w", err)
+	}
+	return 0, nil
+}
+
+// postOnce sends a request and reports whether a failure can be retried,
+// and after which delay if the server asked for one.
+func (d *HttpDriver) postOnce(payload []byte, encoding string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, d.url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, fmt.Errorf("create request: %w", err)
+	}
+	for key, values := range d.httpHeaders {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", d.contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	return retryAfter, resp.StatusCode == nethttp.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Send appends a message to the current batch, queuing it for posting when full.
+func (d *HttpDriver) Send(key, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return d.batcher.Add(func(b *batch) error {
+		b.buf.Write(data)
+		b.buf.WriteString(d.separator)
+		b.messages++
+		return nil
+	})
+}
+
+// Errors returns post errors.
+func (d *HttpDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close posts the remaining messages and stops the routines.
+func (d *HttpDriver) Close() error {
+	if d.batcher != nil {
+		d.batcher.Close()
+	}
+	return nil
+}
+
+func init() {
+	d := &HttpDriver{}
+	transport.RegisterTransportDriver("http", d)
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHttpTransport(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	var lines []string
+	var requests int
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Source") != "goflow" ||
+			r.Header.Get("Content-Type") != "application/x-ndjson" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		if requests == 1 { // the first request is retried
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip reader: %v", err)
+			return
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+		w.WriteHeader(nethttp.StatusOK)
+	}))
+	defer server.Close()
+
+	d := &HttpDriver{
+		url:          server.URL,
+		contentType:  "application/x-ndjson",
+		separator:    "\n",
+		headers:      "X-Source=goflow",
+		token:        "secret",
+		timeout:      time.Second,
+		batchSize:    2,
+		compression:  true,
+		retries:      1,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, line := range []string{`{"bytes":1500}`, `{"bytes":100}`, `{"bytes":40}`} {
+		if err := d.Send(nil, []byte(line)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected post error: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 3 || len(lines) != 3 || lines[2] != `{"bytes":40}` {
+		t.Fatalf("expected 3 lines in 3 requests, got %d requests: %q", requests, lines)
+	}
+}
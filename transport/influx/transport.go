@@ -0,0 +1,154 @@
+// Package influx implements an InfluxDB HTTP write transport.
+package influx
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+)
+
+// batch holds the lines of a write request.
+type batch struct {
+	buf   bytes.Buffer
+	lines int
+}
+
+func (b *batch) Len() int  { return b.lines }
+func (b *batch) Size() int { return b.buf.Len() }
+
+// InfluxDriver batches line protocol messages (see the influx format) and writes them
+// with the InfluxDB HTTP API, also supported by VictoriaMetrics.
+type InfluxDriver struct {
+	url           string
+	token         string
+	timeout       time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	compression   bool
+	retries       int
+	retryBackoff  time.Duration
+	queueSize     int
+
+	client  *http.Client
+	batcher *batcher.Batcher[*batch]
+}
+
+// Prepare registers flags for the InfluxDB transport configuration.
+func (d *InfluxDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.influx.url", "http://localhost:8086/api/v2/write?bucket=flows&precision=ns", "InfluxDB write URL (eg: /api/v2/write?org=&bucket=&precision=ns or /write?db=&precision=ns)")
+	flag.StringVar(&d.token, "transport.influx.token", "", "InfluxDB API token")
+	flag.DurationVar(&d.timeout, "transport.influx.timeout", 10*time.Second, "Write request timeout")
+	flag.IntVar(&d.batchSize, "transport.influx.batch", 5000, "Maximum number of lines per write request")
+	flag.DurationVar(&d.flushInterval, "transport.influx.flush", 5*time.Second, "Maximum time before writing a partial batch")
+	flag.BoolVar(&d.compression, "transport.influx.gzip", true, "Compress write requests with gzip")
+	flag.IntVar(&d.retries, "transport.influx.retries", 3, "Maximum number of retries of a failed write request")
+	flag.DurationVar(&d.retryBackoff, "transport.influx.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.IntVar(&d.queueSize, "transport.influx.queue", 16, "Number of batches waiting to be written before blocking")
+	return nil
+}
+
+// Init starts the batching and write routines.
+func (d *InfluxDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("influx transport: batch size must be positive")
+	}
+	d.client = &http.Client{Timeout: d.timeout}
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "influx",
+		BatchSize:     d.batchSize,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+	}, func() *batch { return &batch{} }, d.write)
+	return nil
+}
+
+// write writes a batch, retrying the failed requests.
+func (d *InfluxDriver) write(b *batch) (int, error) {
+	payload := b.buf.Bytes()
+	encoding := ""
+	if d.compression {
+		var err error
+		if payload, err = batcher.Gzip(payload); err != nil {
+			return b.lines, fmt.Errorf("write batch: %w", err)
+		}
+		encoding = "gzip"
+	}
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		retry, err := d.postOnce(payload, encoding)
+		return 0, retry, err
+	})
+	if err != nil {
+		return b.lines, fmt.Errorf("write batch: %w", err)
+	}
+	return 0, nil
+}
+
+// postOnce sends a write request and reports whether a failure can be retried.
+func (d *InfluxDriver) postOnce(payload []byte, encoding string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if d.token != "" {
+		req.Header.Set("Authorization", "Token "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Send appends a line to the current batch, queuing it for writing when full.
+func (d *InfluxDriver) Send(key, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return d.batcher.Add(func(b *batch) error {
+		b.buf.Write(data)
+		b.buf.WriteByte('\n')
+		b.lines++
+		return nil
+	})
+}
+
+// Errors returns write errors.
+func (d *InfluxDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close writes the remaining lines and stops the routines.
+func (d *InfluxDriver) Close() error {
+	if d.batcher != nil {
+		d.batcher.Close()
+	}
+	return nil
+}
+
+func init() {
+	d := &InfluxDriver{}
+	transport.RegisterTransportDriver("influx", d)
+}
@@ -0,0 +1,74 @@
+package influx
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxTransport(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	var lines []string
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip reader: %v", err)
+			return
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		lock.Lock()
+		requests++
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d := &InfluxDriver{
+		url:          server.URL,
+		token:        "secret",
+		timeout:      time.Second,
+		batchSize:    2,
+		compression:  true,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, line := range []string{
+		"flows,proto=TCP bytes=1500i 1",
+		"flows,proto=UDP bytes=100i 2",
+		"flows,proto=TCP bytes=40i 3",
+	} {
+		if err := d.Send(nil, []byte(line)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 2 || len(lines) != 3 || lines[2] != "flows,proto=TCP bytes=40i 3" {
+		t.Fatalf("expected 3 lines in 2 requests, got %d requests: %q", requests, lines)
+	}
+}
@@ -0,0 +1,414 @@
+// Package ipfix implements an IPFIX exporting transport over UDP or TCP.
+package ipfix
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+)
+
+const (
+	ipfixVersion       = 10
+	headerLength       = 16
+	setHeaderLength    = 4
+	maxMessageLength   = 0xffff
+	templateSetID      = 2
+	optionsTemplateSet = 3
+	minDataSetID       = 256
+	variableLength     = 0xffff
+	enterpriseBit      = 0x8000
+	dialTimeout        = 5 * time.Second
+)
+
+// template is a template record received in a template or options template set.
+type template struct {
+	setID   uint16
+	lengths []uint16 // field lengths
+	record  []byte
+}
+
+// IpfixDriver receives IPFIX messages (see the ipfix format) and exports their sets in
+// messages filling up to the MTU. Consecutive data sets of the same template are merged,
+// and the sequence number of each observation domain is rewritten. The templates are sent
+// again after a TCP reconnection.
+type IpfixDriver struct {
+	address       string
+	protocol      string
+	mtu           int
+	flushInterval time.Duration
+
+	lock      sync.Mutex
+	conn      net.Conn
+	domain    uint32
+	sets      []byte // sets of the pending message
+	lastSet   int    // offset of the last set, -1 if it cannot be extended
+	records   uint32 // data records in the pending message
+	sequences map[uint32]uint32
+	templates map[uint32]map[uint16]template // by domain and template ID
+
+	errors chan error
+	stopCh chan struct{}
+	tickWg sync.WaitGroup // flush routine
+}
+
+// Prepare registers flags for the IPFIX transport configuration.
+func (d *IpfixDriver) Prepare() error {
+	flag.StringVar(&d.address, "transport.ipfix.address", "127.0.0.1:4739", "IPFIX collector address")
+	flag.StringVar(&d.protocol, "transport.ipfix.protocol", "udp", "IPFIX transport protocol (udp, tcp)")
+	flag.IntVar(&d.mtu, "transport.ipfix.mtu", 1400, "Maximum size of an IPFIX message")
+	flag.DurationVar(&d.flushInterval, "transport.ipfix.flush", time.Second, "Maximum time before sending a partial message")
+	return nil
+}
+
+// Init connects to the collector and starts the flush routine.
+func (d *IpfixDriver) Init() error {
+	if d.protocol != "udp" && d.protocol != "tcp" {
+		return fmt.Errorf("ipfix transport: unsupported protocol %s", d.protocol)
+	}
+	if d.mtu < headerLength+setHeaderLength || d.mtu > maxMessageLength {
+		return fmt.Errorf("ipfix transport: invalid mtu %d", d.mtu)
+	}
+	d.lastSet = -1
+	d.sequences = make(map[uint32]uint32)
+	d.templates = make(map[uint32]map[uint16]template)
+	d.errors = make(chan error, 16)
+	d.stopCh = make(chan struct{})
+	if err := d.connect(); err != nil {
+		return fmt.Errorf("ipfix transport: %w", err)
+	}
+
+	if d.flushInterval > 0 {
+		d.tickWg.Add(1)
+		go func() {
+			defer d.tickWg.Done()
+			ticker := time.NewTicker(d.flushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-d.stopCh:
+					return
+				case <-ticker.C:
+					d.lock.Lock()
+					err := d.flush()
+					d.lock.Unlock()
+					if err != nil {
+						d.reportError(err)
+					}
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// connect opens the connection to the collector. It must be called with the lock held.
+func (d *IpfixDriver) connect() error {
+	conn, err := net.DialTimeout(d.protocol, d.address, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	d.conn = conn
+	return nil
+}
+
+func (d *IpfixDriver) reportError(err error) {
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// message returns a message of an observation domain with its current sequence number.
+func (d *IpfixDriver) message(domain uint32, sets []byte) []byte {
+	message := make([]byte, headerLength, headerLength+len(sets))
+	binary.BigEndian.PutUint16(message[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(message[2:], uint16(headerLength+len(sets)))
+	binary.BigEndian.PutUint32(message[4:], uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint32(message[8:], d.sequences[domain])
+	binary.BigEndian.PutUint32(message[12:], domain)
+	return append(message, sets...)
+}
+
+// flush sends the pending message. It must be called with the lock held.
+func (d *IpfixDriver) flush() error {
+	if len(d.sets) == 0 {
+		return nil
+	}
+	if d.conn == nil { // reconnects after a TCP failure
+		if err := d.connect(); err != nil {
+			d.reset()
+			return fmt.Errorf("send message: %w", err)
+		}
+		// the collector needs the templates before the data sets
+		if err := d.sendTemplates(); err != nil {
+			d.reset()
+			return err
+		}
+	}
+	message := d.message(d.domain, d.sets)
+	d.reset()
+	return d.write(message)
+}
+
+// reset drops the pending message after counting its records. It must be called with the lock held.
+func (d *IpfixDriver) reset() {
+	d.sequences[d.domain] += d.records
+	d.sets = d.sets[:0]
+	d.lastSet = -1
+	d.records = 0
+}
+
+// write sends a message, closing the connection after a TCP failure. It must be called with the lock held.
+func (d *IpfixDriver) write(message []byte) error {
+	if _, err := d.conn.Write(message); err != nil {
+		if d.protocol == "tcp" {
+			d.conn.Close()
+			d.conn = nil
+		}
+		return fmt.Errorf("send message: %w", err)
+	}
+	return nil
+}
+
+// sendTemplates sends the known templates of every observation domain, in messages
+// filling up to the MTU. It must be called with the lock held.
+func (d *IpfixDriver) sendTemplates() error {
+	for _, domain := range slices.Sorted(maps.Keys(d.templates)) {
+		templates := d.templates[domain]
+		var sets []byte
+		for _, setID := range []uint16{templateSetID, optionsTemplateSet} {
+			last := -1 // offset of the current set
+			for _, id := range slices.Sorted(maps.Keys(templates)) {
+				t := templates[id]
+				if t.setID != setID {
+					continue
+				}
+				size := len(t.record)
+				if last < 0 {
+					size += setHeaderLength
+				}
+				if len(sets) > 0 && headerLength+len(sets)+size > d.mtu {
+					if err := d.write(d.message(domain, sets)); err != nil {
+						return err
+					}
+					sets, last = nil, -1
+				}
+				if last < 0 {
+					last = len(sets)
+					sets = binary.BigEndian.AppendUint16(sets, setID)
+					sets = binary.BigEndian.AppendUint16(sets, setHeaderLength)
+				}
+				sets = append(sets, t.record...)
+				binary.BigEndian.PutUint16(sets[last+2:], uint16(len(sets)-last))
+			}
+		}
+		if len(sets) > 0 {
+			if err := d.write(d.message(domain, sets)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseTemplates learns the templates of a set.
+func (d *IpfixDriver) parseTemplates(domain uint32, setID uint16, payload []byte) {
+	templates := d.templates[domain]
+	if templates == nil {
+		templates = make(map[uint16]template)
+		d.templates[domain] = templates
+	}
+	for len(payload) >= 4 {
+		record := payload
+		id := binary.BigEndian.Uint16(payload)
+		count := int(binary.BigEndian.Uint16(payload[2:]))
+		payload = payload[4:]
+		if setID == optionsTemplateSet && count > 0 {
+			if len(payload) < 2 {
+				return
+			}
+			payload = payload[2:] // scope field count
+		}
+		if count == 0 { // template withdrawal
+			delete(templates, id)
+			continue
+		}
+		lengths := make([]uint16, 0, count)
+		for i := 0; i < count; i++ {
+			if len(payload) < 4 {
+				return
+			}
+			fieldType := binary.BigEndian.Uint16(payload)
+			lengths = append(lengths, binary.BigEndian.Uint16(payload[2:]))
+			payload = payload[4:]
+			if fieldType&enterpriseBit != 0 {
+				if len(payload) < 4 {
+					return
+				}
+				payload = payload[4:]
+			}
+		}
+		templates[id] = template{
+			setID:   setID,
+			lengths: lengths,
+			record:  append([]byte(nil), record[:len(record)-len(payload)]...),
+		}
+	}
+}
+
+// countRecords returns the number of records of a data set and their length without padding.
+func countRecords(lengths []uint16, payload []byte) (int, int) {
+	minLength := 0
+	for _, length := range lengths {
+		if length == variableLength {
+			minLength++
+		} else {
+			minLength += int(length)
+		}
+	}
+	if minLength == 0 {
+		return 0, len(payload)
+	}
+	records, used := 0, 0
+	for offset := 0; len(payload)-offset >= minLength; {
+		for _, length := range lengths {
+			size := int(length)
+			if length == variableLength {
+				if offset >= len(payload) {
+					return records, used
+				}
+				size = int(payload[offset])
+				offset++
+				if size == 255 {
+					if offset+2 > len(payload) {
+						return records, used
+					}
+					size = int(binary.BigEndian.Uint16(payload[offset:]))
+					offset += 2
+				}
+			}
+			offset += size
+			if offset > len(payload) {
+				return records, used
+			}
+		}
+		records++
+		used = offset
+	}
+	return records, used
+}
+
+// add appends a set to the pending message, merging data sets of the same template.
+// It must be called with the lock held.
+func (d *IpfixDriver) add(setID uint16, payload []byte, records int, mergeable bool) error {
+	if mergeable && d.lastSet >= 0 && binary.BigEndian.Uint16(d.sets[d.lastSet:]) == setID &&
+		headerLength+len(d.sets)+len(payload) <= d.mtu {
+		d.sets = append(d.sets, payload...)
+		binary.BigEndian.PutUint16(d.sets[d.lastSet+2:], uint16(len(d.sets)-d.lastSet))
+		d.records += uint32(records)
+		return nil
+	}
+	if len(d.sets) > 0 && headerLength+len(d.sets)+setHeaderLength+len(payload) > d.mtu {
+		if err := d.flush(); err != nil {
+			return err
+		}
+	}
+	d.lastSet = -1
+	if mergeable {
+		d.lastSet = len(d.sets)
+	}
+	d.sets = binary.BigEndian.AppendUint16(d.sets, setID)
+	d.sets = binary.BigEndian.AppendUint16(d.sets, uint16(setHeaderLength+len(payload)))
+	d.sets = append(d.sets, payload...)
+	d.records += uint32(records)
+	if headerLength+len(d.sets) >= d.mtu { // sets larger than the MTU are sent alone
+		return d.flush()
+	}
+	return nil
+}
+
+// Send queues the sets of an IPFIX message.
+func (d *IpfixDriver) Send(key, data []byte) error {
+	if len(data) < headerLength || binary.BigEndian.Uint16(data) != ipfixVersion {
+		return fmt.Errorf("not an IPFIX message")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:]))
+	if length < headerLength || length > len(data) {
+		return fmt.Errorf("invalid IPFIX message length %d", length)
+	}
+	domain := binary.BigEndian.Uint32(data[12:])
+	data = data[headerLength:length]
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if domain != d.domain {
+		if err := d.flush(); err != nil {
+			return err
+		}
+		d.domain = domain
+	}
+	for len(data) > 0 {
+		if len(data) < setHeaderLength {
+			return fmt.Errorf("truncated IPFIX set")
+		}
+		setID := binary.BigEndian.Uint16(data)
+		setLength := int(binary.BigEndian.Uint16(data[2:]))
+		if setLength < setHeaderLength || setLength > len(data) {
+			return fmt.Errorf("invalid IPFIX set length %d", setLength)
+		}
+		payload := data[setHeaderLength:setLength]
+		data = data[setLength:]
+
+		records, mergeable := 0, false
+		switch {
+		case setID == templateSetID || setID == optionsTemplateSet:
+			d.parseTemplates(domain, setID, payload)
+		case setID >= minDataSetID:
+			// records of unknown templates are forwarded but not counted
+			if t, ok := d.templates[domain][setID]; ok {
+				var used int
+				records, used = countRecords(t.lengths, payload)
+				payload, mergeable = payload[:used], true
+			}
+		}
+		if err := d.add(setID, payload, records, mergeable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Errors returns errors of the periodic flushes.
+func (d *IpfixDriver) Errors() <-chan error {
+	return d.errors
+}
+
+// Close sends the pending message and closes the connection.
+func (d *IpfixDriver) Close() error {
+	if d.stopCh == nil {
+		return nil
+	}
+	close(d.stopCh)
+	d.tickWg.Wait()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err := d.flush()
+	if d.conn != nil {
+		d.conn.Close()
+	}
+	close(d.errors)
+	d.stopCh = nil
+	return err
+}
+
+func init() {
+	d := &IpfixDriver{}
+	transport.RegisterTransportDriver("ipfix", d)
+}
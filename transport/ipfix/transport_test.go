@@ -0,0 +1,175 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// message builds an IPFIX message from sets.
+func message(domain uint32, sets ...[]byte) []byte {
+	b := make([]byte, headerLength)
+	binary.BigEndian.PutUint16(b, ipfixVersion)
+	binary.BigEndian.PutUint32(b[12:], domain)
+	for _, set := range sets {
+		b = append(b, set...)
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	return b
+}
+
+func set(id uint16, payload ...byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = binary.BigEndian.AppendUint16(b, uint16(setHeaderLength+len(payload)))
+	return append(b, payload...)
+}
+
+func TestIpfixTransport(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	d := &IpfixDriver{
+		address:  conn.LocalAddr().String(),
+		protocol: "udp",
+		mtu:      headerLength + 16 + 4 + 4 + 3,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	// template 256 with a 2 bytes and a variable length field
+	template := set(templateSetID, 1, 0, 0, 2, 0, 1, 0, 2, 0, 2, 0xff, 0xff)
+	for _, m := range [][]byte{
+		message(7, template, set(256, 0, 1, 1, 'a', 0)), // padded
+		message(7, set(256, 0, 2, 0)),
+		message(7, set(256, 0, 3, 2, 'b', 'c')),
+		message(8, set(256, 0, 4, 0)), // template unknown in this domain
+	} {
+		if err := d.Send(nil, m); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	expected := []struct {
+		domain   uint32
+		sequence uint32
+		sets     []byte
+	}{
+		{7, 0, append(template, set(256, 0, 1, 1, 'a', 0, 2, 0)...)},
+		{7, 2, set(256, 0, 3, 2, 'b', 'c')},
+		{8, 0, set(256, 0, 4, 0)},
+	}
+	buf := make([]byte, 1500)
+	for _, e := range expected {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		b := buf[:n]
+		if int(binary.BigEndian.Uint16(b[2:])) != n || binary.BigEndian.Uint32(b[8:]) != e.sequence || binary.BigEndian.Uint32(b[12:]) != e.domain {
+			t.Fatalf("unexpected header %x", b[:headerLength])
+		}
+		if string(b[headerLength:]) != string(e.sets) {
+			t.Fatalf("expected sets %x, got %x", e.sets, b[headerLength:])
+		}
+	}
+}
+
+// readMessage reads a message of a TCP stream and returns its domain, sequence number and sets.
+func readMessage(t *testing.T, conn net.Conn) (uint32, uint32, []byte) {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	sets := make([]byte, int(binary.BigEndian.Uint16(header[2:]))-headerLength)
+	if _, err := io.ReadFull(conn, sets); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return binary.BigEndian.Uint32(header[12:]), binary.BigEndian.Uint32(header[8:]), sets
+}
+
+func TestIpfixTransportReconnect(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	d := &IpfixDriver{
+		address:  ln.Addr().String(),
+		protocol: "tcp",
+		mtu:      1400,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	send := func(m []byte) error {
+		if err := d.Send(nil, m); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return d.flush()
+	}
+	template := set(templateSetID, 1, 0, 0, 1, 0, 1, 0, 2)
+	options := set(optionsTemplateSet, 1, 1, 0, 1, 0, 1, 0, 10, 0, 4)
+	if err := send(message(7, template, options, set(256, 0, 1))); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	conn := <-conns
+	defer conn.Close()
+	if _, _, sets := readMessage(t, conn); string(sets) != string(append(append(template, options...), set(256, 0, 1)...)) {
+		t.Fatalf("unexpected sets %x", sets)
+	}
+
+	// the connection breaks: the message is lost, the next one is preceded by the templates
+	d.lock.Lock()
+	d.conn.Close()
+	d.lock.Unlock()
+	if err := send(message(7, set(256, 0, 2))); err == nil {
+		t.Fatal("expected a send error")
+	}
+	if err := send(message(7, set(256, 0, 3))); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	conn = <-conns
+	defer conn.Close()
+	if domain, sequence, sets := readMessage(t, conn); domain != 7 || sequence != 2 || string(sets) != string(append(template, options...)) {
+		t.Fatalf("expected the templates of domain 7 at sequence 2, got %d %d %x", domain, sequence, sets)
+	}
+	if _, sequence, sets := readMessage(t, conn); sequence != 2 || string(sets) != string(set(256, 0, 3)) {
+		t.Fatalf("expected the data set at sequence 2, got %d %x", sequence, sets)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestCountRecords(t *testing.T) {
+	t.Parallel()
+	records, used := countRecords([]uint16{4, variableLength}, []byte{0, 0, 0, 1, 255, 0, 2, 'a', 'b', 0, 0, 0, 2, 0, 0, 0})
+	if records != 2 || used != 14 {
+		t.Fatalf("expected 2 records in 14 bytes, got %d in %d", records, used)
+	}
+}
@@ -0,0 +1,208 @@
+// Package mqtt implements an MQTT transport.
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tgragnato/goflow/transport"
+)
+
+// topicReplacer prevents values from adding levels or wildcards to a topic.
+var topicReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_", "\x00", "_")
+
+// MqttDriver publishes messages on an MQTT topic rendered from the key and the fields of the messages.
+// The client reconnects after failures: messages published with QoS 1 or 2 meanwhile are sent
+// once reconnected, QoS 0 messages are dropped.
+type MqttDriver struct {
+	broker               string
+	topic                string
+	clientID             string
+	username             string
+	password             string
+	qos                  int
+	retain               bool
+	timeout              time.Duration
+	keepAlive            time.Duration
+	maxReconnectInterval time.Duration
+	queueSize            int
+	tlsCA                string
+	tlsCert              string
+	tlsKey               string
+	tlsInsecure          bool
+
+	template *transport.Template
+	client   mqtt.Client
+
+	tokens chan mqtt.Token
+	wg     sync.WaitGroup // token routine
+
+	errorsLock sync.Mutex
+	errors     chan error
+	closed     bool
+}
+
+// Prepare registers flags for the MQTT transport configuration.
+func (d *MqttDriver) Prepare() error {
+	flag.StringVar(&d.broker, "transport.mqtt.broker", "tcp://localhost:1883", "Broker URL (tcp, ssl, ws or wss scheme)")
+	flag.StringVar(&d.topic, "transport.mqtt.topic", "goflow/flows", "Topic of the messages, {key} and {field} placeholders are replaced by the key and the field values")
+	flag.StringVar(&d.clientID, "transport.mqtt.clientid", "", "Client identifier (empty for goflow-<pid>)")
+	flag.StringVar(&d.username, "transport.mqtt.username", "", "Username")
+	flag.StringVar(&d.password, "transport.mqtt.password", "", "Password")
+	flag.IntVar(&d.qos, "transport.mqtt.qos", 0, "Quality of service of the messages (0, 1, 2)")
+	flag.BoolVar(&d.retain, "transport.mqtt.retain", false, "Publish retained messages")
+	flag.DurationVar(&d.timeout, "transport.mqtt.timeout", 10*time.Second, "Connection and publication timeout")
+	flag.DurationVar(&d.keepAlive, "transport.mqtt.keepalive", 30*time.Second, "Keep alive interval")
+	flag.DurationVar(&d.maxReconnectInterval, "transport.mqtt.reconnect.max", time.Minute, "Maximum delay between reconnection attempts")
+	flag.IntVar(&d.queueSize, "transport.mqtt.queue", 1024, "Number of publications waiting for an acknowledgement before blocking")
+	flag.StringVar(&d.tlsCA, "transport.mqtt.tls.ca", "", "CA certificates file of the broker (empty for the system ones)")
+	flag.StringVar(&d.tlsCert, "transport.mqtt.tls.cert", "", "Client certificate file")
+	flag.StringVar(&d.tlsKey, "transport.mqtt.tls.key", "", "Client key file")
+	flag.BoolVar(&d.tlsInsecure, "transport.mqtt.tls.insecure", false, "Skip the verification of the broker certificate")
+	return nil
+}
+
+func (d *MqttDriver) loadTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: d.tlsInsecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if d.tlsCA != "" {
+		ca, err := os.ReadFile(d.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in %s", d.tlsCA)
+		}
+	}
+	if d.tlsCert != "" || d.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(d.tlsCert, d.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (d *MqttDriver) reportError(err error) {
+	d.errorsLock.Lock()
+	defer d.errorsLock.Unlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// Init connects to the broker and starts the routine checking the publications.
+func (d *MqttDriver) Init() error {
+	if d.topic == "" {
+		return fmt.Errorf("mqtt transport: empty topic")
+	}
+	if d.qos < 0 || d.qos > 2 {
+		return fmt.Errorf("mqtt transport: invalid QoS %d", d.qos)
+	}
+	if d.clientID == "" {
+		d.clientID = fmt.Sprintf("goflow-%d", os.Getpid())
+	}
+	d.template = transport.NewTemplate(d.topic, topicReplacer)
+	d.errors = make(chan error, 16)
+	d.closed = false
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(d.broker).
+		SetClientID(d.clientID).
+		SetUsername(d.username).
+		SetPassword(d.password).
+		SetCleanSession(true).
+		SetOrderMatters(false).
+		SetKeepAlive(d.keepAlive).
+		SetConnectTimeout(d.timeout).
+		SetWriteTimeout(d.timeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(d.maxReconnectInterval).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			d.reportError(fmt.Errorf("mqtt transport: connection lost: %w", err))
+		})
+	if d.tlsCA != "" || d.tlsCert != "" || d.tlsKey != "" || d.tlsInsecure {
+		config, err := d.loadTLSConfig()
+		if err != nil {
+			return fmt.Errorf("mqtt transport: %w", err)
+		}
+		opts.SetTLSConfig(config)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(d.timeout) {
+		return fmt.Errorf("mqtt transport: connect: timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt transport: connect: %w", err)
+	}
+	d.client = client
+
+	d.tokens = make(chan mqtt.Token, d.queueSize)
+	d.wg.Add(1)
+	go d.wait()
+	return nil
+}
+
+// wait reports the publications which failed or were not acknowledged in time.
+func (d *MqttDriver) wait() {
+	defer d.wg.Done()
+	for token := range d.tokens {
+		if !token.WaitTimeout(d.timeout) {
+			d.reportError(fmt.Errorf("mqtt transport: publish: timeout"))
+			continue
+		}
+		if err := token.Error(); err != nil {
+			d.reportError(fmt.Errorf("mqtt transport: publish: %w", err))
+		}
+	}
+}
+
+// Send publishes a message, blocking when too many publications are waiting for an acknowledgement.
+func (d *MqttDriver) Send(key, data []byte) error {
+	d.tokens <- d.client.Publish(d.template.Render(key, data), byte(d.qos), d.retain, data)
+	return nil
+}
+
+// Errors returns connection and publication errors.
+func (d *MqttDriver) Errors() <-chan error {
+	return d.errors
+}
+
+// Close waits for the pending publications and disconnects from the broker.
+func (d *MqttDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	close(d.tokens)
+	d.wg.Wait()
+	d.client.Disconnect(uint(d.timeout.Milliseconds()))
+	d.client = nil
+
+	d.errorsLock.Lock()
+	d.closed = true
+	close(d.errors)
+	d.errorsLock.Unlock()
+	return nil
+}
+
+func init() {
+	d := &MqttDriver{}
+	transport.RegisterTransportDriver("mqtt", d)
+}
@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type message struct {
+	topic string
+	data  string
+}
+
+// readPacket reads an MQTT control packet and returns its first byte and its body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// serve answers an MQTT client connection and forwards the published messages,
+// closing the connection after a message if close is true.
+func serve(conn net.Conn, messages chan<- message, close bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			if close {
+				return
+			}
+			size := int(binary.BigEndian.Uint16(body))
+			topic, payload := string(body[2:2+size]), body[2+size:]
+			if qos := (header >> 1) & 3; qos > 0 {
+				conn.Write([]byte{0x40, 2, payload[0], payload[1]})
+				payload = payload[2:]
+			}
+			messages <- message{topic, string(payload)}
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func TestMqttTransport(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	messages := make(chan message, 4)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// the first connection is closed when receiving a message
+			go serve(conn, messages, i == 0)
+		}
+	}()
+
+	d := &MqttDriver{
+		broker:               "tcp://" + ln.Addr().String(),
+		topic:                "goflow/{proto}/{key}",
+		clientID:             "test",
+		qos:                  1,
+		timeout:              5 * time.Second,
+		keepAlive:            time.Minute,
+		maxReconnectInterval: 100 * time.Millisecond,
+		queueSize:            4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	data := `{"proto":"TCP/IP","bytes":1500}`
+	if err := d.Send([]byte{0xca, 0xfe}, []byte(data)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case err := <-d.Errors():
+		if !strings.Contains(err.Error(), "connection lost") {
+			t.Fatalf("expected a connection error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a connection error")
+	}
+	// the message is sent again once reconnected
+	select {
+	case m := <-messages:
+		if m.topic != "goflow/TCP_IP/cafe" || m.data != data {
+			t.Fatalf("expected %s on goflow/TCP_IP/cafe, got %s on %s", data, m.data, m.topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a message after reconnecting")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
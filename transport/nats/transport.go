@@ -0,0 +1,151 @@
+// Package nats implements a NATS transport.
+package nats
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tgragnato/goflow/transport"
+)
+
+// subjectReplacer prevents values from adding tokens or wildcards to a subject.
+var subjectReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// NatsDriver publishes messages on a NATS subject rendered from the key and the fields of the messages.
+// The client reconnects after failures, buffering the messages published meanwhile.
+type NatsDriver struct {
+	url            string
+	subject        string
+	name           string
+	credentials    string
+	token          string
+	tlsCA          string
+	tlsCert        string
+	tlsKey         string
+	timeout        time.Duration
+	reconnectWait  time.Duration
+	reconnectMax   int
+	reconnectBytes int
+
+	template *transport.Template
+	conn     *nats.Conn
+
+	errorsLock sync.Mutex
+	errors     chan error
+	closed     bool
+}
+
+// Prepare registers flags for the NATS transport configuration.
+func (d *NatsDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.nats.url", nats.DefaultURL, "Comma-separated list of NATS server URLs")
+	flag.StringVar(&d.subject, "transport.nats.subject", "goflow.flows", "Subject of the messages, {key} and {field} placeholders are replaced by the key and the field values")
+	flag.StringVar(&d.name, "transport.nats.name", "goflow", "Client connection name")
+	flag.StringVar(&d.credentials, "transport.nats.creds", "", "User credentials file")
+	flag.StringVar(&d.token, "transport.nats.token", "", "Authentication token")
+	flag.StringVar(&d.tlsCA, "transport.nats.tls.ca", "", "CA certificates file of the servers")
+	flag.StringVar(&d.tlsCert, "transport.nats.tls.cert", "", "Client certificate file")
+	flag.StringVar(&d.tlsKey, "transport.nats.tls.key", "", "Client key file")
+	flag.DurationVar(&d.timeout, "transport.nats.timeout", 5*time.Second, "Connection and flush timeout")
+	flag.DurationVar(&d.reconnectWait, "transport.nats.reconnect.wait", 2*time.Second, "Delay between reconnection attempts to a server")
+	flag.IntVar(&d.reconnectMax, "transport.nats.reconnect.max", -1, "Maximum number of reconnection attempts (-1 for no limit)")
+	flag.IntVar(&d.reconnectBytes, "transport.nats.reconnect.buffer", 8<<20, "Size of the messages buffered while reconnecting")
+	return nil
+}
+
+func (d *NatsDriver) reportError(err error) {
+	d.errorsLock.Lock()
+	defer d.errorsLock.Unlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// Init connects to the servers.
+func (d *NatsDriver) Init() error {
+	if d.subject == "" {
+		return fmt.Errorf("nats transport: empty subject")
+	}
+	d.template = transport.NewTemplate(d.subject, subjectReplacer)
+	d.errors = make(chan error, 16)
+	d.closed = false
+
+	opts := []nats.Option{
+		nats.Name(d.name),
+		nats.Timeout(d.timeout),
+		nats.ReconnectWait(d.reconnectWait),
+		nats.MaxReconnects(d.reconnectMax),
+		nats.ReconnectBufSize(d.reconnectBytes),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				d.reportError(fmt.Errorf("nats transport: disconnected: %w", err))
+			}
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			d.reportError(fmt.Errorf("nats transport: %w", err))
+		}),
+	}
+	if d.credentials != "" {
+		opts = append(opts, nats.UserCredentials(d.credentials))
+	}
+	if d.token != "" {
+		opts = append(opts, nats.Token(d.token))
+	}
+	if d.tlsCA != "" {
+		opts = append(opts, nats.RootCAs(d.tlsCA))
+	}
+	if d.tlsCert != "" || d.tlsKey != "" {
+		opts = append(opts, nats.ClientCert(d.tlsCert, d.tlsKey))
+	}
+
+	conn, err := nats.Connect(d.url, opts...)
+	if err != nil {
+		return fmt.Errorf("nats transport: connect: %w", err)
+	}
+	d.conn = conn
+	return nil
+}
+
+// Send publishes a message, it is buffered if the client is reconnecting.
+func (d *NatsDriver) Send(key, data []byte) error {
+	if err := d.conn.Publish(d.template.Render(key, data), data); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	return nil
+}
+
+// Errors returns connection errors.
+func (d *NatsDriver) Errors() <-chan error {
+	return d.errors
+}
+
+// Close flushes the published messages and closes the connection.
+func (d *NatsDriver) Close() error {
+	if d.conn == nil {
+		return nil
+	}
+	err := d.conn.FlushTimeout(d.timeout)
+	d.conn.Close()
+	d.conn = nil
+
+	d.errorsLock.Lock()
+	d.closed = true
+	close(d.errors)
+	d.errorsLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	d := &NatsDriver{}
+	transport.RegisterTransportDriver("nats", d)
+}
@@ -0,0 +1,107 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type message struct {
+	subject string
+	data    string
+}
+
+// serve answers a NATS client connection and forwards the published messages,
+// closing the connection after a message if close is true.
+func serve(conn net.Conn, messages chan<- message, close bool) {
+	defer conn.Close()
+	io.WriteString(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			messages <- message{args[1], string(data[:size])}
+			if close {
+				return
+			}
+		}
+	}
+}
+
+func TestNatsTransport(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	messages := make(chan message, 4)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// the first connection is closed after a message
+			go serve(conn, messages, i == 0)
+		}
+	}()
+
+	d := &NatsDriver{
+		url:            fmt.Sprintf("nats://%s", ln.Addr()),
+		subject:        "goflow.{sampler_address}.{key}",
+		timeout:        time.Second,
+		reconnectWait:  10 * time.Millisecond,
+		reconnectMax:   -1,
+		reconnectBytes: 1 << 20,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	first := `{"sampler_address":"192.0.2.1","bytes":1500}`
+	if err := d.Send([]byte{0xca, 0xfe}, []byte(first)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if m := <-messages; m.subject != "goflow.192_0_2_1.cafe" || m.data != first {
+		t.Fatalf("expected %s on goflow.192_0_2_1.cafe, got %s on %s", first, m.data, m.subject)
+	}
+	select {
+	case err := <-d.Errors():
+		if !strings.Contains(err.Error(), "disconnected") {
+			t.Fatalf("expected a disconnection error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a disconnection error")
+	}
+
+	second := `{"bytes":100}`
+	if err := d.Send(nil, []byte(second)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if m := <-messages; m.subject != "goflow.none.none" || m.data != second {
+		t.Fatalf("expected %s on goflow.none.none after reconnecting, got %s on %s", second, m.data, m.subject)
+	}
+}
@@ -0,0 +1,165 @@
+// Package otlp implements an OTLP/HTTP logs transport.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+	otlpproto "github.com/tgragnato/goflow/utils/otlp"
+)
+
+// OtlpDriver batches OTLP ResourceLogs messages (see the otlp format) and
+// exports them to an OTLP/HTTP collector using protobuf encoding.
+type OtlpDriver struct {
+	endpoint      string
+	headers       string
+	timeout       time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	compression   bool
+	retries       int
+	retryBackoff  time.Duration
+	queueSize     int
+
+	client      *http.Client
+	httpHeaders http.Header
+	batcher     *batcher.Batcher[*otlpproto.Batch]
+}
+
+// Prepare registers flags for the OTLP transport configuration.
+func (d *OtlpDriver) Prepare() error {
+	flag.StringVar(&d.endpoint, "transport.otlp.endpoint", "http://localhost:4318/v1/logs", "OTLP/HTTP logs endpoint")
+	flag.StringVar(&d.headers, "transport.otlp.headers", "", "Comma-separated list of key=value HTTP headers (eg: authentication)")
+	flag.DurationVar(&d.timeout, "transport.otlp.timeout", 10*time.Second, "Export request timeout")
+	flag.IntVar(&d.batchSize, "transport.otlp.batch", 1000, "Maximum number of log records per export request")
+	flag.DurationVar(&d.flushInterval, "transport.otlp.flush", 5*time.Second, "Maximum time before exporting a partial batch")
+	flag.BoolVar(&d.compression, "transport.otlp.gzip", true, "Compress export requests with gzip")
+	flag.IntVar(&d.retries, "transport.otlp.retries", 5, "Maximum number of retries of a failed export request")
+	flag.DurationVar(&d.retryBackoff, "transport.otlp.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.IntVar(&d.queueSize, "transport.otlp.queue", 16, "Number of batches waiting to be exported before blocking")
+	return nil
+}
+
+// Init starts the batching and export routines.
+func (d *OtlpDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("otlp transport: batch size must be positive")
+	}
+	headers, err := transport.ParseHeaders(d.headers)
+	if err != nil {
+		return fmt.Errorf("otlp transport: %w", err)
+	}
+	d.httpHeaders = headers
+	d.client = &http.Client{Timeout: d.timeout}
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "otlp",
+		BatchSize:     d.batchSize,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+	}, otlpproto.NewBatch, d.export)
+	return nil
+}
+
+// export exports a batch, retrying the failed requests.
+func (d *OtlpDriver) export(batch *otlpproto.Batch) (int, error) {
+	payload := batch.Marshal()
+	encoding := ""
+	if d.compression {
+		var err error
+		if payload, err = batcher.Gzip(payload); err != nil {
+			return batch.Len(), fmt.Errorf("export %d log records: %w", batch.Len(), err)
+		}
+		encoding = "gzip"
+	}
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		return d.postOnce(payload, encoding)
+	})
+	if err != nil {
+		return batch.Len(), fmt.Errorf("export %d log records: %w", batch.Len(), err)
+	}
+	return 0, nil
+}
+
+// retryable reports whether an export can be retried following the OTLP/HTTP specification.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// postOnce sends an export request and reports whether a failure can be retried,
+// and after which delay if the server asked for one.
+func (d *OtlpDriver) postOnce(payload []byte, encoding string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, fmt.Errorf("create request: %w", err)
+	}
+	for key, values := range d.httpHeaders {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	if !retryable(resp.StatusCode) {
+		return 0, false, err
+	}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true, err
+	}
+	return 0, true, err
+}
+
+// Send adds a ResourceLogs message to the current batch, queuing it for export when full.
+func (d *OtlpDriver) Send(key, data []byte) error {
+	return d.batcher.Add(func(batch *otlpproto.Batch) error {
+		if err := batch.Add(data); err != nil {
+			return fmt.Errorf("otlp transport: %w", err)
+		}
+		return nil
+	})
+}
+
+// Errors returns export errors.
+func (d *OtlpDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close exports the remaining records and stops the routines.
+func (d *OtlpDriver) Close() error {
+	if d.batcher != nil {
+		d.batcher.Close()
+	}
+	return nil
+}
+
+func init() {
+	d := &OtlpDriver{}
+	transport.RegisterTransportDriver("otlp", d)
+}
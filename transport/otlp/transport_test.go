@@ -0,0 +1,151 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	otlpproto "github.com/tgragnato/goflow/utils/otlp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// countRecords returns the number of LogRecords in an export request.
+func countRecords(t *testing.T, b []byte) int {
+	t.Helper()
+	var records int
+	var walk func(b []byte, depth int)
+	walk = func(b []byte, depth int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 || typ != protowire.BytesType {
+				t.Fatalf("unexpected field in request")
+			}
+			b = b[n:]
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("truncated request")
+			}
+			b = b[n:]
+			switch {
+			case depth == 0 && num == 1: // ResourceLogs
+				walk(value, 1)
+			case depth == 1 && num == 2: // ScopeLogs
+				walk(value, 2)
+			case depth == 2 && num == 2: // LogRecord
+				records++
+			}
+		}
+	}
+	walk(b, 0)
+	return records
+}
+
+func newDriver(endpoint string) *OtlpDriver {
+	return &OtlpDriver{
+		endpoint:     endpoint,
+		timeout:      time.Second,
+		batchSize:    2,
+		compression:  true,
+		retries:      3,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+	}
+}
+
+func newResourceLogs() []byte {
+	resource := otlpproto.MarshalResource([]otlpproto.KeyValue{{Key: "flow.exporter.address", Value: "192.0.2.1"}})
+	record := otlpproto.MarshalLogRecord(&otlpproto.LogRecord{
+		TimeUnixNano: 1,
+		Attributes:   []otlpproto.KeyValue{{Key: "bytes", Value: uint64(1500)}},
+	})
+	return otlpproto.MarshalResourceLogs(resource, otlpproto.Scope{Name: "test"}, record)
+}
+
+func TestOtlpTransport(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	var received int
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first export is rejected to exercise retries
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip reader: %v", err)
+			return
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		lock.Lock()
+		received += countRecords(t, body)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	d := newDriver(server.URL)
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := d.Send(nil, newResourceLogs()); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range d.Errors() {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if received != 5 {
+		t.Fatalf("expected 5 records, got %d", received)
+	}
+	if attempts.Load() != 4 {
+		t.Fatalf("expected 4 requests (3 batches and a retry), got %d", attempts.Load())
+	}
+}
+
+func TestOtlpTransportPermanentError(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	d := newDriver(server.URL)
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := d.Send(nil, newResourceLogs()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var errs int
+	for range d.Errors() {
+		errs++
+	}
+	if errs != 1 || attempts.Load() != 1 {
+		t.Fatalf("expected a single attempt and error, got %d attempts and %d errors", attempts.Load(), errs)
+	}
+}
@@ -0,0 +1,211 @@
+// Package redis implements a Redis Streams transport.
+package redis
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tgragnato/goflow/transport"
+	"github.com/tgragnato/goflow/transport/batcher"
+)
+
+// entry is a message added to a stream.
+type entry struct {
+	stream string
+	data   []byte
+}
+
+// batch holds the entries of a pipeline.
+type batch struct {
+	entries []entry
+	bytes   int
+}
+
+func (b *batch) Len() int  { return len(b.entries) }
+func (b *batch) Size() int { return b.bytes }
+
+// RedisDriver batches messages and adds them to a stream, rendered from the key and the fields
+// of the messages, with pipelined XADD commands trimming the stream to a maximum length.
+// Commands failing with a network error are retried, the client reconnecting as needed.
+type RedisDriver struct {
+	url           string
+	password      string
+	stream        string
+	field         string
+	maxLen        int64
+	maxLenExact   bool
+	timeout       time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	queueSize     int
+
+	template *transport.Template
+	client   *redis.Client
+	batcher  *batcher.Batcher[*batch]
+}
+
+// Prepare registers flags for the Redis transport configuration.
+func (d *RedisDriver) Prepare() error {
+	flag.StringVar(&d.url, "transport.redis.url", "redis://localhost:6379/0", "Redis URL (redis or rediss scheme, with the user, password and database)")
+	flag.StringVar(&d.password, "transport.redis.password", "", "Redis password, overriding the one of the URL")
+	flag.StringVar(&d.stream, "transport.redis.stream", "goflow:flows", "Stream of the messages, {key} and {field} placeholders are replaced by the key and the field values")
+	flag.StringVar(&d.field, "transport.redis.field", "flow", "Field of the stream entries holding the messages")
+	flag.Int64Var(&d.maxLen, "transport.redis.maxlen", 100000, "Maximum length of the streams (0 for no trimming)")
+	flag.BoolVar(&d.maxLenExact, "transport.redis.maxlen.exact", false, "Trim the streams to exactly the maximum length instead of approximately")
+	flag.DurationVar(&d.timeout, "transport.redis.timeout", 5*time.Second, "Connection and command timeout")
+	flag.IntVar(&d.batchSize, "transport.redis.batch", 500, "Maximum number of messages per pipeline")
+	flag.DurationVar(&d.flushInterval, "transport.redis.flush", time.Second, "Maximum time before sending a partial batch")
+	flag.IntVar(&d.retries, "transport.redis.retries", 5, "Maximum number of retries of the commands failing with a network error")
+	flag.DurationVar(&d.retryBackoff, "transport.redis.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	flag.IntVar(&d.queueSize, "transport.redis.queue", 16, "Number of batches waiting to be sent before blocking")
+	return nil
+}
+
+// Init checks the connection and starts the batching and write routines.
+func (d *RedisDriver) Init() error {
+	if d.batchSize <= 0 {
+		return fmt.Errorf("redis transport: batch size must be positive")
+	}
+	if d.stream == "" || d.field == "" {
+		return fmt.Errorf("redis transport: empty stream or field")
+	}
+	opts, err := redis.ParseURL(d.url)
+	if err != nil {
+		return fmt.Errorf("redis transport: %w", err)
+	}
+	if d.password != "" {
+		opts.Password = d.password
+	}
+	opts.DialTimeout = d.timeout
+	opts.ReadTimeout = d.timeout
+	opts.WriteTimeout = d.timeout
+	opts.MaxRetries = -1 // retried with a backoff by the write routine
+	opts.DisableIdentity = true
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return fmt.Errorf("redis transport: ping: %w", err)
+	}
+	d.client = client
+	d.template = transport.NewTemplate(d.stream, nil)
+	d.batcher = batcher.New(batcher.Config{
+		Name:          "redis",
+		BatchSize:     d.batchSize,
+		FlushInterval: d.flushInterval,
+		QueueSize:     d.queueSize,
+		Retries:       d.retries,
+		RetryBackoff:  d.retryBackoff,
+	}, func() *batch { return &batch{} }, d.write)
+	return nil
+}
+
+// write sends a batch, retrying the commands which failed with a network error,
+// and returns the number of messages which could not be added.
+func (d *RedisDriver) write(b *batch) (int, error) {
+	entries := b.entries
+	var rejected, attempts int
+	var rejectedErr error
+	err := d.batcher.Retry(func() (time.Duration, bool, error) {
+		failed, err := d.pipeline(entries)
+		if err == nil {
+			entries = nil
+			return 0, false, nil
+		}
+		// commands rejected by the server are not retried
+		var retry []entry
+		for i, e := range entries {
+			var redisErr redis.Error
+			if failed[i] == nil {
+				continue
+			} else if errors.As(failed[i], &redisErr) {
+				rejected++
+				rejectedErr = failed[i]
+			} else {
+				retry = append(retry, e)
+			}
+		}
+		entries = retry
+		if len(retry) == 0 {
+			return 0, false, err
+		}
+		if attempts++; attempts <= d.retries {
+			d.batcher.ReportError(fmt.Errorf("redis transport: retrying %d messages: %w", len(retry), err))
+		}
+		return 0, true, err
+	})
+	if failed := rejected + len(entries); failed > 0 {
+		if len(entries) == 0 {
+			err = rejectedErr
+		}
+		return failed, fmt.Errorf("redis transport: %d messages dropped: %w", failed, err)
+	}
+	return 0, nil
+}
+
+// pipeline sends the XADD commands of a batch and returns the error of each command.
+func (d *RedisDriver) pipeline(b []entry) ([]error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	pipe := d.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(b))
+	for i, e := range b {
+		cmds[i] = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: e.stream,
+			MaxLen: d.maxLen,
+			Approx: !d.maxLenExact,
+			Values: []interface{}{d.field, e.data},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	if err == nil {
+		return nil, nil
+	}
+	failed := make([]error, len(b))
+	for i, cmd := range cmds {
+		failed[i] = cmd.Err()
+	}
+	return failed, err
+}
+
+// Send appends a message to the current batch, queuing it when full.
+func (d *RedisDriver) Send(key, data []byte) error {
+	e := entry{
+		stream: d.template.Render(key, data),
+		data:   append([]byte(nil), data...),
+	}
+	return d.batcher.Add(func(b *batch) error {
+		b.entries = append(b.entries, e)
+		b.bytes += len(e.data)
+		return nil
+	})
+}
+
+// Errors returns write errors.
+func (d *RedisDriver) Errors() <-chan error {
+	return d.batcher.Errors()
+}
+
+// Close sends the remaining messages, retrying them without delay, and closes the client.
+func (d *RedisDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	d.batcher.Close()
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+func init() {
+	d := &RedisDriver{}
+	transport.RegisterTransportDriver("redis", d)
+}
@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid array %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk string %q", line)
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestRedisTransport(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	var lock sync.Mutex
+	var commands []string
+	var dropped bool
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(args[0]) {
+					case "HELLO":
+						io.WriteString(conn, "-ERR unknown command 'HELLO'\r\n")
+					case "PING":
+						io.WriteString(conn, "+PONG\r\n")
+					case "XADD":
+						lock.Lock()
+						// the connection is dropped at the first command
+						if !dropped {
+							dropped = true
+							lock.Unlock()
+							return
+						}
+						commands = append(commands, strings.Join(args, " "))
+						lock.Unlock()
+						if args[1] == "goflow:none" {
+							io.WriteString(conn, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+						} else {
+							io.WriteString(conn, "$3\r\n1-0\r\n")
+						}
+					default:
+						io.WriteString(conn, "+OK\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	d := &RedisDriver{
+		url:          fmt.Sprintf("redis://%s/0", ln.Addr()),
+		stream:       "goflow:{sampler_address}",
+		field:        "flow",
+		maxLen:       1000,
+		timeout:      time.Second,
+		batchSize:    10,
+		retries:      2,
+		retryBackoff: time.Millisecond,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, data := range []string{
+		`{"sampler_address":"192.0.2.1","bytes":1500}`,
+		`{"sampler_address":"192.0.2.2","bytes":100}`,
+		`{"bytes":10}`,
+	} {
+		if err := d.Send(nil, []byte(data)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var errs []string
+	for err := range d.Errors() {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0], "retrying 3 messages") || !strings.Contains(errs[1], "1 messages dropped: WRONGTYPE") {
+		t.Fatalf("expected a retry and a dropped message, got %q", errs)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{
+		`xadd goflow:192.0.2.1 maxlen ~ 1000 * flow {"sampler_address":"192.0.2.1","bytes":1500}`,
+		`xadd goflow:192.0.2.2 maxlen ~ 1000 * flow {"sampler_address":"192.0.2.2","bytes":100}`,
+		`xadd goflow:none maxlen ~ 1000 * flow {"bytes":10}`,
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected %q, got %q", expected, commands)
+	}
+}
+
+func TestRedisCloseUnreachable(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	// the server answers the ping then drops the connections at each command
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil || strings.ToUpper(args[0]) == "XADD" {
+						return
+					}
+					if strings.ToUpper(args[0]) == "PING" {
+						io.WriteString(conn, "+PONG\r\n")
+					} else {
+						io.WriteString(conn, "-ERR unknown command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	d := &RedisDriver{
+		url:          fmt.Sprintf("redis://%s/0", ln.Addr()),
+		stream:       "goflow:flows",
+		field:        "flow",
+		timeout:      time.Second,
+		batchSize:    10,
+		retries:      3,
+		retryBackoff: time.Hour,
+		queueSize:    4,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := d.Send(nil, []byte(`{"bytes":1500}`)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	// the backoff does not delay the close
+	start := time.Now()
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the close not to wait for the backoff, took %s", elapsed)
+	}
+	var dropped bool
+	for err := range d.Errors() {
+		dropped = dropped || strings.Contains(err.Error(), "1 messages dropped")
+	}
+	if !dropped {
+		t.Fatal("expected the message dropped")
+	}
+	if err := d.Send(nil, []byte(`{"bytes":100}`)); err == nil {
+		t.Fatal("expected an error after close")
+	}
+}
@@ -0,0 +1,281 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tgragnato/goflow/metrics"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	signedAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// client is a minimal S3 client signing its requests with the AWS Signature Version 4.
+type client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	pathStyle bool
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	stopCh    <-chan struct{} // closed when stopping, the failed requests are then not retried
+	http      *http.Client
+}
+
+// uriEncode encodes a string as required by the canonical request, the slashes being kept if path is true.
+func uriEncode(s string, path bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && path:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery returns the query string sorted by name and value.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, false)+"="+uriEncode(value, false))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// objectURL returns the URL of an object, in the path or as a virtual host of the bucket.
+func (c *client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if c.pathStyle {
+		path += "/" + c.bucket
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	path += "/" + key
+	u.Path = path
+	u.RawPath = uriEncode(path, true)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds the authorization header of a request, signing the host, range, content type and x-amz-* headers.
+func (c *client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	day := now.Format("20060102")
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signedAlgorithm + "\n" + now.Format(amzDateFormat) + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signedAlgorithm, c.accessKey, scope, signedHeaders, signature))
+}
+
+// s3Error is the error document of a failed request.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a request, retrying network errors and 429 or 5xx statuses, and returns the response headers and body.
+// Once stopping, the retries are given up without waiting, the staging files being uploaded at the next start.
+func (c *client) do(method, key string, query url.Values, contentType string, payload []byte) (http.Header, []byte, error) {
+	hash := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(hash[:])
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		header, body, retry, err := c.doOnce(method, key, query, contentType, payload, payloadHash)
+		if err == nil {
+			metrics.TransportRequests.WithLabelValues("s3", "success").Inc()
+			return header, body, nil
+		}
+		if !retry || attempt >= c.retries || c.stopping() {
+			metrics.TransportRequests.WithLabelValues("s3", "failure").Inc()
+			return nil, nil, err
+		}
+		metrics.TransportRequests.WithLabelValues("s3", "retry").Inc()
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-c.stopCh:
+			timer.Stop()
+			metrics.TransportRequests.WithLabelValues("s3", "failure").Inc()
+			return nil, nil, err
+		}
+		backoff *= 2
+	}
+}
+
+func (c *client) stopping() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *client) doOnce(method, key string, query url.Values, contentType string, payload []byte, payloadHash string) (http.Header, []byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query).String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, payloadHash, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Header, body, false, nil
+	}
+	var s3Err s3Error
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		err = fmt.Errorf("%s %s: %s: %s", method, key, s3Err.Code, s3Err.Message)
+	} else {
+		err = fmt.Errorf("%s %s: unexpected status %s", method, key, resp.Status)
+	}
+	return nil, nil, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+func (c *client) putObject(key, contentType string, payload []byte) error {
+	_, _, err := c.do(http.MethodPut, key, nil, contentType, payload)
+	return err
+}
+
+func (c *client) createMultipartUpload(key, contentType string) (string, error) {
+	_, body, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, contentType, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("create multipart upload %s: invalid response", key)
+	}
+	return result.UploadID, nil
+}
+
+func (c *client) uploadPart(key, uploadID string, number int, payload []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	header, _, err := c.do(http.MethodPut, key, query, "", payload)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("ETag"), nil
+}
+
+// completedPart is a part of the completion request of a multipart upload.
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *client) completeMultipartUpload(key, uploadID string, etags []string) error {
+	request := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{}
+	for i, etag := range etags {
+		request.Parts = append(request.Parts, completedPart{i + 1, etag})
+	}
+	payload, err := xml.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("complete multipart upload %s: %w", key, err)
+	}
+	_, body, err := c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, "application/xml", payload)
+	if err != nil {
+		return err
+	}
+	// the completion can fail after a 200 status
+	var s3Err s3Error
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("complete multipart upload %s: %s: %s", key, s3Err.Code, s3Err.Message)
+	}
+	return nil
+}
+
+func (c *client) abortMultipartUpload(key, uploadID string) error {
+	_, _, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, "", nil)
+	return err
+}
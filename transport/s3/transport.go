@@ -0,0 +1,654 @@
+// Package s3 implements an S3-compatible object storage transport.
+package s3
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tgragnato/goflow/metrics"
+	"github.com/tgragnato/goflow/transport"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	formatNDJSON   = "ndjson"
+	formatProtobuf = "protobuf"
+
+	dataExt     = ".data"
+	manifestExt = ".json"
+
+	// samplerAddressField is the number of the sampler_address field of the protobuf messages.
+	samplerAddressField = 11
+
+	// minPartSize is the minimum size of the parts of a multipart upload, except the last one.
+	minPartSize = 5 << 20
+)
+
+// exporterReplacer prevents exporter values from changing the prefix of an object.
+var exporterReplacer = strings.NewReplacer("/", "_", "\\", "_", "..", "_")
+
+// manifest describes an object. It is kept next to the staging file while the object is written,
+// and uploaded next to the object with a .manifest.json suffix.
+type manifest struct {
+	Bucket      string     `json:"bucket"`
+	Key         string     `json:"key"`
+	Format      string     `json:"format"`
+	Compression string     `json:"compression"`
+	Exporter    string     `json:"exporter"`
+	Hour        time.Time  `json:"hour"`
+	Records     int        `json:"records"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256,omitempty"`
+	Created     time.Time  `json:"created"`
+	Completed   *time.Time `json:"completed,omitempty"`
+}
+
+// object is an object being written to a staging file.
+type object struct {
+	path      string // staging path, without extension
+	manifest  manifest
+	file      *os.File
+	writer    io.WriteCloser // compressed member being written
+	pending   int            // records written since the last commit
+	written   int64          // uncompressed size
+	lastWrite time.Time
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// S3Driver writes messages to local staging files, one per hour and exporter, and uploads
+// them as objects to an S3-compatible storage once complete. Staging files are committed
+// periodically as independent compressed members, so that they can be recovered after a crash.
+type S3Driver struct {
+	endpoint      string
+	bucket        string
+	region        string
+	prefix        string
+	accessKey     string
+	secretKey     string
+	sessionToken  string
+	pathStyle     bool
+	format        string
+	compression   string
+	exporterField string
+	staging       string
+	objectSize    int64
+	partSize      int64
+	maxOpen       int
+	flushInterval time.Duration
+	timeout       time.Duration
+	retries       int
+	retryBackoff  time.Duration
+
+	client   *client
+	hostname string
+
+	lock    sync.Mutex
+	objects map[string]*object
+	seq     int
+
+	notify chan struct{}
+	errors chan error
+	stopCh chan struct{}
+	wg     sync.WaitGroup // upload routine
+	tickWg sync.WaitGroup // commit routine
+}
+
+// Prepare registers flags for the S3 transport configuration.
+func (d *S3Driver) Prepare() error {
+	flag.StringVar(&d.endpoint, "transport.s3.endpoint", "https://s3.amazonaws.com", "S3 endpoint URL")
+	flag.StringVar(&d.bucket, "transport.s3.bucket", "", "Bucket of the objects")
+	flag.StringVar(&d.region, "transport.s3.region", "us-east-1", "Region of the bucket")
+	flag.StringVar(&d.prefix, "transport.s3.prefix", "flows/", "Prefix of the object keys")
+	flag.StringVar(&d.accessKey, "transport.s3.access.key", "", "Access key (empty for AWS_ACCESS_KEY_ID)")
+	flag.StringVar(&d.secretKey, "transport.s3.secret.key", "", "Secret key (empty for AWS_SECRET_ACCESS_KEY)")
+	flag.StringVar(&d.sessionToken, "transport.s3.session.token", "", "Session token (empty for AWS_SESSION_TOKEN)")
+	flag.BoolVar(&d.pathStyle, "transport.s3.pathstyle", true, "Use path-style requests (eg: MinIO) instead of virtual-hosted-style")
+	flag.StringVar(&d.format, "transport.s3.format", formatNDJSON, "Format of the messages (ndjson for json messages, protobuf for delimited bin messages)")
+	flag.StringVar(&d.compression, "transport.s3.compress", "gzip", "Compression of the objects (gzip, zstd or none)")
+	flag.StringVar(&d.exporterField, "transport.s3.exporter.field", "sampler_address", "Field of the json messages partitioning the objects by exporter")
+	flag.StringVar(&d.staging, "transport.s3.staging", filepath.Join(os.TempDir(), "goflow-s3"), "Directory of the staging files")
+	flag.Int64Var(&d.objectSize, "transport.s3.object.size", 256<<20, "Maximum uncompressed size of an object")
+	flag.Int64Var(&d.partSize, "transport.s3.part.size", 16<<20, "Size of the parts of multipart uploads (at least 5MiB)")
+	flag.IntVar(&d.maxOpen, "transport.s3.maxopen", 256, "Maximum number of objects written at once")
+	flag.DurationVar(&d.flushInterval, "transport.s3.flush", 10*time.Second, "Interval between commits of the staging files")
+	flag.DurationVar(&d.timeout, "transport.s3.timeout", time.Minute, "Request timeout")
+	flag.IntVar(&d.retries, "transport.s3.retries", 5, "Maximum number of retries of a request failing with a 429 or 5xx status or a network error")
+	flag.DurationVar(&d.retryBackoff, "transport.s3.retry.backoff", time.Second, "Initial delay between retries, doubled after each attempt")
+	return nil
+}
+
+func (d *S3Driver) extension() string {
+	ext := ".ndjson"
+	if d.format == formatProtobuf {
+		ext = ".pb"
+	}
+	switch d.compression {
+	case "gzip":
+		ext += ".gz"
+	case "zstd":
+		ext += ".zst"
+	}
+	return ext
+}
+
+func (d *S3Driver) contentType() string {
+	if d.format == formatProtobuf {
+		return "application/x-protobuf"
+	}
+	return "application/x-ndjson"
+}
+
+// Init checks the configuration, recovers the staging files and starts the commit and upload routines.
+func (d *S3Driver) Init() error {
+	if d.bucket == "" {
+		return fmt.Errorf("s3 transport: empty bucket")
+	}
+	if d.format != formatNDJSON && d.format != formatProtobuf {
+		return fmt.Errorf("s3 transport: unsupported format %s", d.format)
+	}
+	switch d.compression {
+	case "gzip", "zstd", "none":
+	default:
+		return fmt.Errorf("s3 transport: unsupported compression %s", d.compression)
+	}
+	if d.objectSize <= 0 {
+		return fmt.Errorf("s3 transport: object size must be positive")
+	}
+	if d.partSize < minPartSize {
+		return fmt.Errorf("s3 transport: part size must be at least %d bytes", minPartSize)
+	}
+	endpoint, err := url.Parse(d.endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("s3 transport: invalid endpoint %s", d.endpoint)
+	}
+	if d.accessKey == "" {
+		d.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if d.secretKey == "" {
+		d.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if d.sessionToken == "" {
+		d.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	d.client = &client{
+		endpoint:  endpoint,
+		bucket:    d.bucket,
+		region:    d.region,
+		accessKey: d.accessKey,
+		secretKey: d.secretKey,
+		token:     d.sessionToken,
+		pathStyle: d.pathStyle,
+		timeout:   d.timeout,
+		retries:   d.retries,
+		backoff:   d.retryBackoff,
+		http:      &http.Client{Timeout: d.timeout},
+	}
+	if d.hostname, err = os.Hostname(); err != nil || d.hostname == "" {
+		d.hostname = "goflow"
+	}
+	d.hostname = exporterReplacer.Replace(d.hostname)
+
+	if err := os.MkdirAll(d.staging, 0755); err != nil {
+		return fmt.Errorf("s3 transport: create staging directory: %w", err)
+	}
+	if err := d.recover(); err != nil {
+		return fmt.Errorf("s3 transport: %w", err)
+	}
+
+	d.objects = make(map[string]*object)
+	d.notify = make(chan struct{}, 1)
+	d.errors = make(chan error, 16)
+	d.stopCh = make(chan struct{})
+	d.client.stopCh = d.stopCh
+	d.notify <- struct{}{} // uploads the recovered files
+
+	d.wg.Add(1)
+	go d.upload()
+
+	d.tickWg.Add(1)
+	go func() {
+		defer d.tickWg.Done()
+		ticker := time.NewTicker(d.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stopCh:
+				return
+			case now := <-ticker.C:
+				d.commit(now.UTC())
+			}
+		}
+	}()
+	return nil
+}
+
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// writeManifest replaces the manifest of a staging file atomically.
+func writeManifest(path string, m manifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	tmp := path + manifestExt + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path+manifestExt); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// recover completes the staging files left by a previous run, dropping the messages
+// written after their last commit.
+func (d *S3Driver) recover() error {
+	paths, err := filepath.Glob(filepath.Join(d.staging, "*"+manifestExt))
+	if err != nil {
+		return fmt.Errorf("list staging files: %w", err)
+	}
+	for _, path := range paths {
+		path = strings.TrimSuffix(path, manifestExt)
+		m, err := readManifest(path + manifestExt)
+		if err != nil {
+			return err
+		}
+		if m.Completed != nil {
+			continue
+		}
+		if err := os.Truncate(path+dataExt, m.Size); os.IsNotExist(err) {
+			os.Remove(path + manifestExt)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("truncate %s: %w", path, err)
+		}
+		if err := d.complete(path, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// complete marks a staging file as complete, or removes it if it is empty.
+func (d *S3Driver) complete(path string, m manifest) error {
+	if m.Records == 0 {
+		os.Remove(path + dataExt)
+		return os.Remove(path + manifestExt)
+	}
+	f, err := os.Open(path + dataExt)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+	now := time.Now().UTC()
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+	m.Completed = &now
+	return writeManifest(path, m)
+}
+
+// exporter returns the address of the exporter of a message.
+func (d *S3Driver) exporter(data []byte) string {
+	var value string
+	if d.format == formatProtobuf {
+		value = protoExporter(data)
+	} else {
+		var message map[string]json.RawMessage
+		if json.Unmarshal(data, &message) == nil {
+			if raw, ok := message[d.exporterField]; ok {
+				if err := json.Unmarshal(raw, &value); err != nil {
+					value = string(raw)
+				}
+			}
+		}
+	}
+	if value = exporterReplacer.Replace(value); value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// protoExporter returns the sampler address of a delimited protobuf message.
+func protoExporter(data []byte) string {
+	size, n := protowire.ConsumeVarint(data)
+	if n < 0 || uint64(len(data)-n) < size {
+		return ""
+	}
+	data = data[n : n+int(size)]
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return ""
+		}
+		data = data[n:]
+		if num == samplerAddressField && typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return ""
+			}
+			if addr, ok := netip.AddrFromSlice(value); ok {
+				return addr.Unmap().String()
+			}
+			return ""
+		}
+		if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+			return ""
+		}
+		data = data[n:]
+	}
+	return ""
+}
+
+// openObject creates the staging file of an object. It must be called with the lock held.
+func (d *S3Driver) openObject(now, hour time.Time, exporter string) (*object, error) {
+	d.seq++
+	name := fmt.Sprintf("%s-%d-%d", d.hostname, now.UnixNano(), d.seq)
+	o := &object{
+		path: filepath.Join(d.staging, name),
+		manifest: manifest{
+			Bucket:      d.bucket,
+			Format:      d.format,
+			Compression: d.compression,
+			Exporter:    exporter,
+			Hour:        hour,
+			Created:     now,
+			Key: fmt.Sprintf("%syear=%04d/month=%02d/day=%02d/hour=%02d/exporter=%s/%s%s",
+				d.prefix, hour.Year(), hour.Month(), hour.Day(), hour.Hour(), exporter, name, d.extension()),
+		},
+	}
+	file, err := os.OpenFile(o.path+dataExt, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open staging file: %w", err)
+	}
+	o.file = file
+	if err := writeManifest(o.path, o.manifest); err != nil {
+		file.Close()
+		os.Remove(o.path + dataExt)
+		return nil, err
+	}
+	return o, nil
+}
+
+// commitObject closes the compressed member of an object and syncs its staging file and manifest.
+func (d *S3Driver) commitObject(o *object) error {
+	if o.pending == 0 {
+		return nil
+	}
+	if err := o.writer.Close(); err != nil {
+		return fmt.Errorf("commit %s: %w", o.path, err)
+	}
+	o.writer = nil
+	if err := o.file.Sync(); err != nil {
+		return fmt.Errorf("commit %s: %w", o.path, err)
+	}
+	size, err := o.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("commit %s: %w", o.path, err)
+	}
+	o.manifest.Size = size
+	o.manifest.Records += o.pending
+	o.pending = 0
+	return writeManifest(o.path, o.manifest)
+}
+
+// closeObject commits and completes an object, and wakes up the upload routine.
+// It must be called with the lock held.
+func (d *S3Driver) closeObject(partition string, o *object) {
+	delete(d.objects, partition)
+	if err := d.commitObject(o); err != nil {
+		d.reportError(err)
+	}
+	if err := o.file.Close(); err != nil {
+		d.reportError(fmt.Errorf("close %s: %w", o.path, err))
+	}
+	if err := d.complete(o.path, o.manifest); err != nil {
+		d.reportError(err)
+	}
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// commit commits the objects being written, and closes the objects of the previous hours.
+func (d *S3Driver) commit(now time.Time) {
+	hour := now.Truncate(time.Hour)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for partition, o := range d.objects {
+		if o.manifest.Hour.Before(hour) {
+			d.closeObject(partition, o)
+		} else if err := d.commitObject(o); err != nil {
+			d.reportError(err)
+		}
+	}
+}
+
+func (d *S3Driver) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch d.compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}
+	return nopCloser{w}, nil
+}
+
+// Send writes a message to the object of its hour and exporter.
+func (d *S3Driver) Send(key, data []byte) error {
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	exporter := d.exporter(data)
+	partition := hour.Format(time.RFC3339) + "/" + exporter
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	o, ok := d.objects[partition]
+	if !ok {
+		if d.maxOpen > 0 && len(d.objects) >= d.maxOpen {
+			var oldest string
+			for p, o := range d.objects {
+				if oldest == "" || o.lastWrite.Before(d.objects[oldest].lastWrite) {
+					oldest = p
+				}
+			}
+			d.closeObject(oldest, d.objects[oldest])
+		}
+		var err error
+		if o, err = d.openObject(now, hour, exporter); err != nil {
+			metrics.TransportMessages.WithLabelValues("s3", "failure").Inc()
+			return err
+		}
+		d.objects[partition] = o
+	}
+	if o.writer == nil {
+		var err error
+		if o.writer, err = d.newWriter(o.file); err != nil {
+			return fmt.Errorf("create compressor: %w", err)
+		}
+	}
+	n, err := o.writer.Write(data)
+	if err == nil && d.format == formatNDJSON {
+		_, err = o.writer.Write([]byte{'\n'})
+		n++
+	}
+	if err != nil {
+		metrics.TransportMessages.WithLabelValues("s3", "failure").Inc()
+		return fmt.Errorf("write %s: %w", o.path, err)
+	}
+	o.pending++
+	o.written += int64(n)
+	o.lastWrite = now
+	if o.written >= d.objectSize {
+		d.closeObject(partition, o)
+	}
+	return nil
+}
+
+func (d *S3Driver) reportError(err error) {
+	select {
+	case d.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
+
+// upload uploads the complete staging files when notified, and once more when stopping.
+// Files which cannot be uploaded are kept and retried later.
+func (d *S3Driver) upload() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopCh:
+			d.uploadAll()
+			return
+		case <-d.notify:
+		case <-ticker.C:
+		}
+		d.uploadAll()
+	}
+}
+
+func (d *S3Driver) uploadAll() {
+	paths, err := filepath.Glob(filepath.Join(d.staging, "*"+manifestExt))
+	if err != nil {
+		d.reportError(fmt.Errorf("list staging files: %w", err))
+		return
+	}
+	for _, path := range paths {
+		path = strings.TrimSuffix(path, manifestExt)
+		m, err := readManifest(path + manifestExt)
+		if err != nil {
+			d.reportError(err)
+			continue
+		}
+		if m.Completed == nil {
+			continue
+		}
+		if err := d.uploadObject(path, m); err != nil {
+			d.reportError(fmt.Errorf("upload %s: %w", m.Key, err))
+			continue
+		}
+		metrics.TransportMessages.WithLabelValues("s3", "success").Add(float64(m.Records))
+		os.Remove(path + dataExt)
+		os.Remove(path + manifestExt)
+	}
+}
+
+// uploadObject uploads an object, in parts if it is larger than the part size, then its manifest.
+func (d *S3Driver) uploadObject(path string, m manifest) error {
+	f, err := os.Open(path + dataExt)
+	if err != nil {
+		return fmt.Errorf("open staging file: %w", err)
+	}
+	defer f.Close()
+
+	if m.Size <= d.partSize {
+		payload, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("read staging file: %w", err)
+		}
+		if err := d.client.putObject(m.Key, d.contentType(), payload); err != nil {
+			return err
+		}
+	} else {
+		uploadID, err := d.client.createMultipartUpload(m.Key, d.contentType())
+		if err != nil {
+			return err
+		}
+		if err := d.uploadParts(f, m.Key, uploadID); err != nil {
+			if abortErr := d.client.abortMultipartUpload(m.Key, uploadID); abortErr != nil {
+				d.reportError(abortErr)
+			}
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	return d.client.putObject(m.Key+".manifest.json", "application/json", b)
+}
+
+func (d *S3Driver) uploadParts(r io.Reader, key, uploadID string) error {
+	var etags []string
+	buf := make([]byte, d.partSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			etag, uploadErr := d.client.uploadPart(key, uploadID, len(etags)+1, buf[:n])
+			if uploadErr != nil {
+				return uploadErr
+			}
+			etags = append(etags, etag)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read staging file: %w", err)
+		}
+	}
+	return d.client.completeMultipartUpload(key, uploadID, etags)
+}
+
+// Errors returns staging and upload errors.
+func (d *S3Driver) Errors() <-chan error {
+	return d.errors
+}
+
+// Close completes the objects being written and uploads them.
+func (d *S3Driver) Close() error {
+	if d.stopCh == nil {
+		return nil
+	}
+	d.lock.Lock()
+	for partition, o := range d.objects {
+		d.closeObject(partition, o)
+	}
+	d.lock.Unlock()
+	close(d.stopCh)
+	d.tickWg.Wait()
+	d.wg.Wait()
+	close(d.errors)
+	d.stopCh = nil
+	return nil
+}
+
+func init() {
+	d := &S3Driver{}
+	transport.RegisterTransportDriver("s3", d)
+}
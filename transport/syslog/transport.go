@@ -1,59 +1,372 @@
+// Package syslog implements an RFC 5424 syslog transport over UDP, TCP or TLS.
 package syslog
 
 import (
-	"errors"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"flag"
-	"log"
-	"log/syslog"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tgragnato/goflow/transport"
 )
 
-type customWriter struct {
-	writer *syslog.Writer
+const (
+	dialTimeout = 5 * time.Second
+	maxBackoff  = 30 * time.Second
+	nilValue    = "-"
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
 }
 
-func (cw *customWriter) Write(p []byte) (n int, err error) {
-	message := string(p)
-	parts := strings.SplitN(message, " ", 3)
-	if len(parts) == 3 {
-		// Remove the timestamp from the log message (YYYY/MM/DD HH:MM:SS message)
-		message = parts[2]
-		// Remove leading and trailing whitespaces
-		message = strings.TrimSpace(message)
-	}
-	return cw.writer.Write([]byte(message))
+var severities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
 }
 
+// SyslogDriver sends messages as RFC 5424 syslog messages. The fields of JSON messages
+// are sent as the parameters of a structured data element, other messages as the message text.
+// Messages are sent by a routine which reconnects after failures, Send blocks when its queue is full.
 type SyslogDriver struct {
-	protocol string
-	address  string
+	protocol     string
+	address      string
+	facility     string
+	severity     string
+	hostname     string
+	appName      string
+	msgID        string
+	sdID         string
+	timeout      time.Duration
+	retryBackoff time.Duration
+	queueSize    int
+	tlsCA        string
+	tlsCert      string
+	tlsKey       string
+	tlsInsecure  bool
+
+	priority  int
+	procID    string
+	tlsConfig *tls.Config
+	conn      net.Conn
+
+	lock   sync.RWMutex // sends to the queue, which is closed with the write lock
+	closed bool
+	queue  chan []byte
+	errors chan error
+	stopCh chan struct{}
+	wg     sync.WaitGroup // write routine
 }
 
+// Prepare registers flags for the syslog transport configuration.
 func (s *SyslogDriver) Prepare() error {
-	flag.StringVar(&s.protocol, "transport.syslog.protocol", "udp", "Replace udp with tcp if your syslog server uses TCP")
+	flag.StringVar(&s.protocol, "transport.syslog.protocol", "udp", "Syslog transport protocol (udp, tcp, tls)")
 	flag.StringVar(&s.address, "transport.syslog.address", "localhost:514", "Remote syslog server address")
+	flag.StringVar(&s.facility, "transport.syslog.facility", "local0", "Syslog facility")
+	flag.StringVar(&s.severity, "transport.syslog.severity", "info", "Syslog severity")
+	flag.StringVar(&s.hostname, "transport.syslog.hostname", "", "Hostname of the messages (empty for the hostname of the system)")
+	flag.StringVar(&s.appName, "transport.syslog.appname", "goflow", "Application name of the messages")
+	flag.StringVar(&s.msgID, "transport.syslog.msgid", "flow", "Message ID of the messages")
+	flag.StringVar(&s.sdID, "transport.syslog.sdid", "flow@32473", "Structured data ID of the fields of JSON messages")
+	flag.DurationVar(&s.timeout, "transport.syslog.timeout", 10*time.Second, "Write timeout")
+	flag.DurationVar(&s.retryBackoff, "transport.syslog.retry.backoff", time.Second, "Initial delay before reconnecting, doubled after each failure")
+	flag.IntVar(&s.queueSize, "transport.syslog.queue", 1024, "Number of messages waiting to be sent before blocking")
+	flag.StringVar(&s.tlsCA, "transport.syslog.tls.ca", "", "CA certificates file of the server (empty for the system ones)")
+	flag.StringVar(&s.tlsCert, "transport.syslog.tls.cert", "", "Client certificate file")
+	flag.StringVar(&s.tlsKey, "transport.syslog.tls.key", "", "Client key file")
+	flag.BoolVar(&s.tlsInsecure, "transport.syslog.tls.insecure", false, "Skip the verification of the server certificate")
 	return nil
 }
 
+// headerValue checks a header field: printable US-ASCII without spaces, or the nil value if empty.
+func headerValue(name, value string, maxLength int) (string, error) {
+	if value == "" {
+		return nilValue, nil
+	}
+	if len(value) > maxLength {
+		return "", fmt.Errorf("%s longer than %d characters", name, maxLength)
+	}
+	for _, c := range []byte(value) {
+		if c < 33 || c > 126 {
+			return "", fmt.Errorf("invalid character in %s %q", name, value)
+		}
+	}
+	return value, nil
+}
+
+// sdName checks a structured data name.
+func sdName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SyslogDriver) loadTLSConfig() (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(s.address)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: s.tlsInsecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if s.tlsCA != "" {
+		ca, err := os.ReadFile(s.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in %s", s.tlsCA)
+		}
+	}
+	if s.tlsCert != "" || s.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(s.tlsCert, s.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Init checks the configuration, connects to the server and starts the write routine.
 func (s *SyslogDriver) Init() error {
-	remoteSyslog, err := syslog.Dial(s.protocol, s.address, syslog.LOG_INFO|syslog.LOG_LOCAL0, "goflow")
+	facility, ok := facilities[s.facility]
+	if !ok {
+		return fmt.Errorf("syslog transport: unknown facility %s", s.facility)
+	}
+	severity, ok := severities[s.severity]
+	if !ok {
+		return fmt.Errorf("syslog transport: unknown severity %s", s.severity)
+	}
+	s.priority = facility*8 + severity
+
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+	}
+	var err error
+	if s.hostname, err = headerValue("hostname", s.hostname, 255); err != nil {
+		return fmt.Errorf("syslog transport: %w", err)
+	}
+	if s.appName, err = headerValue("application name", s.appName, 48); err != nil {
+		return fmt.Errorf("syslog transport: %w", err)
+	}
+	if s.msgID, err = headerValue("message ID", s.msgID, 32); err != nil {
+		return fmt.Errorf("syslog transport: %w", err)
+	}
+	if !sdName(s.sdID) {
+		return fmt.Errorf("syslog transport: invalid structured data ID %q", s.sdID)
+	}
+	s.procID = strconv.Itoa(os.Getpid())
+
+	switch s.protocol {
+	case "udp", "tcp":
+	case "tls":
+		if s.tlsConfig, err = s.loadTLSConfig(); err != nil {
+			return fmt.Errorf("syslog transport: %w", err)
+		}
+	default:
+		return fmt.Errorf("syslog transport: unsupported protocol %s", s.protocol)
+	}
+	if s.retryBackoff <= 0 {
+		return fmt.Errorf("syslog transport: retry backoff must be positive")
+	}
+	if err := s.connect(); err != nil {
+		return fmt.Errorf("syslog transport: %w", err)
+	}
+
+	s.closed = false
+	s.queue = make(chan []byte, s.queueSize)
+	s.errors = make(chan error, 16)
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go s.write()
+	return nil
+}
+
+// connect opens the connection to the server.
+func (s *SyslogDriver) connect() error {
+	var conn net.Conn
+	var err error
+	if s.protocol == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout(s.protocol, s.address, dialTimeout)
+	}
 	if err != nil {
-		return errors.New("Failed to connect to remote syslog server: " + err.Error())
+		return fmt.Errorf("connect: %w", err)
 	}
+	s.conn = conn
+	return nil
+}
+
+func (s *SyslogDriver) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default: // errors are dropped when nobody reads them
+	}
+}
 
-	log.SetOutput(&customWriter{writer: remoteSyslog})
+// send writes a message, with octet-counting framing over TCP, reconnecting if needed.
+func (s *SyslogDriver) send(message []byte) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	if s.protocol != "udp" {
+		framed := strconv.AppendInt(nil, int64(len(message)), 10)
+		framed = append(framed, ' ')
+		message = append(framed, message...)
+	}
+	if s.timeout > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	}
+	if _, err := s.conn.Write(message); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("send message: %w", err)
+	}
 	return nil
 }
 
+// write sends the queued messages, retrying a failed message until it is sent.
+// Once the driver is closing, the messages which cannot be sent are dropped.
+func (s *SyslogDriver) write() {
+	defer s.wg.Done()
+	backoff := s.retryBackoff
+	for message := range s.queue {
+		for {
+			err := s.send(message)
+			if err == nil {
+				backoff = s.retryBackoff
+				break
+			}
+			s.reportError(fmt.Errorf("syslog transport: %w", err))
+			select {
+			case <-s.stopCh:
+				dropped := 1
+				for range s.queue {
+					dropped++
+				}
+				s.reportError(fmt.Errorf("syslog transport: dropped %d messages", dropped))
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxBackoff)
+		}
+	}
+}
+
+// sdEscaper escapes the characters of structured data parameter values.
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// structuredData returns the structured data element of the fields of a JSON object,
+// in their order, or false if the message is not a JSON object.
+func (s *SyslogDriver) structuredData(data []byte) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+	sd := append([]byte{'['}, s.sdID...)
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, false
+		}
+		name, _ := t.(string)
+		if !sdName(name) {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		sd = fmt.Appendf(sd, ` %s="%s"`, name, sdEscaper.Replace(value))
+	}
+	if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return append(sd, ']'), true
+}
+
+// format returns the RFC 5424 message of a formatted message.
+func (s *SyslogDriver) format(now time.Time, data []byte) []byte {
+	message := fmt.Appendf(nil, "<%d>1 %s %s %s %s %s ",
+		s.priority, now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName, s.procID, s.msgID)
+	if sd, ok := s.structuredData(data); ok {
+		return append(message, sd...)
+	}
+	message = append(message, nilValue...)
+	if len(data) > 0 {
+		message = append(message, ' ')
+		message = append(message, data...)
+	}
+	return message
+}
+
+// Send queues a message, blocking when the queue is full.
+// It fails once the transport is closed.
 func (s *SyslogDriver) Send(key, data []byte) error {
-	log.Println(string(data))
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return fmt.Errorf("syslog transport: closed")
+	}
+	s.queue <- s.format(time.Now(), data)
 	return nil
 }
 
+// Errors returns the errors of the write routine.
+func (s *SyslogDriver) Errors() <-chan error {
+	return s.errors
+}
+
+// Close sends the queued messages and closes the connection.
 func (s *SyslogDriver) Close() error {
-	return nil
+	if s.stopCh == nil {
+		return nil
+	}
+	close(s.stopCh)
+	// the write routine drains the queue, so pending sends complete before it is closed
+	s.lock.Lock()
+	s.closed = true
+	close(s.queue)
+	s.lock.Unlock()
+	s.wg.Wait()
+	var err error
+	if s.conn != nil {
+		err = s.conn.Close()
+	}
+	close(s.errors)
+	s.stopCh = nil
+	return err
 }
 
 func init() {
@@ -0,0 +1,103 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	s := &SyslogDriver{priority: 134, hostname: "collector", appName: "goflow", procID: "42", msgID: "flow", sdID: "flow@32473"}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+
+	message := string(s.format(now, []byte(`{"src_addr":"10.0.0.1","bytes":1500,"as_path":[1,2],"note":"a \"b\" ]","invalid name":1}`)))
+	expected := `<134>1 2024-05-01T12:00:00.123456Z collector goflow 42 flow [flow@32473 src_addr="10.0.0.1" bytes="1500" as_path="[1,2\]" note="a \"b\" \]"]`
+	if message != expected {
+		t.Fatalf("expected %s, got %s", expected, message)
+	}
+
+	message = string(s.format(now, []byte("src_addr=10.0.0.1 bytes=1500")))
+	expected = `<134>1 2024-05-01T12:00:00.123456Z collector goflow 42 flow - src_addr=10.0.0.1 bytes=1500`
+	if message != expected {
+		t.Fatalf("expected %s, got %s", expected, message)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var messages []string
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil {
+				break
+			}
+			message := make([]byte, n)
+			if _, err := io.ReadFull(r, message); err != nil {
+				break
+			}
+			messages = append(messages, string(message))
+		}
+		received <- messages
+	}()
+
+	s := &SyslogDriver{
+		protocol:     "tcp",
+		address:      ln.Addr().String(),
+		facility:     "local0",
+		severity:     "info",
+		hostname:     "collector",
+		appName:      "goflow",
+		msgID:        "flow",
+		sdID:         "flow@32473",
+		timeout:      time.Second,
+		retryBackoff: time.Millisecond,
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, data := range []string{`{"proto":"TCP"}`, "proto=UDP"} {
+		if err := s.Send(nil, []byte(data)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := s.Send(nil, []byte("proto=TCP")); err == nil {
+		t.Fatal("expected an error after close")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for err := range s.Errors() {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	messages := <-received
+	if len(messages) != 2 || !strings.HasPrefix(messages[0], "<134>1 ") ||
+		!strings.HasSuffix(messages[0], `[flow@32473 proto="TCP"]`) || !strings.HasSuffix(messages[1], " - proto=UDP") {
+		t.Fatalf("unexpected messages %q", messages)
+	}
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var templateRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// timePlaceholders render the time of a name (UTC).
+var timePlaceholders = map[string]func(t time.Time) string{
+	"yyyy": func(t time.Time) string { return fmt.Sprintf("%04d", t.Year()) },
+	"mm":   func(t time.Time) string { return fmt.Sprintf("%02d", t.Month()) },
+	"dd":   func(t time.Time) string { return fmt.Sprintf("%02d", t.Day()) },
+	"hh":   func(t time.Time) string { return fmt.Sprintf("%02d", t.Hour()) },
+	"min":  func(t time.Time) string { return fmt.Sprintf("%02d", t.Minute()) },
+	"sec":  func(t time.Time) string { return fmt.Sprintf("%02d", t.Second()) },
+	"ts":   func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) },
+}
+
+// Template renders a name (eg: a subject, a topic or a path) from the formatter key, the fields of JSON
+// messages and the time. The placeholder {key} is replaced by the hexadecimal key, {yyyy}, {mm}, {dd},
+// {hh}, {min}, {sec} and {ts} by the time (UTC), the other placeholders by the field values.
+// Absent values are replaced by "none".
+type Template struct {
+	template string
+	fields   []string
+	static   bool
+	replacer *strings.Replacer
+}
+
+// NewTemplate parses a template. The replacer, if not nil, escapes the values (eg: separators of the name).
+func NewTemplate(template string, replacer *strings.Replacer) *Template {
+	t := &Template{
+		template: template,
+		static:   !templateRe.MatchString(template),
+		replacer: replacer,
+	}
+	for _, m := range templateRe.FindAllStringSubmatch(template, -1) {
+		if _, ok := timePlaceholders[m[1]]; !ok && m[1] != "key" {
+			t.fields = append(t.fields, m[1])
+		}
+	}
+	return t
+}
+
+// Static reports whether the template has no placeholder.
+func (t *Template) Static() bool {
+	return t.static
+}
+
+// Pattern returns the template with its placeholders replaced by s (eg: a glob).
+func (t *Template) Pattern(s string) string {
+	return templateRe.ReplaceAllLiteralString(t.template, s)
+}
+
+func (t *Template) escape(value string) string {
+	if t.replacer != nil {
+		value = t.replacer.Replace(value)
+	}
+	return value
+}
+
+// Fields returns the escaped values of the template fields in a JSON message.
+func (t *Template) Fields(data []byte) map[string]string {
+	if len(t.fields) == 0 {
+		return nil
+	}
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil
+	}
+	fields := make(map[string]string, len(t.fields))
+	for _, field := range t.fields {
+		raw, ok := message[field]
+		if !ok {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		if value = t.escape(value); value != "" {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// RenderFields returns the name of a message at a time from its key and its field values (see Fields).
+func (t *Template) RenderFields(now time.Time, key []byte, fields map[string]string) string {
+	if t.static {
+		return t.template
+	}
+	now = now.UTC()
+	return templateRe.ReplaceAllStringFunc(t.template, func(s string) string {
+		name := s[1 : len(s)-1]
+		if name == "key" {
+			if value := t.escape(hex.EncodeToString(key)); value != "" {
+				return value
+			}
+			return "none"
+		}
+		if render, ok := timePlaceholders[name]; ok {
+			return render(now)
+		}
+		if value, ok := fields[name]; ok {
+			return value
+		}
+		return "none"
+	})
+}
+
+// Render returns the name of a message.
+func (t *Template) Render(key, data []byte) string {
+	if t.static {
+		return t.template
+	}
+	return t.RenderFields(time.Now(), key, t.Fields(data))
+}
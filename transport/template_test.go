@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 5, 1, 9, 3, 7, 0, time.UTC)
+	template := NewTemplate("out/{key}/{sampler_address}/{yyyy}/{mm}/{dd}/{hh}{min}{sec}-{ts}-{proto}-{site}.ndjson", strings.NewReplacer("/", "_"))
+	if template.Static() {
+		t.Fatal("expected a template with placeholders")
+	}
+	fields := template.Fields([]byte(`{"sampler_address":"192.0.2.1/32","proto":6,"site":""}`))
+	if len(fields) != 2 || fields["sampler_address"] != "192.0.2.1_32" || fields["proto"] != "6" {
+		t.Fatalf("expected the escaped sampler_address and proto, got %v", fields)
+	}
+	name := template.RenderFields(now, []byte{0xca, 0xfe}, fields)
+	if expected := "out/cafe/192.0.2.1_32/2024/05/01/090307-1714554187-6-none.ndjson"; name != expected {
+		t.Fatalf("expected %s, got %s", expected, name)
+	}
+	if name := template.RenderFields(now, nil, nil); !strings.HasPrefix(name, "out/none/none/") {
+		t.Fatalf("expected absent values replaced by none, got %s", name)
+	}
+	if pattern := template.Pattern("*"); pattern != "out/*/*/*/*/*/***-*-*-*.ndjson" {
+		t.Fatalf("unexpected pattern %s", pattern)
+	}
+
+	static := NewTemplate("flows", nil)
+	if !static.Static() || static.Render([]byte{1}, []byte(`{}`)) != "flows" {
+		t.Fatal("expected a static template")
+	}
+	if subject := NewTemplate("flows.{proto}.{key}", nil).Render([]byte{1}, []byte(`{"proto":"TCP"}`)); subject != "flows.TCP.01" {
+		t.Fatalf("expected flows.TCP.01, got %s", subject)
+	}
+}
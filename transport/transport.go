@@ -36,6 +36,25 @@ type TransportDriver interface {
 	Send(key, data []byte) error // Send a formatted message
 }
 
+// HeaderWriter is implemented by transports which can write a header line
+// whenever they start a new output (eg: a new file, but not an appended one).
+type HeaderWriter interface {
+	SetHeader(header func() []byte)
+}
+
+// Field is an output field of the mapping, with the type of its rendered values
+// (ip, datetime, string, integer, float or bool, empty when unknown).
+type Field struct {
+	Name string
+	Type string
+}
+
+// FieldsWriter is implemented by transports which use the output fields of the mapping
+// (eg: as table columns).
+type FieldsWriter interface {
+	SetFields(fields []Field)
+}
+
 // TransportInterface is the minimal interface needed to send payloads.
 type TransportInterface interface {
 	Send(key, data []byte) error
@@ -0,0 +1,236 @@
+// Package exporters provides per-exporter defaults and overrides loaded from a YAML file.
+package exporters
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the values applied to flows of an exporter.
+// Zero values leave the decoded or computed values untouched.
+type Config struct {
+	// Name replaces the reverse DNS guess of the sampler hostname.
+	Name string `yaml:"name"`
+	// Site and Tenant label the flows of the exporter.
+	Site   string `yaml:"site"`
+	Tenant string `yaml:"tenant"`
+	// TargetIndex replaces the default LMS target index.
+	TargetIndex string `yaml:"target_index"`
+	// SamplingRate forces a sampling rate regardless of the protocol.
+	SamplingRate uint64 `yaml:"sampling_rate"`
+	// Timezone of an exporter reporting local time as UTC (eg: Europe/Paris).
+	Timezone string `yaml:"timezone"`
+	// TrustAS keeps the AS numbers reported by the exporter instead of GeoIP ones.
+	TrustAS *bool `yaml:"trust_as"`
+
+	location *time.Location
+}
+
+// Location returns the timezone of the exporter or nil when unset.
+func (c Config) Location() *time.Location {
+	return c.location
+}
+
+// TrustASFields reports whether the AS numbers reported by the exporter are kept.
+func (c Config) TrustASFields() bool {
+	return c.TrustAS != nil && *c.TrustAS
+}
+
+// merge overlays the non-zero values of o on c.
+func (c Config) merge(o Config) Config {
+	if o.Name != "" {
+		c.Name = o.Name
+	}
+	if o.Site != "" {
+		c.Site = o.Site
+	}
+	if o.Tenant != "" {
+		c.Tenant = o.Tenant
+	}
+	if o.TargetIndex != "" {
+		c.TargetIndex = o.TargetIndex
+	}
+	if o.SamplingRate != 0 {
+		c.SamplingRate = o.SamplingRate
+	}
+	if o.Timezone != "" {
+		c.Timezone = o.Timezone
+		c.location = o.location
+	}
+	if o.TrustAS != nil {
+		c.TrustAS = o.TrustAS
+	}
+	return c
+}
+
+// Entry associates a configuration with an exporter address or prefix.
+type Entry struct {
+	Match  string `yaml:"match"`
+	Config `yaml:",inline"`
+}
+
+// File is the YAML representation of the overrides file.
+type File struct {
+	Defaults  Config  `yaml:"defaults"`
+	Exporters []Entry `yaml:"exporters"`
+}
+
+type entry struct {
+	prefix netip.Prefix
+	config Config
+}
+
+type table struct {
+	defaults Config
+	entries  []entry // shortest prefixes first
+}
+
+// Overrides resolves the configuration of an exporter. It is safe for concurrent use
+// and can be reloaded from its file.
+type Overrides struct {
+	path  string
+	lock  sync.RWMutex
+	table *table
+}
+
+// Load parses an overrides document.
+func Load(r io.Reader) (*Overrides, error) {
+	t, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Overrides{table: t}, nil
+}
+
+// LoadFile parses an overrides file which can later be reloaded with Reload.
+func LoadFile(path string) (*Overrides, error) {
+	t, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Overrides{path: path, table: t}, nil
+}
+
+// Reload parses the file again. On error, the previous configuration is kept.
+func (o *Overrides) Reload() error {
+	if o.path == "" {
+		return nil
+	}
+	t, err := parseFile(o.path)
+	if err != nil {
+		return err
+	}
+	o.lock.Lock()
+	o.table = t
+	o.lock.Unlock()
+	return nil
+}
+
+// Lookup returns the defaults merged with the entries matching addr, from the least
+// to the most specific one.
+// The boolean is false when neither defaults nor an entry apply.
+func (o *Overrides) Lookup(addr netip.Addr) (Config, bool) {
+	if o == nil {
+		return Config{}, false
+	}
+	o.lock.RLock()
+	t := o.table
+	o.lock.RUnlock()
+
+	addr = addr.Unmap()
+	cfg := t.defaults
+	found := cfg != (Config{})
+	for _, e := range t.entries {
+		if e.prefix.Contains(addr) {
+			cfg = cfg.merge(e.config)
+			found = true
+		}
+	}
+	return cfg, found
+}
+
+func parseFile(path string) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open exporters file %s: %w", path, err)
+	}
+	defer f.Close()
+	t, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("exporters file %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func parse(r io.Reader) (*table, error) {
+	var file File
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("decode exporters: %w", err)
+	}
+
+	defaults, err := resolve(file.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("defaults: %w", err)
+	}
+	t := &table{defaults: defaults}
+	for _, e := range file.Exporters {
+		prefix, err := parseMatch(e.Match)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %q: %w", e.Match, err)
+		}
+		cfg, err := resolve(e.Config)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %q: %w", e.Match, err)
+		}
+		t.entries = append(t.entries, entry{prefix: prefix, config: cfg})
+	}
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return t.entries[i].prefix.Bits() < t.entries[j].prefix.Bits()
+	})
+	return t, nil
+}
+
+func parseMatch(match string) (netip.Prefix, error) {
+	if strings.Contains(match, "/") {
+		prefix, err := netip.ParsePrefix(match)
+		if err != nil {
+			return prefix, fmt.Errorf("parse prefix: %w", err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(match)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("parse address: %w", err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func resolve(cfg Config) (Config, error) {
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return cfg, fmt.Errorf("load timezone: %w", err)
+		}
+		cfg.location = loc
+	}
+	return cfg, nil
+}
+
+// LocalToUTC corrects a timestamp in nanoseconds produced by an exporter whose clock
+// runs on local time of loc while claiming UTC.
+func LocalToUTC(ns uint64, loc *time.Location) uint64 {
+	if loc == nil || ns == 0 {
+		return ns
+	}
+	_, offset := time.Unix(0, int64(ns)).In(loc).Zone()
+	return uint64(int64(ns) - int64(offset)*1e9)
+}
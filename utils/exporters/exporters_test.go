@@ -0,0 +1,131 @@
+package exporters
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFile = `
+defaults:
+  target_index: flows
+exporters:
+  - match: 192.0.2.0/24
+    site: par1
+    tenant: acme
+  - match: 192.0.2.10
+    name: edge-1
+    tenant: globex
+    sampling_rate: 1000
+    trust_as: true
+  - match: 2001:db8::/32
+    timezone: Europe/Paris
+`
+
+func TestOverridesLookup(t *testing.T) {
+	t.Parallel()
+	o, err := Load(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	cfg, ok := o.Lookup(netip.MustParseAddr("::ffff:192.0.2.10"))
+	if !ok {
+		t.Fatal("expected exporter found")
+	}
+	if cfg.Name != "edge-1" || cfg.SamplingRate != 1000 || !cfg.TrustASFields() {
+		t.Fatalf("expected host entry, got %+v", cfg)
+	}
+	if cfg.TargetIndex != "flows" {
+		t.Fatalf("expected defaults applied, got target index %q", cfg.TargetIndex)
+	}
+	if cfg.Site != "par1" || cfg.Tenant != "globex" {
+		t.Fatalf("expected the prefix entry overridden by the host entry, got site %q and tenant %q", cfg.Site, cfg.Tenant)
+	}
+
+	cfg, _ = o.Lookup(netip.MustParseAddr("192.0.2.20"))
+	if cfg.Site != "par1" || cfg.Tenant != "acme" || cfg.TrustASFields() {
+		t.Fatalf("expected prefix entry, got %+v", cfg)
+	}
+
+	cfg, _ = o.Lookup(netip.MustParseAddr("2001:db8::1"))
+	if cfg.Location() == nil || cfg.Location().String() != "Europe/Paris" {
+		t.Fatalf("expected Europe/Paris location, got %v", cfg.Location())
+	}
+
+	cfg, ok = o.Lookup(netip.MustParseAddr("198.51.100.1"))
+	if !ok || cfg.TargetIndex != "flows" || cfg.Name != "" {
+		t.Fatalf("expected defaults only, got %+v (%v)", cfg, ok)
+	}
+
+	var empty *Overrides
+	if _, ok := empty.Lookup(netip.MustParseAddr("192.0.2.10")); ok {
+		t.Fatal("expected nil overrides to match nothing")
+	}
+}
+
+func TestOverridesInvalid(t *testing.T) {
+	t.Parallel()
+	for _, doc := range []string{
+		"exporters:\n  - match: 192.0.2.300\n",
+		"exporters:\n  - match: 192.0.2.0/24\n    timezone: Nowhere/Land\n",
+		"exporters: [",
+	} {
+		if _, err := Load(strings.NewReader(doc)); err == nil {
+			t.Fatalf("expected error for %q", doc)
+		}
+	}
+}
+
+func TestOverridesReload(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "exporters.yaml")
+	if err := os.WriteFile(path, []byte("exporters:\n  - match: 192.0.2.1\n    name: before\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	o, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("load file: %v", err)
+	}
+	addr := netip.MustParseAddr("192.0.2.1")
+
+	if err := os.WriteFile(path, []byte("exporters:\n  - match: 192.0.2.1\n    name: after\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := o.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if cfg, _ := o.Lookup(addr); cfg.Name != "after" {
+		t.Fatalf("expected name after, got %q", cfg.Name)
+	}
+
+	if err := os.WriteFile(path, []byte("exporters: ["), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := o.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	if cfg, _ := o.Lookup(addr); cfg.Name != "after" {
+		t.Fatalf("expected previous configuration kept, got %q", cfg.Name)
+	}
+}
+
+func TestLocalToUTC(t *testing.T) {
+	t.Parallel()
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// 2024-07-01 12:00 local time reported as UTC, Paris is UTC+2 in summer
+	local := uint64(time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	expected := uint64(time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC).UnixNano())
+	if got := LocalToUTC(local, loc); got != expected {
+		t.Fatalf("expected %d, got %d", expected, got)
+	}
+	if got := LocalToUTC(local, nil); got != local {
+		t.Fatalf("expected unchanged timestamp, got %d", got)
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	flowpb "github.com/tgragnato/goflow/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ForwardedBatch carries a batch of flows received from another collector.
+type ForwardedBatch struct {
+	Src      netip.AddrPort
+	Dst      netip.AddrPort
+	Batch    *flowpb.FlowBatch
+	Received time.Time
+}
+
+// GRPCReceiverConfig configures the TLS of a gRPC receiver and its limits.
+type GRPCReceiverConfig struct {
+	TLSCert     string // server certificate file, TLS is disabled when empty
+	TLSKey      string
+	TLSClientCA string // CA certificates of the clients, required to connect when set (mTLS)
+	MaxStreams  uint32 // concurrent streams per connection, 0 for the gRPC default
+	MaxMsgSize  int    // maximum size of a batch, 0 for the gRPC default
+}
+
+// GRPCReceiver accepts batches of flows forwarded by other collectors.
+// A batch is acknowledged once decoded, so the number of batches a sender keeps
+// in flight is bounded by the processing of the pipeline.
+type GRPCReceiver struct {
+	flowpb.UnimplementedForwarderServer
+
+	cfg        GRPCReceiverConfig
+	server     *grpc.Server
+	decodeFunc DecoderFunc
+	wg         sync.WaitGroup
+	errCh      chan error // linked to receiver, never closed
+}
+
+// NewGRPCReceiver creates a gRPC receiver with the provided configuration.
+func NewGRPCReceiver(cfg *GRPCReceiverConfig) (*GRPCReceiver, error) {
+	r := &GRPCReceiver{
+		errCh: make(chan error),
+	}
+	if cfg != nil {
+		r.cfg = *cfg
+	}
+
+	var opts []grpc.ServerOption
+	if r.cfg.TLSCert != "" || r.cfg.TLSKey != "" {
+		config, err := r.loadTLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("grpc receiver init: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	} else if r.cfg.TLSClientCA != "" {
+		return nil, fmt.Errorf("grpc receiver init: client CA requires a server certificate")
+	}
+	if r.cfg.MaxStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(r.cfg.MaxStreams))
+	}
+	if r.cfg.MaxMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(r.cfg.MaxMsgSize))
+	}
+	r.server = grpc.NewServer(opts...)
+	flowpb.RegisterForwarderServer(r.server, r)
+	return r, nil
+}
+
+func (r *GRPCReceiver) loadTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.TLSCert, r.cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.cfg.TLSClientCA != "" {
+		ca, err := os.ReadFile(r.cfg.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in %s", r.cfg.TLSClientCA)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (r *GRPCReceiver) logError(err error) {
+	select {
+	case r.errCh <- err:
+	default:
+	}
+}
+
+// Errors returns a channel of receiver errors.
+func (r *GRPCReceiver) Errors() <-chan error {
+	return r.errCh
+}
+
+// Forward decodes the batches of a stream and acknowledges them.
+func (r *GRPCReceiver) Forward(stream grpc.BidiStreamingServer[flowpb.FlowBatch, flowpb.FlowAck]) error {
+	var src, dst netip.AddrPort
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			src = normalizeAddrPort(addr.AddrPort())
+		}
+		if addr, ok := p.LocalAddr.(*net.TCPAddr); ok {
+			dst = normalizeAddrPort(addr.AddrPort())
+		}
+	}
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if r.decodeFunc != nil {
+			msg := ForwardedBatch{
+				Src:      src,
+				Dst:      dst,
+				Batch:    batch,
+				Received: time.Now().UTC(),
+			}
+			// the batch is acknowledged even if some flows could not be processed, as UDP packets are dropped
+			if err := r.decodeFunc(&msg); err != nil {
+				r.logError(&ReceiverError{err})
+			}
+		}
+		if err := stream.Send(&flowpb.FlowAck{Sequence: batch.Sequence}); err != nil {
+			return err
+		}
+	}
+}
+
+// Start listens on the address and serves the forwarded batches.
+func (r *GRPCReceiver) Start(addr string, port int, decodeFunc DecoderFunc) error {
+	if strings.ContainsRune(addr, ':') && !strings.ContainsRune(addr, '[') {
+		addr = "[" + addr + "]"
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", addr, port))
+	if err != nil {
+		return fmt.Errorf("grpc listen %s:%d: %w", addr, port, err)
+	}
+	r.decodeFunc = decodeFunc
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := r.server.Serve(ln); err != nil {
+			r.logError(&ReceiverError{fmt.Errorf("grpc serve: %w", err)})
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener and the streams, then waits for the server.
+func (r *GRPCReceiver) Stop() error {
+	r.server.Stop()
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,315 @@
+// Package otlp encodes OpenTelemetry (OTLP) log records and export requests.
+// Only the subset of opentelemetry/proto/logs/v1 needed to export flows is implemented.
+package otlp
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// SeverityInfo is the OTLP severity number of informational records.
+const SeverityInfo = 9
+
+// KeyValue is an attribute. Supported values are strings, booleans, integers, floats,
+// byte slices and slices of these types. Other values are ignored.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// LogRecord is a single OTLP log record.
+type LogRecord struct {
+	TimeUnixNano         uint64
+	ObservedTimeUnixNano uint64
+	SeverityNumber       int32
+	SeverityText         string
+	EventName            string
+	Body                 string
+	Attributes           []KeyValue
+}
+
+// Scope describes the instrumentation scope of the records.
+type Scope struct {
+	Name    string
+	Version string
+}
+
+// appendAnyValue encodes the content of an AnyValue message.
+func appendAnyValue(b []byte, value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		return appendInt(b, int64(v)), true
+	case int32:
+		return appendInt(b, int64(v)), true
+	case int64:
+		return appendInt(b, v), true
+	case uint32:
+		return appendInt(b, int64(v)), true
+	case uint64:
+		if v > math.MaxInt64 {
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendString(b, fmt.Sprint(v))
+			return b, true
+		}
+		return appendInt(b, int64(v)), true
+	case float32:
+		return appendDouble(b, float64(v)), true
+	case float64:
+		return appendDouble(b, v), true
+	case []byte:
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	case []interface{}:
+		var array []byte
+		for _, item := range v {
+			value, ok := appendAnyValue(nil, item)
+			if !ok {
+				continue
+			}
+			array = protowire.AppendTag(array, 1, protowire.BytesType)
+			array = protowire.AppendBytes(array, value)
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, array)
+	default:
+		return b, false
+	}
+	return b, true
+}
+
+func appendInt(b []byte, v int64) []byte {
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, v float64) []byte {
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// appendAttributes encodes KeyValue messages as the repeated field num.
+// Attributes with a nil or unsupported value are skipped.
+func appendAttributes(b []byte, num protowire.Number, attributes []KeyValue) []byte {
+	for _, attribute := range attributes {
+		value, ok := appendAnyValue(nil, attribute.Value)
+		if !ok {
+			continue
+		}
+		var kv []byte
+		kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+		kv = protowire.AppendString(kv, attribute.Key)
+		kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+		kv = protowire.AppendBytes(kv, value)
+
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, kv)
+	}
+	return b
+}
+
+// MarshalLogRecord encodes a LogRecord message.
+func MarshalLogRecord(r *LogRecord) []byte {
+	var b []byte
+	if r.TimeUnixNano != 0 {
+		b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, r.TimeUnixNano)
+	}
+	if r.SeverityNumber != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.SeverityNumber))
+	}
+	if r.SeverityText != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, r.SeverityText)
+	}
+	if r.Body != "" {
+		body, _ := appendAnyValue(nil, r.Body)
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, body)
+	}
+	b = appendAttributes(b, 6, r.Attributes)
+	if r.ObservedTimeUnixNano != 0 {
+		b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, r.ObservedTimeUnixNano)
+	}
+	if r.EventName != "" {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendString(b, r.EventName)
+	}
+	return b
+}
+
+// MarshalResource encodes a Resource message.
+func MarshalResource(attributes []KeyValue) []byte {
+	return appendAttributes(nil, 1, attributes)
+}
+
+func marshalScopeLogs(scope Scope, records [][]byte) []byte {
+	var s []byte
+	if scope.Name != "" {
+		s = protowire.AppendTag(s, 1, protowire.BytesType)
+		s = protowire.AppendString(s, scope.Name)
+	}
+	if scope.Version != "" {
+		s = protowire.AppendTag(s, 2, protowire.BytesType)
+		s = protowire.AppendString(s, scope.Version)
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, s)
+	for _, record := range records {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, record)
+	}
+	return b
+}
+
+// MarshalResourceLogs encodes a ResourceLogs message holding records from a single scope.
+func MarshalResourceLogs(resource []byte, scope Scope, records ...[]byte) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, resource)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, marshalScopeLogs(scope, records))
+	return b
+}
+
+// consumeFields calls fn for each field of a length-delimited type in a message.
+func consumeFields(b []byte, fn func(num protowire.Number, value []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		fn(num, value)
+	}
+	return nil
+}
+
+type group struct {
+	resource []byte
+	scope    []byte
+	records  [][]byte
+}
+
+// Batch accumulates ResourceLogs messages and merges the records sharing
+// the same resource and scope into a single ExportLogsServiceRequest.
+type Batch struct {
+	groups  map[string]*group
+	order   []string
+	records int
+	size    int
+}
+
+// NewBatch returns an empty batch.
+func NewBatch() *Batch {
+	return &Batch{
+		groups: make(map[string]*group),
+	}
+}
+
+// Add appends the records of an encoded ResourceLogs message.
+// The batch keeps references to resourceLogs, which must not be modified afterwards.
+func (b *Batch) Add(resourceLogs []byte) error {
+	var resource []byte
+	var scopeLogs [][]byte
+	err := consumeFields(resourceLogs, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			resource = value
+		case 2:
+			scopeLogs = append(scopeLogs, value)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("decode resource logs: %w", err)
+	}
+	for _, sl := range scopeLogs {
+		var scope []byte
+		var records [][]byte
+		err := consumeFields(sl, func(num protowire.Number, value []byte) {
+			switch num {
+			case 1:
+				scope = value
+			case 2:
+				records = append(records, value)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("decode scope logs: %w", err)
+		}
+
+		key := string(protowire.AppendBytes(protowire.AppendBytes(nil, resource), scope))
+		g, ok := b.groups[key]
+		if !ok {
+			g = &group{resource: resource, scope: scope}
+			b.groups[key] = g
+			b.order = append(b.order, key)
+			b.size += len(resource) + len(scope)
+		}
+		g.records = append(g.records, records...)
+		b.records += len(records)
+		for _, record := range records {
+			b.size += len(record)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records in the batch.
+func (b *Batch) Len() int {
+	return b.records
+}
+
+// Size returns an estimation of the encoded size of the batch.
+func (b *Batch) Size() int {
+	return b.size
+}
+
+// Marshal encodes the batch as an ExportLogsServiceRequest.
+func (b *Batch) Marshal() []byte {
+	out := make([]byte, 0, b.size+b.records*8+len(b.order)*16)
+	for _, key := range b.order {
+		g := b.groups[key]
+
+		var sl []byte
+		sl = protowire.AppendTag(sl, 1, protowire.BytesType)
+		sl = protowire.AppendBytes(sl, g.scope)
+		for _, record := range g.records {
+			sl = protowire.AppendTag(sl, 2, protowire.BytesType)
+			sl = protowire.AppendBytes(sl, record)
+		}
+
+		var rl []byte
+		rl = protowire.AppendTag(rl, 1, protowire.BytesType)
+		rl = protowire.AppendBytes(rl, g.resource)
+		rl = protowire.AppendTag(rl, 2, protowire.BytesType)
+		rl = protowire.AppendBytes(rl, sl)
+
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, rl)
+	}
+	return out
+}
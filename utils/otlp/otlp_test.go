@@ -0,0 +1,67 @@
+package otlp
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// countRecords returns the number of ResourceLogs and LogRecords in an export request.
+func countRecords(t *testing.T, request []byte) (resources, records int) {
+	t.Helper()
+	err := consumeFields(request, func(num protowire.Number, rl []byte) {
+		resources++
+		if err := consumeFields(rl, func(num protowire.Number, sl []byte) {
+			if num != 2 {
+				return
+			}
+			if err := consumeFields(sl, func(num protowire.Number, value []byte) {
+				if num == 2 {
+					records++
+				}
+			}); err != nil {
+				t.Fatalf("decode scope logs: %v", err)
+			}
+		}); err != nil {
+			t.Fatalf("decode resource logs: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	return resources, records
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+	scope := Scope{Name: "test"}
+	resourceA := MarshalResource([]KeyValue{{Key: "flow.exporter.address", Value: "192.0.2.1"}})
+	resourceB := MarshalResource([]KeyValue{{Key: "flow.exporter.address", Value: "192.0.2.2"}})
+	record := MarshalLogRecord(&LogRecord{
+		TimeUnixNano:   1,
+		SeverityNumber: SeverityInfo,
+		Attributes: []KeyValue{
+			{Key: "bytes", Value: uint64(1500)},
+			{Key: "as_path", Value: []interface{}{uint32(65000), uint32(65001)}},
+			{Key: "unsupported", Value: struct{}{}},
+		},
+	})
+
+	batch := NewBatch()
+	for _, resource := range [][]byte{resourceA, resourceB, resourceA} {
+		if err := batch.Add(MarshalResourceLogs(resource, scope, record)); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if batch.Len() != 3 {
+		t.Fatalf("expected 3 records, got %d", batch.Len())
+	}
+	resources, records := countRecords(t, batch.Marshal())
+	if resources != 2 || records != 3 {
+		t.Fatalf("expected 2 resources and 3 records, got %d and %d", resources, records)
+	}
+
+	if err := batch.Add([]byte{0x0a, 0xff}); err == nil {
+		t.Fatal("expected error on truncated message")
+	}
+}
@@ -0,0 +1,521 @@
+// Package pcap reads and writes the UDP datagrams of packet capture files.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/tgragnato/goflow/utils"
+)
+
+// Link types of the captures.
+const (
+	LinkTypeNull      = 0
+	LinkTypeEthernet  = 1
+	LinkTypeRaw       = 101
+	LinkTypeLinuxSLL  = 113
+	LinkTypeIPv4      = 228
+	LinkTypeIPv6      = 229
+	LinkTypeLinuxSLL2 = 276
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	fileHeaderLength  = 24
+	recordHeaderLen   = 16
+	maxSnapLength     = 256 * 1024
+)
+
+// pcapng block types and options.
+const (
+	ngSectionHeader     = 0x0a0d0d0a
+	ngByteOrderMagic    = 0x1a2b3c4d
+	ngInterface         = 1
+	ngPacket            = 2 // obsolete
+	ngSimplePacket      = 3
+	ngEnhancedPacket    = 6
+	ngOptionEnd         = 0
+	ngOptionTsResol     = 9
+	ngOptionTsOffset    = 14
+	ngBlockHeaderLength = 8
+	maxBlockLength      = maxSnapLength + 4096
+)
+
+// ErrNotUDP is returned when a frame is not an unfragmented UDP datagram.
+var ErrNotUDP = errors.New("not a UDP datagram")
+
+// ngInterfaceInfo describes the interface of pcapng packets.
+type ngInterfaceInfo struct {
+	linkType uint32
+	snapLen  uint32
+	binary   bool  // the resolution is a power of 2 instead of 10
+	exponent uint8 // the timestamps are in units of 10^-exponent or 2^-exponent seconds
+	offset   int64 // seconds added to the timestamps
+}
+
+// timestamp converts a pcapng timestamp.
+func (i ngInterfaceInfo) timestamp(ts uint64) time.Time {
+	var seconds, nanoseconds uint64
+	switch {
+	case i.binary:
+		exponent := i.exponent
+		if exponent > 32 { // keeps the fraction from overflowing
+			ts >>= exponent - 32
+			exponent = 32
+		}
+		seconds = ts >> exponent
+		nanoseconds = (ts & (1<<exponent - 1)) * 1e9 >> exponent
+	default:
+		units := uint64(1)
+		for j := uint8(0); j < i.exponent && j < 19; j++ {
+			units *= 10
+		}
+		seconds = ts / units
+		nanoseconds = ts % units
+		if units <= 1e9 {
+			nanoseconds *= 1e9 / units
+		} else {
+			nanoseconds /= units / 1e9
+		}
+	}
+	return time.Unix(int64(seconds)+i.offset, int64(nanoseconds)).UTC()
+}
+
+// Reader reads the UDP datagrams of a classic pcap or a pcapng file.
+type Reader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+	header   [recordHeaderLen]byte
+	frame    []byte
+
+	ng         bool
+	interfaces []ngInterfaceInfo // of the current section
+	last       time.Time         // timestamp of the last packet, for the blocks without one
+}
+
+// NewReader reads the file header of a capture.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	magic, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("read pcap header: %w", err)
+	}
+	if binary.BigEndian.Uint32(magic) == ngSectionHeader {
+		reader.ng = true
+		reader.order = binary.LittleEndian
+		return reader, nil
+	}
+
+	var header [fileHeaderLength]byte
+	if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+		return nil, fmt.Errorf("read pcap header: %w", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header[:]) == magicMicroseconds:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[:]) == magicMicroseconds:
+		reader.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[:]) == magicNanoseconds:
+		reader.order, reader.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[:]) == magicNanoseconds:
+		reader.order, reader.nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap file")
+	}
+	reader.linkType = reader.order.Uint32(header[20:]) & 0xffff
+	return reader, nil
+}
+
+// LinkType returns the link type of the last frame read. It is the link type
+// of the whole file for classic captures.
+func (r *Reader) LinkType() uint32 {
+	return r.linkType
+}
+
+// ReadFrame returns the next frame and its timestamp. The frame is only valid until the next call.
+func (r *Reader) ReadFrame() ([]byte, time.Time, error) {
+	if r.ng {
+		return r.readNgFrame()
+	}
+	if _, err := io.ReadFull(r.r, r.header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, time.Time{}, fmt.Errorf("truncated pcap record: %w", err)
+		}
+		return nil, time.Time{}, err // io.EOF at the end of the file
+	}
+	seconds := r.order.Uint32(r.header[0:])
+	fraction := r.order.Uint32(r.header[4:])
+	length := r.order.Uint32(r.header[8:])
+	if length > maxSnapLength {
+		return nil, time.Time{}, fmt.Errorf("pcap record too large: %d", length)
+	}
+	if cap(r.frame) < int(length) {
+		r.frame = make([]byte, length)
+	}
+	r.frame = r.frame[:length]
+	if _, err := io.ReadFull(r.r, r.frame); err != nil {
+		return nil, time.Time{}, fmt.Errorf("truncated pcap record: %w", err)
+	}
+	if !r.nano {
+		fraction *= 1000
+	}
+	return r.frame, time.Unix(int64(seconds), int64(fraction)).UTC(), nil
+}
+
+// readNgBlock returns the type and the body of the next pcapng block.
+// Section headers set the byte order of the following blocks.
+func (r *Reader) readNgBlock() (uint32, []byte, error) {
+	var header [ngBlockHeaderLength]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, fmt.Errorf("truncated pcapng block: %w", err)
+		}
+		return 0, nil, err // io.EOF at the end of the file
+	}
+	blockType := r.order.Uint32(header[:])
+	if binary.BigEndian.Uint32(header[:]) == ngSectionHeader {
+		blockType = ngSectionHeader
+		magic, err := r.r.Peek(4)
+		if err != nil {
+			return 0, nil, fmt.Errorf("truncated pcapng section header: %w", err)
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == ngByteOrderMagic:
+			r.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == ngByteOrderMagic:
+			r.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("invalid pcapng byte order magic %x", magic)
+		}
+	}
+	length := r.order.Uint32(header[4:])
+	if length < ngBlockHeaderLength+4 || length%4 != 0 || length > maxBlockLength {
+		return 0, nil, fmt.Errorf("invalid pcapng block length %d", length)
+	}
+	if cap(r.frame) < int(length) {
+		r.frame = make([]byte, length)
+	}
+	r.frame = r.frame[:length-ngBlockHeaderLength]
+	if _, err := io.ReadFull(r.r, r.frame); err != nil {
+		return 0, nil, fmt.Errorf("truncated pcapng block: %w", err)
+	}
+	return blockType, r.frame[:len(r.frame)-4], nil
+}
+
+// parseNgInterface reads an interface description block.
+func (r *Reader) parseNgInterface(body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("truncated pcapng interface description")
+	}
+	info := ngInterfaceInfo{
+		linkType: uint32(r.order.Uint16(body)),
+		snapLen:  r.order.Uint32(body[4:]),
+		exponent: 6,
+	}
+	for options := body[8:]; len(options) >= 4; {
+		code, length := r.order.Uint16(options), int(r.order.Uint16(options[2:]))
+		if code == ngOptionEnd {
+			break
+		}
+		padded := (length + 3) &^ 3
+		if 4+padded > len(options) {
+			return fmt.Errorf("truncated pcapng interface option")
+		}
+		value := options[4 : 4+length]
+		switch {
+		case code == ngOptionTsResol && length == 1:
+			info.binary, info.exponent = value[0]&0x80 != 0, value[0]&0x7f
+		case code == ngOptionTsOffset && length == 8:
+			info.offset = int64(r.order.Uint64(value))
+		}
+		options = options[4+padded:]
+	}
+	r.interfaces = append(r.interfaces, info)
+	return nil
+}
+
+// readNgFrame returns the next packet of a pcapng file.
+func (r *Reader) readNgFrame() ([]byte, time.Time, error) {
+	for {
+		blockType, body, err := r.readNgBlock()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		switch blockType {
+		case ngSectionHeader:
+			r.interfaces = r.interfaces[:0]
+		case ngInterface:
+			if err := r.parseNgInterface(body); err != nil {
+				return nil, time.Time{}, err
+			}
+		case ngEnhancedPacket, ngPacket:
+			if len(body) < 20 {
+				return nil, time.Time{}, fmt.Errorf("truncated pcapng packet")
+			}
+			id := r.order.Uint32(body)
+			if blockType == ngPacket {
+				id = uint32(r.order.Uint16(body))
+			}
+			if int(id) >= len(r.interfaces) {
+				return nil, time.Time{}, fmt.Errorf("pcapng packet of unknown interface %d", id)
+			}
+			info := r.interfaces[id]
+			length := r.order.Uint32(body[12:])
+			if int(length) > len(body)-20 {
+				return nil, time.Time{}, fmt.Errorf("truncated pcapng packet")
+			}
+			r.linkType = info.linkType
+			r.last = info.timestamp(uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:])))
+			return body[20 : 20+length], r.last, nil
+		case ngSimplePacket:
+			if len(body) < 4 || len(r.interfaces) == 0 {
+				return nil, time.Time{}, fmt.Errorf("invalid pcapng simple packet")
+			}
+			info := r.interfaces[0]
+			length := min(r.order.Uint32(body), uint32(len(body)-4))
+			if info.snapLen > 0 {
+				length = min(length, info.snapLen)
+			}
+			r.linkType = info.linkType
+			return body[4 : 4+length], r.last, nil // simple packets have no timestamp
+		}
+	}
+}
+
+// Next returns the next UDP datagram, skipping the other frames.
+// The payload is only valid until the next call. It returns io.EOF at the end of the file.
+func (r *Reader) Next() (*utils.Message, error) {
+	for {
+		frame, timestamp, err := r.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := DecodeUDP(r.linkType, frame)
+		if err != nil {
+			continue
+		}
+		msg.Received = timestamp
+		return msg, nil
+	}
+}
+
+// DecodeUDP extracts the UDP datagram of a frame.
+func DecodeUDP(linkType uint32, frame []byte) (*utils.Message, error) {
+	var etherType uint16
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(frame) < 14 {
+			return nil, ErrNotUDP
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 { // VLAN tags
+			if len(frame) < 4 {
+				return nil, ErrNotUDP
+			}
+			etherType, frame = binary.BigEndian.Uint16(frame[2:]), frame[4:]
+		}
+	case LinkTypeNull:
+		if len(frame) < 4 {
+			return nil, ErrNotUDP
+		}
+		// the address family is in the byte order of the capturing host
+		family := binary.LittleEndian.Uint32(frame)
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(frame)
+		}
+		switch family {
+		case 2:
+			etherType = 0x0800
+		case 24, 28, 30:
+			etherType = 0x86dd
+		}
+		frame = frame[4:]
+	case LinkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return nil, ErrNotUDP
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[14:]), frame[16:]
+	case LinkTypeLinuxSLL2:
+		if len(frame) < 20 {
+			return nil, ErrNotUDP
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame), frame[20:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		if len(frame) == 0 {
+			return nil, ErrNotUDP
+		}
+		switch frame[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86dd
+		}
+	default:
+		return nil, fmt.Errorf("unsupported link type %d", linkType)
+	}
+
+	var src, dst netip.Addr
+	switch etherType {
+	case 0x0800:
+		if len(frame) < 20 || frame[0]>>4 != 4 {
+			return nil, ErrNotUDP
+		}
+		headerLength := int(frame[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(frame[2:]))
+		fragment := binary.BigEndian.Uint16(frame[6:])
+		if frame[9] != 17 || fragment&0x3fff != 0 || headerLength < 20 || totalLength < headerLength || totalLength > len(frame) {
+			return nil, ErrNotUDP
+		}
+		src, _ = netip.AddrFromSlice(frame[12:16])
+		dst, _ = netip.AddrFromSlice(frame[16:20])
+		frame = frame[headerLength:totalLength]
+	case 0x86dd:
+		if len(frame) < 40 || frame[0]>>4 != 6 {
+			return nil, ErrNotUDP
+		}
+		payloadLength := int(binary.BigEndian.Uint16(frame[4:]))
+		next := frame[6]
+		src, _ = netip.AddrFromSlice(frame[8:24])
+		dst, _ = netip.AddrFromSlice(frame[24:40])
+		if 40+payloadLength > len(frame) {
+			return nil, ErrNotUDP
+		}
+		frame = frame[40 : 40+payloadLength]
+		for next == 0 || next == 43 || next == 60 { // hop-by-hop, routing and destination options
+			if len(frame) < 8 || len(frame) < (int(frame[1])+1)*8 {
+				return nil, ErrNotUDP
+			}
+			next, frame = frame[0], frame[(int(frame[1])+1)*8:]
+		}
+		if next != 17 {
+			return nil, ErrNotUDP
+		}
+	default:
+		return nil, ErrNotUDP
+	}
+
+	if len(frame) < 8 {
+		return nil, ErrNotUDP
+	}
+	length := int(binary.BigEndian.Uint16(frame[4:]))
+	if length < 8 || length > len(frame) {
+		return nil, ErrNotUDP
+	}
+	return &utils.Message{
+		Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(frame)),
+		Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(frame[2:])),
+		Payload: frame[8:length],
+	}, nil
+}
+
+// Writer writes UDP datagrams as raw IP packets in a classic pcap file.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the file header of a capture.
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := make([]byte, fileHeaderLength)
+	binary.LittleEndian.PutUint32(header[0:], magicNanoseconds)
+	binary.LittleEndian.PutUint16(header[4:], 2) // version 2.4
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], maxSnapLength)
+	binary.LittleEndian.PutUint32(header[20:], LinkTypeRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("write pcap header: %w", err)
+	}
+	return &Writer{w: w}, nil
+}
+
+func checksum(sum uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func foldChecksum(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// EncodeUDP returns an IP packet holding a UDP datagram. Both addresses must have the same family.
+func EncodeUDP(src, dst netip.AddrPort, payload []byte) ([]byte, error) {
+	srcAddr, dstAddr := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcAddr.Is4() != dstAddr.Is4() {
+		return nil, fmt.Errorf("mixed address families %s and %s", srcAddr, dstAddr)
+	}
+	udpLength := 8 + len(payload)
+	udp := make([]byte, 8, udpLength)
+	binary.BigEndian.PutUint16(udp[0:], src.Port())
+	binary.BigEndian.PutUint16(udp[2:], dst.Port())
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpLength))
+	udp = append(udp, payload...)
+
+	if srcAddr.Is4() {
+		if 20+udpLength > 0xffff {
+			return nil, fmt.Errorf("datagram too large")
+		}
+		ip := make([]byte, 20, 20+udpLength)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+udpLength))
+		ip[8] = 64
+		ip[9] = 17
+		s, d := srcAddr.As4(), dstAddr.As4()
+		copy(ip[12:], s[:])
+		copy(ip[16:], d[:])
+		binary.BigEndian.PutUint16(ip[10:], foldChecksum(checksum(0, ip)))
+		return append(ip, udp...), nil // the UDP checksum is optional over IPv4
+	}
+
+	if udpLength > 0xffff {
+		return nil, fmt.Errorf("datagram too large")
+	}
+	ip := make([]byte, 40, 40+udpLength)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(udpLength))
+	ip[6] = 17
+	ip[7] = 64
+	s, d := srcAddr.As16(), dstAddr.As16()
+	copy(ip[8:], s[:])
+	copy(ip[24:], d[:])
+	sum := checksum(0, ip[8:40]) + uint32(udpLength) + 17
+	sum = checksum(sum, udp)
+	csum := foldChecksum(sum)
+	if csum == 0 {
+		csum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], csum)
+	return append(ip, udp...), nil
+}
+
+// WriteMessage writes a datagram with the addresses and the reception time of a message.
+func (w *Writer) WriteMessage(msg *utils.Message) error {
+	packet, err := EncodeUDP(msg.Src, msg.Dst, msg.Payload)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, recordHeaderLen, recordHeaderLen+len(packet))
+	binary.LittleEndian.PutUint32(header[0:], uint32(msg.Received.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(msg.Received.Nanosecond()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(packet)))
+	if _, err := w.w.Write(append(header, packet...)); err != nil {
+		return fmt.Errorf("write pcap record: %w", err)
+	}
+	return nil
+}
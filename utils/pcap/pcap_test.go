@@ -0,0 +1,192 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/utils"
+)
+
+func TestPcapRoundTrip(t *testing.T) {
+	t.Parallel()
+	received := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	messages := []*utils.Message{
+		{Src: netip.MustParseAddrPort("192.0.2.1:50000"), Dst: netip.MustParseAddrPort("198.51.100.1:2055"), Payload: []byte("netflow"), Received: received},
+		{Src: netip.MustParseAddrPort("[2001:db8::1]:50000"), Dst: netip.MustParseAddrPort("[2001:db8::2]:6343"), Payload: []byte("sflow"), Received: received.Add(time.Second)},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, msg := range messages {
+		if err := w.WriteMessage(msg); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.LinkType() != LinkTypeRaw {
+		t.Fatalf("expected link type %d, got %d", LinkTypeRaw, r.LinkType())
+	}
+	for _, expected := range messages {
+		msg, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if msg.Src != expected.Src || msg.Dst != expected.Dst || string(msg.Payload) != string(expected.Payload) || !msg.Received.Equal(expected.Received) {
+			t.Fatalf("expected %+v, got %+v", expected, msg)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecodeUDPEthernet(t *testing.T) {
+	t.Parallel()
+	packet, err := EncodeUDP(netip.MustParseAddrPort("192.0.2.1:1000"), netip.MustParseAddrPort("192.0.2.2:2055"), []byte("payload"))
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+	frame := make([]byte, 12, 18+len(packet))
+	frame = append(frame, 0x81, 0x00, 0x00, 0x0a, 0x08, 0x00) // 802.1Q tag
+	frame = append(frame, packet...)
+	msg, err := DecodeUDP(LinkTypeEthernet, frame)
+	if err != nil {
+		t.Fatalf("DecodeUDP: %v", err)
+	}
+	if msg.Src.String() != "192.0.2.1:1000" || string(msg.Payload) != "payload" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	packet[9] = 6 // TCP
+	if _, err := DecodeUDP(LinkTypeRaw, packet); !errors.Is(err, ErrNotUDP) {
+		t.Fatalf("expected ErrNotUDP, got %v", err)
+	}
+}
+
+// ngBlock builds a little-endian pcapng block.
+func ngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	length := uint32(12 + len(body))
+	b := binary.LittleEndian.AppendUint32(nil, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
+
+func TestPcapngReader(t *testing.T) {
+	t.Parallel()
+	packet, err := EncodeUDP(netip.MustParseAddrPort("192.0.2.1:1000"), netip.MustParseAddrPort("192.0.2.2:2055"), []byte("payload"))
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+	received := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	ts := uint64(received.UnixNano())
+
+	shb := binary.LittleEndian.AppendUint32(nil, ngByteOrderMagic)
+	shb = append(shb, 1, 0, 0, 0)                                   // version 1.0
+	shb = binary.LittleEndian.AppendUint64(shb, 0xffffffffffffffff) // unknown section length
+	idb := []byte{LinkTypeRaw, 0, 0, 0, 0, 0, 0, 0}
+	idb = append(idb, ngOptionTsResol, 0, 1, 0, 9, 0, 0, 0) // nanoseconds
+	idb = append(idb, 0, 0, 0, 0)
+	epb := binary.LittleEndian.AppendUint32(nil, 0)
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(packet)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(packet)))
+	epb = append(epb, packet...)
+
+	var file []byte
+	file = append(file, ngBlock(ngSectionHeader, shb)...)
+	file = append(file, ngBlock(ngInterface, idb)...)
+	file = append(file, ngBlock(5, []byte{1, 2, 3, 4})...) // statistics, skipped
+	file = append(file, ngBlock(ngEnhancedPacket, epb)...)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	msg, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if msg.Src.String() != "192.0.2.1:1000" || string(msg.Payload) != "payload" || !msg.Received.Equal(received) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "replay.pcap")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, port := range []uint16{2055, 53, 6343} {
+		if err := w.WriteMessage(&utils.Message{
+			Src:      netip.MustParseAddrPort("192.0.2.1:1000"),
+			Dst:      netip.AddrPortFrom(netip.MustParseAddr("192.0.2.2"), port),
+			Payload:  []byte{byte(i)},
+			Received: received.Add(time.Duration(i) * 50 * time.Millisecond),
+		}); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+	f.Close()
+
+	r, err := NewReplayer(&ReplayerConfig{Path: path, Speed: 2})
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+	var decoded []utils.Message
+	start := time.Now()
+	if err := r.Start(func(msg interface{}) error {
+		m := *msg.(*utils.Message)
+		m.Payload = append([]byte(nil), m.Payload...)
+		decoded = append(decoded, m)
+		return nil
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-r.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the replay")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the replay to last 50ms, got %v", elapsed)
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if len(decoded) != 2 || r.Replayed() != 2 {
+		t.Fatalf("expected 2 datagrams, got %d", len(decoded))
+	}
+	if decoded[1].Payload[0] != 2 || decoded[1].Src.String() != "192.0.2.1:1000" || !decoded[1].Received.Equal(received.Add(100*time.Millisecond)) {
+		t.Fatalf("unexpected datagram %+v", decoded[1])
+	}
+}
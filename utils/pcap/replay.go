@@ -0,0 +1,181 @@
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgragnato/goflow/utils"
+)
+
+// DefaultPorts are the usual destination ports of NetFlow, IPFIX and sFlow.
+var DefaultPorts = []uint16{2055, 2056, 4739, 6343, 9995, 9996}
+
+// ReplayerConfig configures the replay of a capture.
+type ReplayerConfig struct {
+	Path  string
+	Speed float64  // replay speed relative to the capture, as fast as possible if 0
+	Ports []uint16 // destination ports of the datagrams, DefaultPorts if empty
+
+	Replicator *utils.Replicator // forwards datagrams before they are decoded
+}
+
+// Replayer feeds the UDP datagrams of a capture to a decoder, keeping their source
+// addresses and using their capture time as reception time.
+type Replayer struct {
+	path       string
+	speed      float64
+	ports      map[uint16]bool
+	replicator *utils.Replicator
+
+	file   *os.File
+	errCh  chan error
+	stopCh chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	replayed atomic.Uint64
+}
+
+// NewReplayer creates a replayer of a capture.
+func NewReplayer(cfg *ReplayerConfig) (*Replayer, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("pcap replay: missing path")
+	}
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("pcap replay: invalid speed %v", cfg.Speed)
+	}
+	ports := cfg.Ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+	r := &Replayer{
+		path:       cfg.Path,
+		speed:      cfg.Speed,
+		ports:      make(map[uint16]bool, len(ports)),
+		replicator: cfg.Replicator,
+		errCh:      make(chan error),
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, port := range ports {
+		r.ports[port] = true
+	}
+	return r, nil
+}
+
+// Errors returns a channel of replay and decoding errors.
+func (r *Replayer) Errors() <-chan error {
+	return r.errCh
+}
+
+// Done is closed when the replay is over.
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
+
+// Replayed returns the number of datagrams replayed.
+func (r *Replayer) Replayed() uint64 {
+	return r.replayed.Load()
+}
+
+func (r *Replayer) logError(err error) {
+	select {
+	case r.errCh <- err:
+	case <-r.stopCh:
+	}
+}
+
+// Start opens the capture and replays it in the background.
+// Datagrams are decoded one at a time and in order, so templates precede their data.
+func (r *Replayer) Start(decodeFunc utils.DecoderFunc) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("pcap replay: %w", err)
+	}
+	reader, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("pcap replay %s: %w", r.path, err)
+	}
+	r.file = f
+	go r.replay(reader, decodeFunc)
+	return nil
+}
+
+// wait sleeps until the time of a datagram relative to the first one, and reports
+// whether the replay was stopped.
+func (r *Replayer) wait(start, first, received time.Time) bool {
+	if r.speed == 0 {
+		select {
+		case <-r.stopCh:
+			return true
+		default:
+			return false
+		}
+	}
+	delay := time.Until(start.Add(time.Duration(float64(received.Sub(first)) / r.speed)))
+	if delay <= 0 {
+		return false
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false
+	case <-r.stopCh:
+		return true
+	}
+}
+
+func (r *Replayer) replay(reader *Reader, decodeFunc utils.DecoderFunc) {
+	defer close(r.done)
+	var start, first time.Time
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			r.logError(&utils.ReceiverError{Err: err})
+			return
+		}
+		if !r.ports[msg.Dst.Port()] {
+			continue
+		}
+		if start.IsZero() {
+			start, first = time.Now(), msg.Received
+		}
+		if r.wait(start, first, msg.Received) {
+			return
+		}
+
+		if r.replicator != nil {
+			if err := r.replicator.Replicate(msg.Src, msg.Payload); err != nil {
+				r.logError(&utils.ReceiverError{Err: err})
+			}
+		}
+		if decodeFunc != nil {
+			if err := decodeFunc(msg); err != nil {
+				r.logError(&utils.ReceiverError{Err: err})
+			}
+		}
+		r.replayed.Add(1)
+	}
+}
+
+// Stop interrupts the replay and closes the capture.
+func (r *Replayer) Stop() error {
+	var err error
+	r.once.Do(func() {
+		close(r.stopCh)
+		if r.file != nil {
+			<-r.done
+			err = r.file.Close()
+		}
+	})
+	return err
+}
@@ -4,6 +4,7 @@ package utils
 import (
 	"bytes"
 	"fmt"
+	"net/netip"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
 	"github.com/tgragnato/goflow/decoders/netflowlegacy"
@@ -252,6 +253,57 @@ func formatTemplateKey(key uint64) string {
 	return fmt.Sprintf("%d/%d/%d", version, obsDomainId, templateId)
 }
 
+// ForwardPipe passes flows forwarded by other collectors to a producer.
+type ForwardPipe struct {
+	flowpipe
+}
+
+// NewForwardPipe creates a flow pipe configured for forwarded flows.
+func NewForwardPipe(cfg *PipeConfig) *ForwardPipe {
+	p := &ForwardPipe{}
+	p.parseConfig(cfg)
+	return p
+}
+
+// DecodeFlow produces and sends the flows of a forwarded batch.
+func (p *ForwardPipe) DecodeFlow(msg interface{}) error {
+	batch, ok := msg.(*ForwardedBatch)
+	if !ok {
+		return fmt.Errorf("flow is not *ForwardedBatch")
+	}
+	if p.producer == nil {
+		return nil
+	}
+	// the remaining flows are processed after an error
+	var failed int
+	var lastErr error
+	for _, flow := range batch.Batch.GetFlows() {
+		samplerAddress, _ := netip.AddrFromSlice(flow.SamplerAddress)
+		args := producer.ProduceArgs{
+			Src:            batch.Src,
+			Dst:            batch.Dst,
+			TimeReceived:   batch.Received,
+			SamplerAddress: samplerAddress.Unmap(),
+		}
+		flowMessageSet, err := p.producer.Produce(flow, &args)
+		if err == nil {
+			err = p.formatSend(flowMessageSet)
+		}
+		p.producer.Commit(flowMessageSet)
+		if err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("batch %d from %s: %d flows failed: %w", batch.Batch.GetSequence(), batch.Src, failed, lastErr)
+	}
+	return nil
+}
+
+func (p *ForwardPipe) Close() {
+}
+
 // AutoFlowPipe dispatches to sFlow or NetFlow pipes based on payload.
 type AutoFlowPipe struct {
 	*SFlowPipe
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrReplicate marks a failure to forward a packet to a replication destination.
+	ErrReplicate = fmt.Errorf("replicate")
+)
+
+// ReplicateDestination is a destination receiving copies of the packets of a listener.
+type ReplicateDestination struct {
+	Addr      netip.AddrPort
+	Rate      uint64         // forwards one packet out of Rate, all the packets if 0 or 1
+	Exporters []netip.Prefix // forwards the packets of these exporters only, all if empty
+
+	count atomic.Uint64
+}
+
+// ParseReplicateDestination parses a destination, eg: 192.0.2.10:2055|rate=10|exporter=10.0.0.0/8.
+// Options are separated by a pipe, exporter can be repeated and accepts addresses or prefixes.
+func ParseReplicateDestination(spec string) (*ReplicateDestination, error) {
+	parts := strings.Split(spec, "|")
+	addr, err := netip.ParseAddrPort(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse replication destination %q: %w", parts[0], err)
+	}
+	d := &ReplicateDestination{Addr: normalizeAddrPort(addr)}
+	for _, option := range parts[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "rate":
+			d.Rate, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse replication rate %q: %w", value, err)
+			}
+		case "exporter":
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(value)
+				if addrErr != nil {
+					return nil, fmt.Errorf("parse replication exporter %q: %w", value, err)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			d.Exporters = append(d.Exporters, prefix.Masked())
+		default:
+			return nil, fmt.Errorf("unknown replication option %q", key)
+		}
+	}
+	return d, nil
+}
+
+// accept reports whether a packet from an exporter is forwarded to the destination.
+func (d *ReplicateDestination) accept(exporter netip.Addr) bool {
+	if len(d.Exporters) > 0 {
+		var found bool
+		for _, prefix := range d.Exporters {
+			if prefix.Contains(exporter) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if d.Rate > 1 {
+		return d.count.Add(1)%d.Rate == 1
+	}
+	return true
+}
+
+// Replicator forwards datagrams unchanged to destinations. When spoofing, the copies
+// keep the address and port of the exporter (IPv4 only, requires raw socket privileges).
+type Replicator struct {
+	destinations []*ReplicateDestination
+	conn         *net.UDPConn
+	spoofer      *spoofer
+}
+
+// NewReplicator opens the sockets used to forward packets. Spoofing is disabled
+// when the raw socket cannot be opened, see Spoofing.
+func NewReplicator(destinations []*ReplicateDestination, spoof bool) (*Replicator, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("replicator socket: %w", err)
+	}
+	r := &Replicator{
+		destinations: destinations,
+		conn:         conn,
+	}
+	if spoof {
+		r.spoofer, _ = newSpoofer() // falls back to the regular socket
+	}
+	return r, nil
+}
+
+// Spoofing reports whether the copies keep the source of the exporters.
+func (r *Replicator) Spoofing() bool {
+	return r.spoofer != nil
+}
+
+// Replicate forwards a packet received from an exporter to the matching destinations.
+func (r *Replicator) Replicate(src netip.AddrPort, payload []byte) error {
+	src = normalizeAddrPort(src)
+	var errs []error
+	for _, d := range r.destinations {
+		if !d.accept(src.Addr()) {
+			continue
+		}
+		if r.spoofer != nil && src.Addr().Is4() && d.Addr.Addr().Is4() {
+			if err := r.spoofer.send(src, d.Addr, payload); err != nil {
+				errs = append(errs, fmt.Errorf("%w to %s: %w", ErrReplicate, d.Addr, err))
+			}
+			continue
+		}
+		if _, err := r.conn.WriteToUDPAddrPort(payload, d.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("%w to %s: %w", ErrReplicate, d.Addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the sockets.
+func (r *Replicator) Close() error {
+	err := r.conn.Close()
+	if r.spoofer != nil {
+		err = errors.Join(err, r.spoofer.close())
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"syscall"
+)
+
+// spoofer sends UDP datagrams over IPv4 with the source of the exporter, using a raw socket.
+type spoofer struct {
+	fd int
+}
+
+func newSpoofer() (*spoofer, error) {
+	// IPPROTO_RAW implies that the IP header is provided
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("raw socket: %w", err)
+	}
+	return &spoofer{fd: fd}, nil
+}
+
+func (s *spoofer) send(src, dst netip.AddrPort, payload []byte) error {
+	const headers = 20 + 8
+	if len(payload) > 0xffff-headers {
+		return fmt.Errorf("packet too large")
+	}
+	packet := make([]byte, headers, headers+len(payload))
+	packet[0] = 0x45 // version 4, 20 bytes header
+	binary.BigEndian.PutUint16(packet[2:], uint16(headers+len(payload)))
+	packet[8] = 64 // TTL
+	packet[9] = syscall.IPPROTO_UDP
+	srcAddr, dstAddr := src.Addr().As4(), dst.Addr().As4()
+	copy(packet[12:], srcAddr[:])
+	copy(packet[16:], dstAddr[:])
+	// the kernel fills the IP checksum and identification, the UDP checksum is optional
+	binary.BigEndian.PutUint16(packet[20:], src.Port())
+	binary.BigEndian.PutUint16(packet[22:], dst.Port())
+	binary.BigEndian.PutUint16(packet[24:], uint16(8+len(payload)))
+	packet = append(packet, payload...)
+
+	if err := syscall.Sendto(s.fd, packet, 0, &syscall.SockaddrInet4{Addr: dstAddr}); err != nil {
+		return fmt.Errorf("raw send: %w", err)
+	}
+	return nil
+}
+
+func (s *spoofer) close() error {
+	return syscall.Close(s.fd)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// spoofer is only available on Linux.
+type spoofer struct{}
+
+func newSpoofer() (*spoofer, error) {
+	return nil, fmt.Errorf("spoofing is not supported on this platform")
+}
+
+func (s *spoofer) send(src, dst netip.AddrPort, payload []byte) error {
+	return fmt.Errorf("spoofing is not supported on this platform")
+}
+
+func (s *spoofer) close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseReplicateDestination(t *testing.T) {
+	t.Parallel()
+	d, err := ParseReplicateDestination("[2001:db8::1]:2055|rate=10|exporter=10.0.0.0/8|exporter=192.0.2.1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if d.Addr.String() != "[2001:db8::1]:2055" || d.Rate != 10 || len(d.Exporters) != 2 || d.Exporters[1].String() != "192.0.2.1/32" {
+		t.Fatalf("unexpected destination %+v", d)
+	}
+	for _, spec := range []string{"192.0.2.1", "192.0.2.1:2055|rate=x", "192.0.2.1:2055|exporter=x", "192.0.2.1:2055|port=1"} {
+		if _, err := ParseReplicateDestination(spec); err == nil {
+			t.Fatalf("expected error for %s", spec)
+		}
+	}
+}
+
+func TestReplicateDestinationAccept(t *testing.T) {
+	t.Parallel()
+	d, err := ParseReplicateDestination("127.0.0.1:2055|rate=3|exporter=10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if d.accept(netip.MustParseAddr("192.0.2.1")) {
+		t.Fatal("expected exporter to be filtered")
+	}
+	var accepted int
+	for i := 0; i < 9; i++ {
+		if d.accept(netip.MustParseAddr("10.1.2.3")) {
+			accepted++
+		}
+	}
+	if accepted != 3 {
+		t.Fatalf("expected 3 accepted packets, got %d", accepted)
+	}
+}
+
+func TestUDPReceiverReplicate(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	d, err := ParseReplicateDestination(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	replicator, err := NewReplicator([]*ReplicateDestination{d}, false)
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+	defer replicator.Close()
+
+	port, err := getFreeUDPPort()
+	if err != nil {
+		t.Fatalf("getFreeUDPPort: %v", err)
+	}
+	r, err := NewUDPReceiver(&UDPReceiverConfig{Sockets: 1, Workers: 1, QueueSize: 10, Replicator: replicator})
+	if err != nil {
+		t.Fatalf("NewUDPReceiver: %v", err)
+	}
+	if err := r.Start("127.0.0.1", port, nil); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		if err := r.Stop(); err != nil {
+			t.Errorf("Stop: %v", err)
+		}
+	}()
+
+	sender, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer sender.Close()
+	if _, err = sender.Write([]byte("message")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	buf := make([]byte, 100)
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf("deadline: %v", err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf[:n]) != "message" {
+		t.Fatalf("expected message, got %q", buf[:n])
+	}
+}
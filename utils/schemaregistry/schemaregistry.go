@@ -0,0 +1,146 @@
+// Package schemaregistry registers schemas with a Confluent-compatible schema registry
+// and frames messages using the Confluent wire format.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema types supported by the registry.
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+)
+
+// MagicByte starts every message in the Confluent wire format.
+const MagicByte = 0
+
+// Client is a minimal schema registry client.
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+type registerRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type registerResponse struct {
+	ID int32 `json:"id"`
+}
+
+// Register registers a schema under a subject and returns its ID.
+// Registering an existing schema returns the ID it already has.
+func (c *Client) Register(ctx context.Context, subject, schemaType, schema string) (int32, error) {
+	request := registerRequest{Schema: schema}
+	if schemaType != TypeAvro { // default type, omitted for older registries
+		request.SchemaType = schemaType
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, fmt.Errorf("encode schema: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	endpoint := strings.TrimSuffix(c.URL, "/") + "/subjects/" + url.PathEscape(subject) + "/versions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("register schema: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return 0, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("register schema: unexpected status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var response registerResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return response.ID, nil
+}
+
+// Subject resolves the ID of the schema of a subject, registering it on first use.
+type Subject struct {
+	Client *Client
+	Name   string
+	ID     int32 // static schema ID, skips registration when positive
+
+	lock       sync.Mutex
+	err        error
+	retryAfter time.Time
+}
+
+// retryInterval is the delay between registration attempts after a failure.
+const retryInterval = 10 * time.Second
+
+// SchemaID returns the static ID or registers the schema once and caches its ID.
+// After a failure, the error is returned without contacting the registry for a while.
+func (s *Subject) SchemaID(schemaType, schema string) (int32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ID > 0 {
+		return s.ID, nil
+	}
+	if s.Client == nil || s.Client.URL == "" {
+		return 0, fmt.Errorf("no schema ID nor registry configured")
+	}
+	if s.err != nil && time.Now().Before(s.retryAfter) {
+		return 0, s.err
+	}
+	id, err := s.Client.Register(context.Background(), s.Name, schemaType, schema)
+	if err != nil {
+		s.err = fmt.Errorf("subject %s: %w", s.Name, err)
+		s.retryAfter = time.Now().Add(retryInterval)
+		return 0, s.err
+	}
+	s.ID = id
+	return id, nil
+}
+
+// AppendHeader appends the magic byte and the schema ID.
+func AppendHeader(b []byte, id int32) []byte {
+	b = append(b, MagicByte)
+	return binary.BigEndian.AppendUint32(b, uint32(id))
+}
+
+// AppendProtobufHeader appends the header of a protobuf message, which also contains the
+// index of the message in the schema. Only the first message of the schema is supported.
+func AppendProtobufHeader(b []byte, id int32) []byte {
+	b = AppendHeader(b, id)
+	return append(b, 0) // message indexes [0] are encoded as an empty list
+}
@@ -0,0 +1,79 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSubjectSchemaID(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodPost || r.URL.Path != "/subjects/flows-value/versions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req registerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if req.SchemaType != TypeProtobuf || req.Schema != "syntax = \"proto3\";" {
+			t.Errorf("unexpected schema %+v", req)
+		}
+		_, _ = w.Write([]byte(`{"id":42}`))
+	}))
+	defer server.Close()
+
+	subject := &Subject{Client: &Client{URL: server.URL}, Name: "flows-value"}
+	for i := 0; i < 2; i++ {
+		id, err := subject.SchemaID(TypeProtobuf, "syntax = \"proto3\";")
+		if err != nil {
+			t.Fatalf("schema id: %v", err)
+		}
+		if id != 42 {
+			t.Fatalf("expected id 42, got %d", id)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("expected a single registration, got %d", requests.Load())
+	}
+
+	static := &Subject{ID: 7}
+	if id, err := static.SchemaID(TypeAvro, "{}"); err != nil || id != 7 {
+		t.Fatalf("expected static id 7, got %d (%v)", id, err)
+	}
+}
+
+func TestSubjectSchemaIDError(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	subject := &Subject{Client: &Client{URL: server.URL}, Name: "flows-value"}
+	for i := 0; i < 2; i++ {
+		if _, err := subject.SchemaID(TypeAvro, "{}"); err == nil {
+			t.Fatal("expected registration error")
+		}
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("expected registration retry to be delayed, got %d requests", requests.Load())
+	}
+}
+
+func TestAppendHeader(t *testing.T) {
+	t.Parallel()
+	if b := AppendHeader(nil, 258); !bytes.Equal(b, []byte{0, 0, 0, 1, 2}) {
+		t.Fatalf("unexpected header %x", b)
+	}
+	if b := AppendProtobufHeader(nil, 1); !bytes.Equal(b, []byte{0, 0, 0, 0, 1, 0}) {
+		t.Fatalf("unexpected protobuf header %x", b)
+	}
+}
@@ -0,0 +1,94 @@
+package applications
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+)
+
+// PersistenceHooks returns application hooks that only notify persistence on changes.
+func PersistenceHooks(notifyChange func()) Hooks {
+	return Hooks{
+		OnSet: func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string, _ bool) {
+			if notifyChange != nil {
+				notifyChange()
+			}
+		},
+		OnRemove: func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string) {
+			if notifyChange != nil {
+				notifyChange()
+			}
+		},
+	}
+}
+
+// MarshalJSONSnapshot marshals the current store contents directly from a snapshot.
+func MarshalJSONSnapshot(store Store) ([]byte, error) {
+	if store == nil {
+		return json.Marshal(map[string]map[string]string{})
+	}
+	snapshot := store.GetAll()
+	filtered := make(map[string]map[string]string, len(snapshot))
+	for router, entries := range snapshot {
+		if len(entries) == 0 {
+			continue
+		}
+		filtered[router] = entries
+	}
+	return json.Marshal(filtered)
+}
+
+// LoadJSON populates the store from a JSON buffer.
+func LoadJSON(store Store, buf []byte) error {
+	if store == nil || len(buf) == 0 {
+		return nil
+	}
+	var raw map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return fmt.Errorf("decode applications: %w", err)
+	}
+	for routerKey, entries := range raw {
+		for keyStr, payload := range entries {
+			var name string
+			if err := json.Unmarshal(payload, &name); err != nil {
+				return fmt.Errorf("decode application %s %s: %w", routerKey, keyStr, err)
+			}
+			version, obsDomainId, applicationId, err := parseApplicationKey(keyStr)
+			if err != nil {
+				return fmt.Errorf("invalid application key %q: %w", keyStr, err)
+			}
+			ctx := netflow.FlowContext{RouterKey: routerKey}
+			if err := store.Set(ctx, version, obsDomainId, applicationId, name); err != nil {
+				return fmt.Errorf("preload application %s %s: %w", routerKey, keyStr, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseApplicationKey(key string) (uint16, uint32, uint64, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("expected version/obs-domain/application-id")
+	}
+	version, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("parse application version: %w", err)
+	}
+	obsDomainId, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("parse application obs-domain: %w", err)
+	}
+	applicationId, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("parse application id: %w", err)
+	}
+	return uint16(version), uint32(obsDomainId), applicationId, nil
+}
+
+func formatApplicationKey(version uint16, obsDomainId uint32, applicationId uint64) string {
+	return fmt.Sprintf("%d/%d/%d", version, obsDomainId, applicationId)
+}
@@ -0,0 +1,258 @@
+// Package applications provides application name storage backed by FlowStore.
+package applications
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/pkg/flowstore"
+)
+
+type flowStoreApplicationKey struct {
+	RouterKey     string
+	Version       uint16
+	ObsDomainID   uint32
+	ApplicationID uint64
+}
+
+// ErrNotFound is returned when an application name entry is absent.
+var ErrNotFound = errors.New("application name not found")
+
+// Store describes application name storage keyed by router/version/obs-domain/application ID.
+type Store interface {
+	Set(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64, name string) error
+	Get(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64) (string, bool, error)
+	Remove(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64) (string, bool, error)
+	GetAll() map[string]map[string]string
+	Start()
+	Close()
+}
+
+// Hooks receives application name lifecycle events.
+type Hooks struct {
+	OnSet    func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string, existed bool) // called after Set
+	OnAccess func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string)               // called after Get
+	OnRemove func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string)               // called after Remove/expiry
+}
+
+// ComposeHooks combines multiple application hook sets into one.
+func ComposeHooks(hooks ...Hooks) Hooks {
+	var combined Hooks
+	for _, hookSet := range hooks {
+		if hookSet.OnSet != nil {
+			prev := combined.OnSet
+			next := hookSet.OnSet
+			combined.OnSet = func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string, existed bool) {
+				if prev != nil {
+					prev(router, version, obsDomainId, applicationId, name, existed)
+				}
+				next(router, version, obsDomainId, applicationId, name, existed)
+			}
+		}
+		if hookSet.OnAccess != nil {
+			prev := combined.OnAccess
+			next := hookSet.OnAccess
+			combined.OnAccess = func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string) {
+				if prev != nil {
+					prev(router, version, obsDomainId, applicationId, name)
+				}
+				next(router, version, obsDomainId, applicationId, name)
+			}
+		}
+		if hookSet.OnRemove != nil {
+			prev := combined.OnRemove
+			next := hookSet.OnRemove
+			combined.OnRemove = func(router string, version uint16, obsDomainId uint32, applicationId uint64, name string) {
+				if prev != nil {
+					prev(router, version, obsDomainId, applicationId, name)
+				}
+				next(router, version, obsDomainId, applicationId, name)
+			}
+		}
+	}
+	return combined
+}
+
+// ApplicationFlowStore implements Store using FlowStore with TTL and optional JSON persistence.
+type ApplicationFlowStore struct {
+	lock           sync.RWMutex
+	store          *flowstore.Store[flowStoreApplicationKey, string]
+	ttl            time.Duration
+	extendOnAccess bool
+	sweepInterval  time.Duration
+	now            func() time.Time
+	closeOnce      sync.Once
+	startOnce      sync.Once
+	hooks          Hooks
+	closeHooks     []func()
+}
+
+// FlowStoreOption configures ApplicationFlowStore.
+type FlowStoreOption func(*ApplicationFlowStore)
+
+// WithTTL sets the default TTL for application entries. Zero disables expiry.
+func WithTTL(ttl time.Duration) FlowStoreOption {
+	return func(s *ApplicationFlowStore) { s.ttl = ttl }
+}
+
+// WithExtendOnAccess refreshes the default TTL when entries are read.
+func WithExtendOnAccess(enable bool) FlowStoreOption {
+	return func(s *ApplicationFlowStore) { s.extendOnAccess = enable }
+}
+
+// WithSweepInterval sets how often the underlying FlowStore runs expiry sweeps.
+func WithSweepInterval(interval time.Duration) FlowStoreOption {
+	return func(s *ApplicationFlowStore) { s.sweepInterval = interval }
+}
+
+// WithHooks composes lifecycle hooks onto the store wrapper.
+func WithHooks(hooks Hooks) FlowStoreOption {
+	return func(s *ApplicationFlowStore) { s.hooks = ComposeHooks(s.hooks, hooks) }
+}
+
+// WithNow overrides the clock used for TTL calculations. Intended for tests.
+func WithNow(now func() time.Time) FlowStoreOption {
+	return func(s *ApplicationFlowStore) { s.now = now }
+}
+
+// WithCloseHook registers a callback run before the wrapped FlowStore is stopped.
+func WithCloseHook(hook func()) FlowStoreOption {
+	return func(s *ApplicationFlowStore) {
+		if hook != nil {
+			s.closeHooks = append(s.closeHooks, hook)
+		}
+	}
+}
+
+// NewApplicationFlowStore builds a FlowStore-backed application name store.
+func NewApplicationFlowStore(opts ...FlowStoreOption) *ApplicationFlowStore {
+	s := &ApplicationFlowStore{
+		sweepInterval: time.Minute,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	storeOpts := []flowstore.StoreOption[flowStoreApplicationKey, string]{
+		flowstore.WithRefreshTTLOnWrite[flowStoreApplicationKey, string](),
+		flowstore.WithNow[flowStoreApplicationKey, string](s.now),
+		flowstore.WithExpireHook[flowStoreApplicationKey, string](func(key flowStoreApplicationKey, val string) (bool, time.Duration) {
+			return false, 0
+		}),
+	}
+	if s.extendOnAccess {
+		storeOpts = append(storeOpts, flowstore.WithRefreshTTLOnRead[flowStoreApplicationKey, string]())
+	}
+	if s.ttl > 0 {
+		storeOpts = append(storeOpts, flowstore.WithDefaultTTL[flowStoreApplicationKey, string](s.ttl))
+	}
+	storeOpts = append(storeOpts, flowstore.WithHooks[flowStoreApplicationKey, string](s.buildStoreHooks()))
+
+	s.store = flowstore.NewStore[flowStoreApplicationKey, string](storeOpts...)
+	return s
+}
+
+// Start begins background expiry sweeps in the underlying FlowStore.
+func (s *ApplicationFlowStore) Start() {
+	s.startOnce.Do(func() {
+		s.store.Start(s.sweepInterval)
+	})
+}
+
+// Close runs shutdown hooks and stops background expiry sweeps.
+func (s *ApplicationFlowStore) Close() {
+	s.closeOnce.Do(func() {
+		for _, hook := range s.closeHooks {
+			hook()
+		}
+		s.store.Stop()
+	})
+}
+
+// Set stores or replaces an application name.
+func (s *ApplicationFlowStore) Set(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64, name string) error {
+	key := s.buildKey(ctx, version, obsDomainId, applicationId)
+	if _, err := s.store.Set(key, name); err != nil {
+		return fmt.Errorf("application set %s %d/%d/%d: %w", ctx.RouterKey, version, obsDomainId, applicationId, err)
+	}
+	return nil
+}
+
+// Get retrieves an application name.
+func (s *ApplicationFlowStore) Get(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64) (string, bool, error) {
+	key := s.buildKey(ctx, version, obsDomainId, applicationId)
+	var name string
+	if s.store.Get(key, &name) {
+		return name, true, nil
+	}
+	return "", false, nil
+}
+
+// Remove deletes an application name entry.
+func (s *ApplicationFlowStore) Remove(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64) (string, bool, error) {
+	key := s.buildKey(ctx, version, obsDomainId, applicationId)
+	var name string
+	if !s.store.GetQuiet(key, &name) {
+		return "", false, ErrNotFound
+	}
+	if s.store.Delete(key) {
+		return name, true, nil
+	}
+	return "", false, ErrNotFound
+}
+
+// GetAll returns a snapshot of all application names.
+func (s *ApplicationFlowStore) GetAll() map[string]map[string]string {
+	ret := make(map[string]map[string]string)
+	s.store.Range(func(key flowStoreApplicationKey, val string) bool {
+		router := key.RouterKey
+		bucket := ret[router]
+		if bucket == nil {
+			bucket = make(map[string]string)
+			ret[router] = bucket
+		}
+		bucket[formatApplicationKey(key.Version, key.ObsDomainID, key.ApplicationID)] = val
+		return true
+	})
+	return ret
+}
+
+// buildStoreHooks adapts application hooks onto the generic FlowStore hook API.
+func (s *ApplicationFlowStore) buildStoreHooks() flowstore.Hooks[flowStoreApplicationKey, string] {
+	s.lock.RLock()
+	hookSet := s.hooks
+	s.lock.RUnlock()
+
+	var hooks flowstore.Hooks[flowStoreApplicationKey, string]
+	if hookSet.OnSet != nil {
+		hooks.OnSet = func(key flowStoreApplicationKey, value string, existed bool) {
+			hookSet.OnSet(key.RouterKey, key.Version, key.ObsDomainID, key.ApplicationID, value, existed)
+		}
+	}
+	if hookSet.OnAccess != nil {
+		hooks.OnGet = func(key flowStoreApplicationKey, value string) {
+			hookSet.OnAccess(key.RouterKey, key.Version, key.ObsDomainID, key.ApplicationID, value)
+		}
+	}
+	if hookSet.OnRemove != nil {
+		hooks.OnDelete = func(key flowStoreApplicationKey, value string, _ flowstore.DeleteReason) {
+			hookSet.OnRemove(key.RouterKey, key.Version, key.ObsDomainID, key.ApplicationID, value)
+		}
+	}
+	return hooks
+}
+
+// buildKey converts the decoder-facing routing tuple into the internal FlowStore key.
+func (s *ApplicationFlowStore) buildKey(ctx netflow.FlowContext, version uint16, obsDomainId uint32, applicationId uint64) flowStoreApplicationKey {
+	return flowStoreApplicationKey{
+		RouterKey:     ctx.RouterKey,
+		Version:       version,
+		ObsDomainID:   obsDomainId,
+		ApplicationID: applicationId,
+	}
+}
@@ -0,0 +1,89 @@
+package applications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tgragnato/goflow/decoders/netflow"
+)
+
+func TestApplicationFlowStoreSetGetRemove(t *testing.T) {
+	t.Parallel()
+	store := NewApplicationFlowStore()
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+
+	if err := store.Set(ctx, 9, 1, 0x0d000050, "http"); err != nil {
+		t.Fatalf("set application: %v", err)
+	}
+	if err := store.Set(ctx, 9, 1, 0x0d0001bb, "https"); err != nil {
+		t.Fatalf("set application: %v", err)
+	}
+	name, ok, err := store.Get(ctx, 9, 1, 0x0d000050)
+	if err != nil || !ok {
+		t.Fatalf("get application: %v %v", ok, err)
+	}
+	if name != "http" {
+		t.Fatalf("expected application name http, got %q", name)
+	}
+	if _, ok, _ := store.Remove(ctx, 9, 1, 0x0d000050); !ok {
+		t.Fatalf("remove application: expected true")
+	}
+
+	all := store.GetAll()
+	if len(all) != 1 {
+		t.Fatalf("expected 1 router, got %d", len(all))
+	}
+	if got := all["router1"]["9/1/218104251"]; got != "https" {
+		t.Fatalf("expected remaining application https, got %q", got)
+	}
+}
+
+func TestApplicationFlowStoreExpires(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	store := NewApplicationFlowStore(
+		WithTTL(time.Minute),
+		WithNow(func() time.Time { return now }),
+	)
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+
+	if err := store.Set(ctx, 10, 1, 1, "dns"); err != nil {
+		t.Fatalf("set application: %v", err)
+	}
+
+	now = start.Add(2 * time.Minute)
+	if removed := store.store.ExpireStale(); removed != 1 {
+		t.Fatalf("expected 1 entry expired, got %d", removed)
+	}
+	if got := store.GetAll(); len(got) != 0 {
+		t.Fatalf("expected entries removed after expiry, got %d", len(got))
+	}
+}
+
+func TestApplicationJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	src := NewApplicationFlowStore()
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+	if err := src.Set(ctx, 10, 2, 0x14000001, "ssh"); err != nil {
+		t.Fatalf("set application: %v", err)
+	}
+
+	data, err := MarshalJSONSnapshot(src)
+	if err != nil {
+		t.Fatalf("marshal snapshot: %v", err)
+	}
+
+	dst := NewApplicationFlowStore()
+	if err := LoadJSON(dst, data); err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	name, ok, _ := dst.Get(ctx, 10, 2, 0x14000001)
+	if !ok || name != "ssh" {
+		t.Fatalf("expected preloaded application ssh, got %q (%v)", name, ok)
+	}
+
+	if err := LoadJSON(dst, []byte(`{"router1":{"10/2":"x"}}`)); err == nil {
+		t.Fatal("expected error on malformed key")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 	"github.com/tgragnato/goflow/utils/store/templates"
 )
@@ -32,7 +33,7 @@ type filePersistence struct {
 	emitError  func(error)
 }
 
-// Manager owns JSON persistence for sampling-rate and template flowstores.
+// Manager owns JSON persistence for sampling-rate, application and template flowstores.
 type Manager struct {
 	errCh     chan error
 	errMu     sync.Mutex
@@ -40,19 +41,22 @@ type Manager struct {
 	closeOnce sync.Once
 	stateMu   sync.Mutex
 
-	file          *filePersistence
-	samplingStore samplingrate.Store
-	templateStore netflow.ManagedTemplateStore
-	samplingOpen  bool
-	templateOpen  bool
-	preloadDoc    map[string]json.RawMessage
-	preloadErr    error
-	preloadOnce   sync.Once
+	file             *filePersistence
+	samplingStore    samplingrate.Store
+	applicationStore applications.Store
+	templateStore    netflow.ManagedTemplateStore
+	samplingOpen     bool
+	applicationOpen  bool
+	templateOpen     bool
+	preloadDoc       map[string]json.RawMessage
+	preloadErr       error
+	preloadOnce      sync.Once
 }
 
 const (
-	documentTemplatesKey   = "templates"
-	documentSampleRatesKey = "sampling-rates"
+	documentTemplatesKey    = "templates"
+	documentSampleRatesKey  = "sampling-rates"
+	documentApplicationsKey = "applications"
 )
 
 // New creates a new persistence manager.
@@ -98,6 +102,30 @@ func (m *Manager) NewSamplingRateStore(opts ...samplingrate.FlowStoreOption) (sa
 	return store, nil
 }
 
+// NewApplicationStore creates and preloads an application name store with JSON hooks.
+func (m *Manager) NewApplicationStore(opts ...applications.FlowStoreOption) (applications.Store, error) {
+	if m == nil {
+		return applications.NewApplicationFlowStore(opts...), nil
+	}
+
+	file := m.ensureFilePersistence()
+	storeOpts := append([]applications.FlowStoreOption{}, opts...)
+	storeOpts = append(storeOpts, applications.WithHooks(applications.PersistenceHooks(file.notifyChange)))
+	storeOpts = append(storeOpts, applications.WithCloseHook(m.newStoreCloseHook(documentApplicationsKey)))
+	store := applications.NewApplicationFlowStore(storeOpts...)
+
+	if err := m.preload(documentApplicationsKey, func(buf []byte) error {
+		return applications.LoadJSON(store, buf)
+	}); err != nil {
+		return nil, err
+	}
+
+	m.applicationStore = store
+	m.applicationOpen = true
+	m.file = file
+	return store, nil
+}
+
 // NewTemplateStore creates and preloads a template store with JSON hooks.
 func (m *Manager) NewTemplateStore(opts ...templates.FlowStoreOption) (netflow.ManagedTemplateStore, error) {
 	if m == nil {
@@ -175,6 +203,12 @@ func (m *Manager) closeStore(section string) {
 			return
 		}
 		m.samplingOpen = false
+	case documentApplicationsKey:
+		if !m.applicationOpen {
+			m.stateMu.Unlock()
+			return
+		}
+		m.applicationOpen = false
 	case documentTemplatesKey:
 		if !m.templateOpen {
 			m.stateMu.Unlock()
@@ -186,7 +220,7 @@ func (m *Manager) closeStore(section string) {
 		return
 	}
 	file = m.file
-	closeFile = !m.samplingOpen && !m.templateOpen
+	closeFile = !m.samplingOpen && !m.applicationOpen && !m.templateOpen
 	m.stateMu.Unlock()
 
 	if file == nil {
@@ -272,9 +306,9 @@ func (m *Manager) loadPreloadDocument() (map[string]json.RawMessage, error) {
 	return m.preloadDoc, nil
 }
 
-// marshalDocument renders the combined template and sampling-rate snapshot into one JSON document.
+// marshalDocument renders the combined template, sampling-rate and application snapshot into one JSON document.
 func (m *Manager) marshalDocument() ([]byte, error) {
-	document := make(map[string]json.RawMessage, 2)
+	document := make(map[string]json.RawMessage, 3)
 	if m.templateStore != nil {
 		data, err := templates.MarshalJSONSnapshot(m.templateStore)
 		if err != nil {
@@ -289,6 +323,13 @@ func (m *Manager) marshalDocument() ([]byte, error) {
 		}
 		document[documentSampleRatesKey] = data
 	}
+	if m.applicationStore != nil {
+		data, err := applications.MarshalJSONSnapshot(m.applicationStore)
+		if err != nil {
+			return nil, fmt.Errorf("marshal applications: %w", err)
+		}
+		document[documentApplicationsKey] = data
+	}
 	return json.Marshal(document)
 }
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/tgragnato/goflow/decoders/netflow"
+	"github.com/tgragnato/goflow/utils/store/applications"
 	"github.com/tgragnato/goflow/utils/store/samplingrate"
 	"github.com/tgragnato/goflow/utils/store/templates"
 )
@@ -124,6 +125,50 @@ func TestManagerPreloadsSamplingRatesAndTemplates(t *testing.T) {
 	}
 }
 
+func TestManagerPersistsApplications(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stores.json")
+
+	manager := New(Config{
+		Path:     path,
+		Interval: 0,
+	})
+	defer manager.Close()
+
+	applicationStore, err := manager.NewApplicationStore()
+	if err != nil {
+		t.Fatalf("new application store: %v", err)
+	}
+
+	manager.Start()
+
+	ctx := netflow.FlowContext{RouterKey: "router1"}
+	if err := applicationStore.Set(ctx, 9, 1, 0x0d000050, "http"); err != nil {
+		t.Fatalf("set application: %v", err)
+	}
+	waitForDocumentKeys(t, path, 1)
+	waitForSectionScopes(t, path, "applications", 1)
+
+	applicationStore.Close()
+
+	reloaded := New(Config{
+		Path: path,
+	})
+	defer reloaded.Close()
+	reloadedStore, err := reloaded.NewApplicationStore()
+	if err != nil {
+		t.Fatalf("reload application store: %v", err)
+	}
+	if _, ok := reloadedStore.(*applications.ApplicationFlowStore); !ok {
+		t.Fatalf("unexpected application store type %T", reloadedStore)
+	}
+	name, ok, _ := reloadedStore.Get(ctx, 9, 1, 0x0d000050)
+	if !ok || name != "http" {
+		t.Fatalf("expected preloaded application http, got %q (%v)", name, ok)
+	}
+}
+
 func TestStoreClosePersistsFinalSnapshot(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
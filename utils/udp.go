@@ -67,7 +67,8 @@ type UDPReceiver struct {
 	workers int
 	sockets int
 
-	cb ReceiverCallback
+	cb         ReceiverCallback
+	replicator *Replicator
 }
 
 // UDPReceiverConfig configures UDP receiver workers and sockets.
@@ -78,6 +79,7 @@ type UDPReceiverConfig struct {
 	QueueSize int
 
 	ReceiverCallback ReceiverCallback
+	Replicator       *Replicator // forwards packets before they are decoded
 }
 
 // NewUDPReceiver creates a UDP receiver with the provided configuration.
@@ -106,6 +108,7 @@ func NewUDPReceiver(cfg *UDPReceiverConfig) (*UDPReceiver, error) {
 		dispatchSize = cfg.QueueSize
 		r.blocking = cfg.Blocking
 		r.cb = cfg.ReceiverCallback
+		r.replicator = cfg.Replicator
 	}
 	r.dispatchSize = dispatchSize
 
@@ -205,6 +208,12 @@ func (r *UDPReceiver) receiveRoutine(udpconn *net.UDPConn) (err error) {
 			// error
 			continue
 		}
+		if r.replicator != nil {
+			// replicated even if the packet is dropped or not decoded
+			if err := r.replicator.Replicate(pkt.src.AddrPort(), pkt.payload[0:pkt.size]); err != nil {
+				r.logError(&ReceiverError{err})
+			}
+		}
 
 		if r.blocking {
 			// does not drop